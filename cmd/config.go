@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/waynecraig/wechat-token-hub/internal/auth"
+	"github.com/waynecraig/wechat-token-hub/internal/envelope"
+	"github.com/waynecraig/wechat-token-hub/internal/logging"
+	"github.com/waynecraig/wechat-token-hub/internal/policy"
+	"github.com/waynecraig/wechat-token-hub/internal/secrets"
+	"github.com/waynecraig/wechat-token-hub/internal/store"
+	"github.com/waynecraig/wechat-token-hub/internal/tokens"
+)
+
+// check the env vars, the policy file and the store file the server would use
+func configValidate(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// the secrets set in env as references or enc:v1:... are checked in plaintext
+	errs := []error{secrets.ResolveEnv(context.Background()), envelope.DecryptEnv()}
+	errs = append(errs, tokens.CheckConfig(), auth.CheckKeys(), store.Check(), checkWebhooks())
+	if err := logging.Setup(io.Discard, os.Getenv("LOG_LEVEL"), os.Getenv("LOG_FORMAT")); err != nil {
+		errs = append(errs, err)
+	}
+	if path := os.Getenv("POLICY_FILE"); path != "" {
+		if err := policy.Load(path); err != nil {
+			errs = append(errs, fmt.Errorf("load policy fail: %w", err))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid config:\n%w", err)
+	}
+	fmt.Fprintln(stdout, "config ok")
+	return nil
+}
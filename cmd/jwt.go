@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/auth"
+)
+
+// sign a JWT for a client with the JWT_KEY_{kid} secret
+func jwtMint(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("jwt mint", flag.ContinueOnError)
+	kid := fs.String("kid", "", "the key id, whose secret is set in JWT_KEY_{kid}")
+	sub := fs.String("sub", "", "the name of the client, shown in the logs and metrics")
+	scope := fs.String("scope", "", "the space or comma separated scopes, such as admin")
+	ttl := fs.Duration("ttl", 24*time.Hour, "how long the token is valid, 0 means forever")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *kid == "" {
+		return fmt.Errorf("the -kid flag is required")
+	}
+
+	scopes := strings.FieldsFunc(*scope, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+	token, err := auth.MintJwtToken(*kid, *sub, scopes, *ttl)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, token)
+	return nil
+}
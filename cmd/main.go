@@ -1,24 +1,75 @@
 package main
 
 import (
-	"log"
-	"net/http"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"os"
-
-	"github.com/waynecraig/wechat-token-hub/internal/http/handler"
-	mw "github.com/waynecraig/wechat-token-hub/internal/http/middleware"
 )
 
+const usage = `Usage: wechat-token-hub <command> [flags]
+
+Commands:
+  serve                      run the hub server, the default command
+  config validate            check the env vars and the policy file
+  jwt mint                   sign a JWT for a client with the configured keys
+  token get <path>           get a credential from a running hub, such as /access_token
+  token rotate <path>        rotate a credential of a running hub
+  cache inspect              list the values in the STORE_FILE by fingerprint
+  quota show                 show the upstream calls counted in the STORE_FILE
+  store reencrypt            encrypt the STORE_FILE again with the current master key
+  secret encrypt             encrypt a secret read from stdin to set it in an env var
+  mock                       run a mock of the WeChat API for local development
+
+Run "wechat-token-hub <command> -h" for the flags of a command.
+`
+
 func main() {
-	// get the port from env, default to 8567
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8567"
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "wechat-token-hub:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run the command in args, writing its output to stdout
+func run(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return serve(nil)
 	}
-	log.Printf("use port %s", port)
 
-	// set up the http server
-	http.HandleFunc("/access_token", handler.AccessToken)
-	http.HandleFunc("/ticket", handler.Ticket)
-	log.Fatal(http.ListenAndServe(":"+port, mw.Logger(mw.OnlyGet(mw.Auth(http.DefaultServeMux)))))
+	command, args := args[0], args[1:]
+	// the second word of the commands made of two
+	sub := ""
+	if len(args) > 0 {
+		sub = args[0]
+	}
+
+	switch {
+	case command == "serve":
+		return serve(args)
+	case command == "config" && sub == "validate":
+		return configValidate(args[1:], stdout)
+	case command == "jwt" && sub == "mint":
+		return jwtMint(args[1:], stdout)
+	case command == "token" && (sub == "get" || sub == "rotate"):
+		return token(sub, args[1:], stdout)
+	case command == "cache" && sub == "inspect":
+		return cacheInspect(args[1:], stdout)
+	case command == "quota" && sub == "show":
+		return quotaShow(args[1:], stdout)
+	case command == "store" && sub == "reencrypt":
+		return storeReencrypt(args[1:], stdout)
+	case command == "secret" && sub == "encrypt":
+		return secretEncrypt(args[1:], stdout)
+	case command == "mock":
+		return mock(args, stdout)
+	case command == "help" || command == "-h" || command == "--help":
+		fmt.Fprint(stdout, usage)
+		return nil
+	}
+	fmt.Fprint(os.Stderr, usage)
+	return fmt.Errorf("unknown command %q", command)
 }
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/waynecraig/wechat-token-hub/internal/auth"
+	"github.com/waynecraig/wechat-token-hub/internal/envelope"
+	"github.com/waynecraig/wechat-token-hub/internal/quota"
+	"github.com/waynecraig/wechat-token-hub/internal/store"
+)
+
+// set the env vars until the test ends
+func setEnv(t *testing.T, envVars map[string]string) {
+	for k, v := range envVars {
+		os.Setenv(k, v)
+	}
+	t.Cleanup(func() {
+		for k := range envVars {
+			os.Unsetenv(k)
+		}
+	})
+}
+
+func TestRunUnknownCommand(t *testing.T) {
+	var out bytes.Buffer
+	if err := run([]string{"config", "delete"}, &out); err == nil {
+		t.Errorf("run() accepted an unknown command")
+	}
+	if err := run([]string{"help"}, &out); err != nil || !strings.Contains(out.String(), "jwt mint") {
+		t.Errorf("run(help) = %v, %s", err, out.String())
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	setEnv(t, map[string]string{"APPID": "wxcli", "WECHAT_API_ROOT": "http://localhost"})
+
+	var out bytes.Buffer
+	err := run([]string{"config", "validate"}, &out)
+	if err == nil || !strings.Contains(err.Error(), "APPSECRET is not set") || !strings.Contains(err.Error(), "JWT_KEY_") {
+		t.Errorf("run(config validate) error = %v, want the missing secret and key", err)
+	}
+
+	setEnv(t, map[string]string{"APPSECRET": "cli_app_secret", "JWT_KEY_cli": "cli_jwt_key"})
+	if err := run([]string{"config", "validate"}, &out); err != nil || !strings.Contains(out.String(), "config ok") {
+		t.Errorf("run(config validate) = %v, %s", err, out.String())
+	}
+
+	// the webhooks are never sent unsigned
+	setEnv(t, map[string]string{"WEBHOOK_URLS": "http://localhost/hook"})
+	if err := run([]string{"config", "validate"}, &out); err == nil || !strings.Contains(err.Error(), "WEBHOOK_SECRET is not set") {
+		t.Errorf("run(config validate) error = %v, want the missing webhook secret", err)
+	}
+	setEnv(t, map[string]string{"WEBHOOK_SECRET": "cli_webhook_secret"})
+	if err := run([]string{"config", "validate"}, &out); err != nil {
+		t.Errorf("run(config validate) error = %v", err)
+	}
+}
+
+func TestConfigValidateSecretFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appsecret")
+	os.WriteFile(path, []byte("cli_file_app_secret\n"), 0600)
+	setEnv(t, map[string]string{
+		"APPID":           "wxcli",
+		"APPSECRET":       "file://" + path,
+		"WECHAT_API_ROOT": "http://localhost",
+		"JWT_KEY_cli":     "cli_jwt_key",
+	})
+
+	var out bytes.Buffer
+	if err := run([]string{"config", "validate"}, &out); err != nil {
+		t.Fatalf("run(config validate) error = %v", err)
+	}
+	if value := os.Getenv("APPSECRET"); value != "cli_file_app_secret" {
+		t.Errorf("APPSECRET = %s, want the secret of the file", value)
+	}
+
+	os.Setenv("APPSECRET", "file://"+path+".missing")
+	if err := run([]string{"config", "validate"}, &out); err == nil || !strings.Contains(err.Error(), "resolve APPSECRET fail") {
+		t.Errorf("run(config validate) error = %v, want the missing secret file", err)
+	}
+}
+
+func TestJwtMint(t *testing.T) {
+	setEnv(t, map[string]string{"JWT_KEY_cli": "cli_jwt_key", "JWT_SCOPES_cli": "admin read"})
+
+	var out bytes.Buffer
+	if err := run([]string{"jwt", "mint", "-sub", "client1"}, &out); err == nil {
+		t.Errorf("run(jwt mint) accepted a missing kid")
+	}
+	if err := run([]string{"jwt", "mint", "-kid", "cli", "-sub", "client1", "-scope", "admin,read", "-ttl", "1h"}, &out); err != nil {
+		t.Fatalf("run(jwt mint) error = %v", err)
+	}
+	principal, err := auth.ParseJwtToken(strings.TrimSpace(out.String()))
+	if err != nil {
+		t.Fatalf("ParseJwtToken() error = %v", err)
+	}
+	if principal.Subject != "client1" || !principal.HasScope("admin") || !principal.HasScope("read") {
+		t.Errorf("Unexpected principal: %+v", principal)
+	}
+}
+
+func TestToken(t *testing.T) {
+	// a hub returning token1, and token2 once token1 is rotated by its
+	// fingerprint, the token itself is never sent back
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer cli_jwt" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if strings.Contains(r.URL.RawQuery, "token1") {
+			http.Error(w, "token in the url", http.StatusBadRequest)
+			return
+		}
+		if r.Header.Get("X-Rotate-Fingerprint") == "fp1" {
+			w.Header().Set("X-Credential-Fingerprint", "fp2")
+			w.Write([]byte("token2"))
+			return
+		}
+		w.Header().Set("X-Credential-Fingerprint", "fp1")
+		w.Write([]byte("token1"))
+	}))
+	defer hub.Close()
+	setEnv(t, map[string]string{"HUB_URL": hub.URL, "HUB_JWT": "cli_jwt"})
+
+	var out bytes.Buffer
+	if err := run([]string{"token", "get", "/access_token"}, &out); err != nil || out.String() != "token1\n" {
+		t.Errorf("run(token get) = %v, %q", err, out.String())
+	}
+	out.Reset()
+	if err := run([]string{"token", "rotate", "/access_token?appid=wx1"}, &out); err != nil || out.String() != "token2\n" {
+		t.Errorf("run(token rotate) = %v, %q", err, out.String())
+	}
+	if err := run([]string{"token", "get", "-jwt", "wrong", "/access_token"}, &out); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("run(token get) error = %v, want 401", err)
+	}
+}
+
+func TestCacheInspectAndQuotaShow(t *testing.T) {
+	var out bytes.Buffer
+	if err := run([]string{"cache", "inspect"}, &out); err == nil {
+		t.Errorf("run(cache inspect) accepted a missing STORE_FILE")
+	}
+
+	setEnv(t, map[string]string{"STORE_FILE": filepath.Join(t.TempDir(), "store.json")})
+	store.Save("authorizer_refresh_token_wx1", "cli_refresh_token")
+	quota.Record("access_token")
+	defer quota.Reset("access_token")
+
+	if err := run([]string{"cache", "inspect"}, &out); err != nil {
+		t.Fatalf("run(cache inspect) error = %v", err)
+	}
+	if !strings.Contains(out.String(), "authorizer_refresh_token_wx1") || strings.Contains(out.String(), "cli_refresh_token") {
+		t.Errorf("Unexpected cache inspect output: %s", out.String())
+	}
+
+	out.Reset()
+	if err := run([]string{"quota", "show"}, &out); err != nil {
+		t.Fatalf("run(quota show) error = %v", err)
+	}
+	if !strings.Contains(out.String(), "access_token") {
+		t.Errorf("Unexpected quota show output: %s", out.String())
+	}
+}
+
+func TestStoreReencrypt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	setEnv(t, map[string]string{"STORE_FILE": path})
+	store.Save("authorizer_refresh_token_wx1", "cli_refresh_token")
+
+	setEnv(t, map[string]string{"MASTER_KEY": "v1=MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="})
+	var out bytes.Buffer
+	if err := run([]string{"store", "reencrypt"}, &out); err != nil {
+		t.Fatalf("run(store reencrypt) error = %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(out.String(), "v1") || strings.Contains(string(data), "cli_refresh_token") {
+		t.Errorf("Unexpected store reencrypt output: %s, file: %s", out.String(), data)
+	}
+	if value := store.Get("authorizer_refresh_token_wx1"); value != "cli_refresh_token" {
+		t.Errorf("Get() = %s after reencrypt", value)
+	}
+}
+
+func TestSecretEncrypt(t *testing.T) {
+	var out bytes.Buffer
+	stdin = strings.NewReader("cli_app_secret\n")
+	defer func() { stdin = os.Stdin }()
+	if err := run([]string{"secret", "encrypt", "-name", "APPSECRET"}, &out); err == nil {
+		t.Errorf("run(secret encrypt) accepted a missing master key")
+	}
+
+	setEnv(t, map[string]string{"MASTER_KEY": "v1=MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="})
+	if err := run([]string{"secret", "encrypt", "-name", "APPSECRET"}, &out); err != nil {
+		t.Fatalf("run(secret encrypt) error = %v", err)
+	}
+
+	// the hub decrypts the env var when it starts
+	setEnv(t, map[string]string{"APPSECRET": strings.TrimSpace(out.String())})
+	if err := envelope.DecryptEnv(); err != nil || os.Getenv("APPSECRET") != "cli_app_secret" {
+		t.Errorf("DecryptEnv() = %v, APPSECRET = %s", err, os.Getenv("APPSECRET"))
+	}
+}
+
+func TestNewMock(t *testing.T) {
+	server, err := newMock("wx1:secret1,wx2:secret2", "wxc:csecret")
+	if err != nil {
+		t.Fatalf("newMock() error = %v", err)
+	}
+	rr := httptest.NewRecorder()
+	server.ServeHTTP(rr, httptest.NewRequest("GET", "/cgi-bin/token?grant_type=client_credential&appid=wx2&secret=secret2", nil))
+	if !strings.Contains(rr.Body.String(), `"access_token"`) {
+		t.Errorf("Expected a token from the mock, got %s", rr.Body.String())
+	}
+
+	if _, err := newMock("wx1", ""); err == nil {
+		t.Errorf("newMock() accepted an account without secret")
+	}
+	if _, err := newMock("", "wxc"); err == nil {
+		t.Errorf("newMock() accepted a component without secret")
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/waynecraig/wechat-token-hub/pkg/wechatmock"
+)
+
+// run a mock of the WeChat API, point WECHAT_API_ROOT of a hub to it
+func mock(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("mock", flag.ContinueOnError)
+	addr := fs.String("addr", "localhost:8568", "the address to listen on")
+	accounts := fs.String("accounts", "", "the comma separated accounts as appid:secret")
+	component := fs.String("component", "", "the third-party platform as appid:secret, with any verify ticket")
+	expiresIn := fs.Int("expires-in", 7200, "seconds until the issued credentials expire")
+	dailyLimit := fs.Int("daily-limit", 2000, "the calls allowed a day for each api of each account")
+	latency := fs.Duration("latency", 0, "the delay before each response")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	server, err := newMock(*accounts, *component)
+	if err != nil {
+		return err
+	}
+	server.ExpiresIn = *expiresIn
+	server.DailyLimit = *dailyLimit
+	server.Latency = *latency
+
+	fmt.Fprintf(stdout, "mock WeChat API listening on http://%s\n", *addr)
+	return http.ListenAndServe(*addr, server)
+}
+
+// create the mock with the accounts and the component given as appid:secret
+func newMock(accounts string, component string) (*wechatmock.Server, error) {
+	server := wechatmock.New()
+	for _, a := range strings.Split(accounts, ",") {
+		if a == "" {
+			continue
+		}
+		appid, secret, ok := strings.Cut(a, ":")
+		if !ok || appid == "" || secret == "" {
+			return nil, fmt.Errorf("invalid account %q, want appid:secret", a)
+		}
+		server.AddAccount(appid, secret)
+	}
+	if component != "" {
+		appid, secret, ok := strings.Cut(component, ":")
+		if !ok || appid == "" || secret == "" {
+			return nil, fmt.Errorf("invalid component %q, want appid:secret", component)
+		}
+		server.SetComponent(appid, secret, "")
+	}
+	return server, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/waynecraig/wechat-token-hub/internal/envelope"
+)
+
+// where secret encrypt reads the secret, so that it's not in the shell history
+var stdin io.Reader = os.Stdin
+
+// encrypt a secret read from stdin with the master key, to set it in the env
+// var of the name, such as APPSECRET=enc:v1:...
+func secretEncrypt(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("secret encrypt", flag.ContinueOnError)
+	name := fs.String("name", "", "the env var the secret is set in, such as APPSECRET")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" {
+		return fmt.Errorf("the -name flag is required")
+	}
+	if enabled, err := envelope.Enabled(); err != nil {
+		return err
+	} else if !enabled {
+		return envelope.ErrNoKey
+	}
+
+	secret, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	secret = strings.TrimRight(secret, "\r\n")
+	if secret == "" {
+		return fmt.Errorf("no secret read from stdin")
+	}
+
+	encrypted, err := envelope.Encrypt(*name, secret)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, encrypted)
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/audit"
+	"github.com/waynecraig/wechat-token-hub/internal/envelope"
+	"github.com/waynecraig/wechat-token-hub/internal/events"
+	"github.com/waynecraig/wechat-token-hub/internal/http/handler"
+	mw "github.com/waynecraig/wechat-token-hub/internal/http/middleware"
+	"github.com/waynecraig/wechat-token-hub/internal/logging"
+	"github.com/waynecraig/wechat-token-hub/internal/metrics"
+	"github.com/waynecraig/wechat-token-hub/internal/policy"
+	"github.com/waynecraig/wechat-token-hub/internal/redact"
+	"github.com/waynecraig/wechat-token-hub/internal/secrets"
+	"github.com/waynecraig/wechat-token-hub/internal/tokens"
+)
+
+// run the hub server until it fails
+func serve(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// set up the structured logs
+	if err := logging.Setup(os.Stderr, os.Getenv("LOG_LEVEL"), os.Getenv("LOG_FORMAT")); err != nil {
+		return fmt.Errorf("set up logging fail: %w", err)
+	}
+
+	// read the secrets set in env as references, such as file:///run/secrets/appsecret,
+	// and decrypt those set as enc:v1:..., with the master key
+	if err := loadSecrets(secrets.ResolveEnv); err != nil {
+		return err
+	}
+
+	// read the secrets again on SIGHUP, after they are rotated
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := loadSecrets(secrets.Reload); err != nil {
+				slog.Error("reload secrets fail", "error", err)
+				continue
+			}
+			slog.Info("secrets reloaded")
+		}
+	}()
+
+	// get the port from env, default to 8567
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8567"
+	}
+	slog.Info("use port", "port", port)
+
+	// load the access policy of the clients
+	if path := os.Getenv("POLICY_FILE"); path != "" {
+		if err := policy.Load(path); err != nil {
+			return fmt.Errorf("load policy fail: %w", err)
+		}
+	}
+
+	// write the audit log to the file at AUDIT_FILE
+	if path := os.Getenv("AUDIT_FILE"); path != "" {
+		maxSize, _ := strconv.ParseInt(os.Getenv("AUDIT_FILE_MAX_SIZE"), 10, 64)
+		sink, err := audit.NewFileSink(path, maxSize)
+		if err != nil {
+			return fmt.Errorf("open audit file fail: %w", err)
+		}
+		audit.SetSink(sink)
+	}
+
+	// post the events to the webhooks at WEBHOOK_URLS, signed with WEBHOOK_SECRET
+	if err := checkWebhooks(); err != nil {
+		return err
+	}
+	if urls := os.Getenv("WEBHOOK_URLS"); urls != "" {
+		events.StartWebhooks(strings.Split(urls, ","), os.Getenv("WEBHOOK_SECRET"), &http.Client{Timeout: 10 * time.Second})
+	}
+
+	// the credential paths, which also accept the credential to rotate by its
+	// fingerprint in a POST body
+	credentials := map[string]http.HandlerFunc{
+		"/access_token":           handler.AccessToken,
+		"/ticket":                 handler.Ticket,
+		"/component_access_token": handler.ComponentAccessToken,
+		"/authorizers/":           handler.AuthorizerAccessToken,
+		"/wecom/access_token":     handler.WecomAccessToken,
+		"/wecom/ticket":           handler.WecomTicket,
+	}
+
+	// set up the authenticated api
+	api := http.NewServeMux()
+	for path, h := range credentials {
+		api.HandleFunc(path, h)
+	}
+	api.HandleFunc("/pre_auth_code", handler.PreAuthCode)
+	api.Handle("/metrics", metrics.Handler())
+	api.HandleFunc("/quota", handler.Quota)
+	api.HandleFunc("/oauth/", handler.OAuth)
+	api.HandleFunc("/events", handler.Events)
+
+	// set up the admin api, which requires the admin scope
+	admin := http.NewServeMux()
+	admin.HandleFunc("/admin/quota", handler.AdminAPIQuota)
+	admin.HandleFunc("/admin/quota/clear", handler.AdminClearQuota)
+	admin.HandleFunc("/admin/audit", handler.AdminAudit)
+	admin.HandleFunc("/admin/credentials", handler.AdminCredentials)
+	admin.HandleFunc("/admin/credentials/", handler.AdminCredential)
+	admin.HandleFunc("/admin/refresh", handler.AdminRefresh)
+	admin.HandleFunc("/admin/refresh/pause", handler.AdminPauseRefresh)
+	admin.HandleFunc("/admin/refresh/resume", handler.AdminResumeRefresh)
+	admin.HandleFunc("/admin/upstream_errors", handler.AdminUpstreamErrors)
+
+	// refresh the authorizer access tokens in the background for the open platform
+	if os.Getenv("COMPONENT_APPID") != "" {
+		tokens.StartAuthorizerRefresher(time.Minute, 10*time.Minute)
+	}
+
+	// set up the http server, the callback is called by wechat and verified by
+	// its signature, the health checks are probed by the load balancer without a
+	// JWT. The ip limit applies before the authentication, so that the requests
+	// with an invalid JWT are limited as well.
+	mux := http.NewServeMux()
+	mux.Handle("/", mw.IPRateLimit(mw.OnlyGet(mw.Auth(mw.RateLimit(api)))))
+	for path := range credentials {
+		mux.Handle(path, mw.IPRateLimit(mw.OnlyGetOrPost(mw.Auth(mw.RateLimit(api)))))
+	}
+	mux.Handle("/admin/", mw.IPRateLimit(mw.Auth(mw.RequireScope("admin", mw.RateLimit(admin)))))
+	mux.Handle("/proxy/", mw.IPRateLimit(mw.Auth(mw.RateLimit(http.HandlerFunc(handler.Proxy)))))
+	mux.Handle("/miniprogram/", mw.IPRateLimit(mw.Auth(mw.RateLimit(http.HandlerFunc(handler.MiniProgram)))))
+	mux.HandleFunc("/component/callback", handler.ComponentCallback)
+	mux.HandleFunc("/healthz", handler.Healthz)
+	mux.HandleFunc("/readyz", handler.Readyz)
+
+	// label the metrics with the pattern of the api, the admin api or the outer mux
+	route := func(r *http.Request) string {
+		for _, m := range []*http.ServeMux{api, admin} {
+			if _, pattern := m.Handler(r); pattern != "" {
+				return pattern
+			}
+		}
+		_, pattern := mux.Handler(r)
+		return pattern
+	}
+	return http.ListenAndServe(":"+port, mw.Logger(mw.Metrics(route, mux)))
+}
+
+// resolve the secrets set in env as references and decrypt the encrypted
+// ones, then redact them from the logs and error responses
+func loadSecrets(resolve func(ctx context.Context) error) error {
+	if err := resolve(context.Background()); err != nil {
+		return fmt.Errorf("resolve secrets fail: %w", err)
+	}
+	if err := envelope.DecryptEnv(); err != nil {
+		return fmt.Errorf("decrypt env fail: %w", err)
+	}
+	redact.RegisterEnv()
+	return nil
+}
+
+// the webhooks must be signed, so that the receivers can check the events
+// come from the hub
+func checkWebhooks() error {
+	if os.Getenv("WEBHOOK_URLS") != "" && os.Getenv("WEBHOOK_SECRET") == "" {
+		return fmt.Errorf("WEBHOOK_SECRET is not set, it's required to sign the events posted to WEBHOOK_URLS")
+	}
+	return nil
+}
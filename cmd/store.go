@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/waynecraig/wechat-token-hub/internal/fingerprint"
+	"github.com/waynecraig/wechat-token-hub/internal/quota"
+	"github.com/waynecraig/wechat-token-hub/internal/store"
+)
+
+// list the keys of the STORE_FILE with the fingerprints of their values, the
+// values are secrets such as the authorizer refresh tokens
+func cacheInspect(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("cache inspect", flag.ContinueOnError)
+	prefix := fs.String("prefix", "", "only list the keys starting with the prefix")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if os.Getenv("STORE_FILE") == "" {
+		return fmt.Errorf("STORE_FILE is not set")
+	}
+	if err := store.Check(); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tFINGERPRINT\tLENGTH")
+	for _, key := range store.Keys(*prefix) {
+		value := store.Get(key)
+		fmt.Fprintf(w, "%s\t%s\t%d\n", key, fingerprint.Of(value), len(value))
+	}
+	return w.Flush()
+}
+
+// show the upstream calls of each credential in the last 24 hours, as saved
+// to the STORE_FILE by the server
+func quotaShow(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("quota show", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if os.Getenv("STORE_FILE") == "" {
+		return fmt.Errorf("STORE_FILE is not set")
+	}
+	if err := store.Check(); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tUSED\tLIMIT\tREMAINING")
+	for _, u := range quota.Usages() {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", u.Key, u.Used, u.Limit, u.Remaining)
+	}
+	return w.Flush()
+}
+
+// encrypt the values in the STORE_FILE again with the current master key,
+// after a new key is added, so that the old one can be removed. It must run
+// while the server is stopped, since the server would overwrite the file.
+func storeReencrypt(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("store reencrypt", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if os.Getenv("STORE_FILE") == "" {
+		return fmt.Errorf("STORE_FILE is not set")
+	}
+
+	n, err := store.Reencrypt()
+	if err != nil {
+		return err
+	}
+	versions := store.Versions()
+	names := make([]string, 0, len(versions))
+	for version := range versions {
+		names = append(names, version)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(stdout, "re-encrypted %d values\n", n)
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY VERSION\tVALUES")
+	for _, version := range names {
+		if version == "" {
+			fmt.Fprintf(w, "(plain)\t%d\n", versions[version])
+		} else {
+			fmt.Fprintf(w, "%s\t%d\n", version, versions[version])
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// get or rotate a credential of a running hub, the path is the one of the
+// api such as /access_token or /ticket?type=jsapi
+func token(action string, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("token "+action, flag.ContinueOnError)
+	hub := fs.String("hub", envOr("HUB_URL", "http://localhost:8567"), "the url of the hub, defaults to HUB_URL")
+	jwt := fs.String("jwt", os.Getenv("HUB_JWT"), "the JWT of the client, defaults to HUB_JWT")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: token %s [flags] <path>", action)
+	}
+
+	u, err := url.Parse(strings.TrimSuffix(*hub, "/") + fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	value, fp, err := getCredential(u, *jwt, "")
+	if err != nil {
+		return err
+	}
+
+	// ask the hub to rotate the value it just returned, by its fingerprint so
+	// that the value doesn't show up in the url
+	if action == "rotate" {
+		if fp == "" {
+			return fmt.Errorf("the hub returned no X-Credential-Fingerprint")
+		}
+		if value, _, err = getCredential(u, *jwt, fp); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(stdout, value)
+	return nil
+}
+
+// request the credential from the hub, rotating the one with the fingerprint
+// if set. Returns the credential and its fingerprint.
+func getCredential(u *url.URL, jwt string, rotateFingerprint string) (string, string, error) {
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	if rotateFingerprint != "" {
+		req.Header.Set("X-Rotate-Fingerprint", rotateFingerprint)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return string(body), resp.Header.Get("X-Credential-Fingerprint"), nil
+}
+
+// return the value of the env var, or def if it's not set
+func envOr(name string, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
@@ -1,5 +1,5 @@
 module github.com/waynecraig/wechat-token-hub
 
-go 1.19
+go 1.21
 
 require github.com/golang-jwt/jwt/v5 v5.0.0
@@ -0,0 +1,126 @@
+package audit
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/redact"
+)
+
+// the types of the events
+const (
+	// a credential was fetched from upstream
+	EventFetch = "fetch"
+	// a rotation of the cached credential was honored
+	EventRotate = "rotate"
+	// a rotation of the cached credential was refused by the quota or the rate limits
+	EventRotateRejected = "rotate_rejected"
+	// the cached credential was removed by an admin
+	EventEvict = "evict"
+	// a call to the WeChat API through the proxy was refused by the policy
+	EventProxyDenied = "proxy_denied"
+)
+
+// the number of recent events kept in memory for the admin api
+const recentSize = 1000
+
+// Event is one entry of the audit log. The credentials are identified by
+// their fingerprints, never by their values.
+type Event struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+	// the cache key of the credential
+	Key string `json:"key"`
+	// the client who asked for the credential, empty if the hub did it on its own
+	Principal string `json:"principal,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	// the fingerprints of the credential before and after the event
+	OldFingerprint string `json:"old_fingerprint,omitempty"`
+	NewFingerprint string `json:"new_fingerprint,omitempty"`
+	// the call to the WeChat API through the proxy
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+	// the error code returned by wechat, and the error if the event failed
+	ErrCode int    `json:"errcode,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Sink is where the events are written to, besides the recent events kept in memory
+type Sink interface {
+	Write(e Event) error
+}
+
+// Filter selects the recent events, the fields which are not set match any event
+type Filter struct {
+	Type      string
+	Key       string
+	Principal string
+	Since     time.Time
+	// the maximum number of events returned
+	Limit int
+}
+
+var (
+	mu     sync.Mutex
+	sink   Sink
+	recent []Event
+	// the index of the oldest event once recent is full
+	next int
+	now  = time.Now
+)
+
+// SetSink makes the events to be written to s, a nil sink only keeps the
+// recent events in memory
+func SetSink(s Sink) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	sink = s
+}
+
+// Record adds the event to the audit log, the time is set if it's missing
+func Record(e Event) {
+	if e.Time.IsZero() {
+		e.Time = now()
+	}
+	e.Error = redact.String(e.Error)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(recent) < recentSize {
+		recent = append(recent, e)
+	} else {
+		recent[next] = e
+		next = (next + 1) % recentSize
+	}
+
+	if sink != nil {
+		if err := sink.Write(e); err != nil {
+			slog.Error("write audit event fail", "error", err, "type", e.Type, "key", e.Key)
+		}
+	}
+}
+
+// Recent returns the recent events matching the filter, the newest first
+func Recent(f Filter) []Event {
+	mu.Lock()
+	defer mu.Unlock()
+
+	events := []Event{}
+	for i := len(recent) - 1; i >= 0; i-- {
+		e := recent[(next+i)%len(recent)]
+		if f.Limit > 0 && len(events) >= f.Limit {
+			break
+		}
+		if (f.Type != "" && e.Type != f.Type) ||
+			(f.Key != "" && e.Key != f.Key) ||
+			(f.Principal != "" && e.Principal != f.Principal) ||
+			e.Time.Before(f.Since) {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events
+}
@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type memorySink struct {
+	events []Event
+	err    error
+}
+
+func (s *memorySink) Write(e Event) error {
+	s.events = append(s.events, e)
+	return s.err
+}
+
+// forget the recorded events
+func reset() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	sink = nil
+	recent = nil
+	next = 0
+}
+
+func TestRecord(t *testing.T) {
+	defer reset()
+	reset()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return start }
+	defer func() { now = time.Now }()
+
+	s := &memorySink{}
+	SetSink(s)
+
+	Record(Event{Type: EventFetch, Key: "access_token", NewFingerprint: "fp1"})
+	Record(Event{Type: EventRotate, Key: "access_token", Principal: "client1", OldFingerprint: "fp1", NewFingerprint: "fp2"})
+	Record(Event{Type: EventRotateRejected, Key: "ticket_jsapi", Principal: "client2", Error: "rotate ticket_jsapi refused", Time: start.Add(time.Hour)})
+
+	if len(s.events) != 3 {
+		t.Fatalf("Expected 3 events written to the sink, got %d", len(s.events))
+	}
+	if !s.events[0].Time.Equal(start) {
+		t.Errorf("Expected the time to be set, got %v", s.events[0].Time)
+	}
+
+	testCases := []struct {
+		name     string
+		filter   Filter
+		expected []string
+	}{
+		{name: "All", filter: Filter{}, expected: []string{EventRotateRejected, EventRotate, EventFetch}},
+		{name: "Type", filter: Filter{Type: EventRotate}, expected: []string{EventRotate}},
+		{name: "Key", filter: Filter{Key: "access_token"}, expected: []string{EventRotate, EventFetch}},
+		{name: "Principal", filter: Filter{Principal: "client2"}, expected: []string{EventRotateRejected}},
+		{name: "Since", filter: Filter{Since: start.Add(time.Minute)}, expected: []string{EventRotateRejected}},
+		{name: "Limit", filter: Filter{Limit: 2}, expected: []string{EventRotateRejected, EventRotate}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			events := Recent(tc.filter)
+			var types []string
+			for _, e := range events {
+				types = append(types, e.Type)
+			}
+			if strings.Join(types, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("Recent() = %v, want %v", types, tc.expected)
+			}
+		})
+	}
+
+	// a failing sink doesn't lose the recent events
+	s.err = errors.New("disk full")
+	Record(Event{Type: EventFetch, Key: "ticket_jsapi"})
+	if events := Recent(Filter{Limit: 1}); len(events) != 1 || events[0].Key != "ticket_jsapi" {
+		t.Errorf("Expected the event to be kept, got %v", events)
+	}
+}
+
+func TestRecordRedactsErrors(t *testing.T) {
+	defer reset()
+	reset()
+
+	Record(Event{Type: EventFetch, Key: "access_token", Error: "Get https://api.weixin.qq.com/cgi-bin/token?secret=leaked_app_secret"})
+	if e := Recent(Filter{})[0]; strings.Contains(e.Error, "leaked_app_secret") {
+		t.Errorf("Expected the secret to be redacted, got %s", e.Error)
+	}
+}
+
+func TestRecentIsBounded(t *testing.T) {
+	defer reset()
+	reset()
+
+	for i := 0; i < recentSize+10; i++ {
+		Record(Event{Type: EventFetch, Key: "access_token", ErrCode: i})
+	}
+	events := Recent(Filter{})
+	if len(events) != recentSize {
+		t.Fatalf("Expected %d events, got %d", recentSize, len(events))
+	}
+	if events[0].ErrCode != recentSize+9 || events[len(events)-1].ErrCode != 10 {
+		t.Errorf("Expected the newest events to be kept, got %d to %d", events[len(events)-1].ErrCode, events[0].ErrCode)
+	}
+}
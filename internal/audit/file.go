@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// FileSink appends the events to a file as json lines. When the file grows
+// past the maximum size, it's renamed with the time as suffix and a new file
+// is started, the old files are never removed or changed.
+type FileSink struct {
+	path    string
+	maxSize int64
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewFileSink opens the file at path for appending, a maxSize of zero means
+// the file is never rotated
+func NewFileSink(path string, maxSize int64) (*FileSink, error) {
+	s := &FileSink{path: path, maxSize: maxSize}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Write appends the event to the file
+func (s *FileSink) Write(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(data)) > s.maxSize {
+		if err := s.rotate(e); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(data)
+	s.size += int64(n)
+	return err
+}
+
+// Close closes the file
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
+
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// move the full file aside, named after the time of the first event which
+// doesn't fit in it
+func (s *FileSink) rotate(e Event) error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	rotated := s.path + "." + e.Time.UTC().Format("20060102T150405.000000000")
+	renameErr := os.Rename(s.path, rotated)
+	// keep writing to the same file if it can't be moved
+	if err := s.open(); err != nil {
+		return err
+	}
+	return renameErr
+}
@@ -0,0 +1,79 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	s, err := NewFileSink(path, 300)
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	defer s.Close()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		e := Event{Time: start.Add(time.Duration(i) * time.Second), Type: EventRotate, Key: "access_token", Principal: "client1", OldFingerprint: "0123456789abcdef", NewFingerprint: "fedcba9876543210"}
+		if err := s.Write(e); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	// the file is rotated once it's full, and no event is lost
+	files, _ := filepath.Glob(path + "*")
+	if len(files) < 2 {
+		t.Fatalf("Expected the file to be rotated, got %v", files)
+	}
+	count := 0
+	for _, file := range files {
+		info, _ := os.Stat(file)
+		if info.Size() > 300 {
+			t.Errorf("Expected %s to be at most 300 bytes, got %d", file, info.Size())
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("Expected %s to be private, got %v", file, info.Mode().Perm())
+		}
+		count += countEvents(t, file)
+	}
+	if count != 4 {
+		t.Errorf("Expected 4 events in the files, got %d", count)
+	}
+
+	// events are appended to an existing file
+	s.Close()
+	before := countEvents(t, path)
+	s, err = NewFileSink(path, 0)
+	if err != nil {
+		t.Fatalf("NewFileSink() error = %v", err)
+	}
+	s.Write(Event{Time: start, Type: EventFetch, Key: "access_token"})
+	if after := countEvents(t, path); after != before+1 {
+		t.Errorf("Expected the event to be appended, got %d events after %d", after, before)
+	}
+}
+
+// count the json lines of the file
+func countEvents(t *testing.T, path string) int {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	count := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Errorf("Expected a json event, got %s", scanner.Text())
+		}
+		count++
+	}
+	return count
+}
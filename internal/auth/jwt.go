@@ -3,12 +3,61 @@ package auth
 import (
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// CheckKeys returns an error if no JWT_KEY_{kid} is set, no client could
+// be authenticated without one
+func CheckKeys() error {
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if strings.HasPrefix(name, "JWT_KEY_") && value != "" {
+			return nil
+		}
+	}
+	return fmt.Errorf("no JWT_KEY_{kid} is set")
+}
+
+// MintJwtToken signs a JWT for a client with the JWT_KEY_{kid} secret, the
+// scopes are joined into the scope claim. A ttl of zero means the token
+// never expires.
+func MintJwtToken(kid string, subject string, scopes []string, ttl time.Duration) (string, error) {
+	secret := os.Getenv("JWT_KEY_" + kid)
+	if secret == "" {
+		return "", fmt.Errorf("JWT_KEY_%s environment variable not set", kid)
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"aud": "wechat-token-hub",
+		"iat": now.Unix(),
+	}
+	if subject != "" {
+		claims["sub"] = subject
+	}
+	if len(scopes) > 0 {
+		claims["scope"] = strings.Join(scopes, " ")
+	}
+	if ttl != 0 {
+		claims["exp"] = now.Add(ttl).Unix()
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = kid
+	return token.SignedString([]byte(secret))
+}
+
 // a function that parses and validates a JWT token
 func VerifyJwtToken(tokenString string) error {
+	_, err := ParseJwtToken(tokenString)
+	return err
+}
+
+// ParseJwtToken validates a JWT token and returns the client it identifies
+func ParseJwtToken(tokenString string) (*Principal, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		// get key id from token header
 		kid, ok := token.Header["kid"].(string)
@@ -29,13 +78,55 @@ func VerifyJwtToken(tokenString string) error {
 		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}),
 	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// check if the token is valid
 	if !token.Valid {
-		return fmt.Errorf("invalid token")
+		return nil, fmt.Errorf("invalid token")
 	}
 
-	return nil
+	// the client is named by the subject, or by the key if there is no subject
+	kid := token.Header["kid"].(string)
+	subject, err := token.Claims.GetSubject()
+	if err != nil {
+		return nil, err
+	}
+	if subject == "" {
+		subject = kid
+	}
+
+	// the scope claim is a space separated string. The clients sign their
+	// own tokens, so a scope is only accepted if the key was granted it.
+	var scopes []string
+	if claims, ok := token.Claims.(jwt.MapClaims); ok {
+		if scope, ok := claims["scope"].(string); ok {
+			scopes = strings.Fields(scope)
+		}
+	}
+	granted := GrantedScopes(kid)
+	for _, scope := range scopes {
+		if !contains(granted, scope) {
+			return nil, fmt.Errorf("scope %s is not granted to the key %s", scope, kid)
+		}
+	}
+
+	return &Principal{Subject: subject, KeyID: kid, Scopes: scopes}, nil
+}
+
+// GrantedScopes returns the scopes the tokens signed with the key may claim,
+// set in JWT_SCOPES_{kid} as a space or comma separated list
+func GrantedScopes(kid string) []string {
+	return strings.FieldsFunc(os.Getenv("JWT_SCOPES_"+kid), func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
 }
@@ -184,3 +184,48 @@ func TestVerifyJwtToken(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckKeys(t *testing.T) {
+	if err := CheckKeys(); err == nil {
+		t.Errorf("CheckKeys() accepted no key")
+	}
+
+	os.Setenv("JWT_KEY_check", "check_jwt_key")
+	defer os.Unsetenv("JWT_KEY_check")
+	if err := CheckKeys(); err != nil {
+		t.Errorf("CheckKeys() error = %v", err)
+	}
+}
+
+func TestMintJwtToken(t *testing.T) {
+	if _, err := MintJwtToken("mint", "client1", nil, time.Hour); err == nil {
+		t.Errorf("MintJwtToken() accepted a missing key")
+	}
+
+	os.Setenv("JWT_KEY_mint", "mint_jwt_key")
+	os.Setenv("JWT_SCOPES_mint", "admin,read")
+	defer os.Unsetenv("JWT_KEY_mint")
+	defer os.Unsetenv("JWT_SCOPES_mint")
+
+	tokenString, err := MintJwtToken("mint", "client1", []string{"admin", "read"}, time.Hour)
+	if err != nil {
+		t.Fatalf("MintJwtToken() error = %v", err)
+	}
+	principal, err := ParseJwtToken(tokenString)
+	if err != nil {
+		t.Fatalf("ParseJwtToken() error = %v", err)
+	}
+	if principal.Subject != "client1" || principal.KeyID != "mint" || !principal.HasScope("admin") || !principal.HasScope("read") {
+		t.Errorf("Unexpected principal: %+v", principal)
+	}
+
+	// the token expires after the ttl, or never with a ttl of zero
+	expired, _ := MintJwtToken("mint", "client1", nil, -time.Minute)
+	if _, err := ParseJwtToken(expired); err == nil {
+		t.Errorf("ParseJwtToken() accepted an expired token")
+	}
+	forever, _ := MintJwtToken("mint", "client1", nil, 0)
+	if _, err := ParseJwtToken(forever); err != nil {
+		t.Errorf("ParseJwtToken() error = %v", err)
+	}
+}
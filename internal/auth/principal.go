@@ -0,0 +1,40 @@
+package auth
+
+import "context"
+
+// Principal is the client which made an authenticated request
+type Principal struct {
+	// the sub claim of the token, or the key id if the token has no subject
+	Subject string
+	// the key id used to sign the token
+	KeyID string
+	// the space separated scope claim of the token, such as "admin"
+	Scopes []string
+}
+
+// HasScope reports whether the principal is granted the scope
+func (p *Principal) HasScope(scope string) bool {
+	if p == nil {
+		return false
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx carrying the principal
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal of the request, or nil if the request
+// is not authenticated
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestParseJwtToken(t *testing.T) {
+	os.Setenv("JWT_KEY_key1", "secret1")
+	os.Setenv("JWT_SCOPES_key1", "read admin")
+	defer os.Unsetenv("JWT_KEY_key1")
+	defer os.Unsetenv("JWT_SCOPES_key1")
+
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		subject string
+		admin   bool
+	}{
+		{
+			name: "token with subject",
+			claims: jwt.MapClaims{
+				"aud": "wechat-token-hub",
+				"sub": "service-a",
+				"exp": time.Now().Add(time.Second * 300).Unix(),
+			},
+			subject: "service-a",
+		},
+		{
+			name: "token without subject",
+			claims: jwt.MapClaims{
+				"aud": "wechat-token-hub",
+				"exp": time.Now().Add(time.Second * 300).Unix(),
+			},
+			subject: "key1",
+		},
+		{
+			name: "token with scope",
+			claims: jwt.MapClaims{
+				"aud":   "wechat-token-hub",
+				"sub":   "operator",
+				"scope": "read admin",
+				"exp":   time.Now().Add(time.Second * 300).Unix(),
+			},
+			subject: "operator",
+			admin:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, tt.claims)
+			token.Header["kid"] = "key1"
+			tokenString, err := token.SignedString([]byte("secret1"))
+			if err != nil {
+				t.Fatalf("Error creating JWT token: %v", err)
+			}
+
+			p, err := ParseJwtToken(tokenString)
+			if err != nil {
+				t.Fatalf("ParseJwtToken() error = %v", err)
+			}
+			if p.Subject != tt.subject || p.KeyID != "key1" {
+				t.Errorf("ParseJwtToken() = %+v, want subject %s and key id key1", p, tt.subject)
+			}
+			if p.HasScope("admin") != tt.admin {
+				t.Errorf("HasScope(admin) = %v, want %v", p.HasScope("admin"), tt.admin)
+			}
+		})
+	}
+}
+
+func TestParseJwtTokenScopeNotGranted(t *testing.T) {
+	os.Setenv("JWT_KEY_key2", "secret2")
+	os.Setenv("JWT_SCOPES_key2", "read")
+	defer os.Unsetenv("JWT_KEY_key2")
+	defer os.Unsetenv("JWT_SCOPES_key2")
+
+	// the client signs its own token, so it can't grant itself the admin scope
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"aud":   "wechat-token-hub",
+		"scope": "read admin",
+	})
+	token.Header["kid"] = "key2"
+	tokenString, err := token.SignedString([]byte("secret2"))
+	if err != nil {
+		t.Fatalf("Error creating JWT token: %v", err)
+	}
+	if p, err := ParseJwtToken(tokenString); err == nil {
+		t.Errorf("ParseJwtToken() = %+v, want the scope not granted refused", p)
+	}
+}
+
+func TestPrincipalContext(t *testing.T) {
+	ctx := context.Background()
+	if p := FromContext(ctx); p != nil {
+		t.Errorf("FromContext() = %+v, want nil", p)
+	}
+
+	ctx = NewContext(ctx, &Principal{Subject: "service-a"})
+	if p := FromContext(ctx); p == nil || p.Subject != "service-a" {
+		t.Errorf("FromContext() = %+v, want service-a", p)
+	}
+}
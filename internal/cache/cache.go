@@ -1,20 +1,30 @@
 package cache
 
-import "time"
+import (
+	"sync"
+	"time"
+)
 
 type cacheItem struct {
 	Type       string
 	Value      string
 	Expiration time.Time
+	Created    time.Time
 }
 
-var cache map[string]*cacheItem
+var (
+	mu    sync.RWMutex
+	cache map[string]*cacheItem
+)
 
 func init() {
 	cache = make(map[string]*cacheItem)
 }
 
 func GetCacheItem(itemType string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+
 	// check if the cache item is expired
 	if cache[itemType] != nil && cache[itemType].Expiration.After(time.Now()) {
 		// return the cache item
@@ -25,18 +35,69 @@ func GetCacheItem(itemType string) string {
 	return ""
 }
 
+// GetCacheItemExpiration returns the expiration time of the cache item, or
+// the zero time if it's not set
+func GetCacheItemExpiration(itemType string) time.Time {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if cache[itemType] == nil {
+		return time.Time{}
+	}
+	return cache[itemType].Expiration
+}
+
+// GetCacheItemCreation returns the time the cache item was saved, or the zero
+// time if it's not set
+func GetCacheItemCreation(itemType string) time.Time {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if cache[itemType] == nil {
+		return time.Time{}
+	}
+	return cache[itemType].Created
+}
+
 func SaveCacheItem(itemType string, value string, expiresIn int) {
 	if expiresIn <= 0 {
 		return
 	}
 
 	// calculate the expiration time
-	expiration := time.Now().Add(time.Duration(expiresIn) * time.Second)
+	now := time.Now()
+	expiration := now.Add(time.Duration(expiresIn) * time.Second)
+
+	mu.Lock()
+	defer mu.Unlock()
 
 	// set the cache item to the new value and its expiration time
 	cache[itemType] = &cacheItem{
 		Type:       itemType,
 		Value:      value,
 		Expiration: expiration,
+		Created:    now,
+	}
+}
+
+// Expirations returns the expiration time of every cache item which is not expired
+func Expirations() map[string]time.Time {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	expirations := make(map[string]time.Time)
+	for itemType, item := range cache {
+		if item.Expiration.After(time.Now()) {
+			expirations[itemType] = item.Expiration
+		}
 	}
+	return expirations
+}
+
+// DeleteCacheItem removes the cache item
+func DeleteCacheItem(itemType string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	delete(cache, itemType)
 }
@@ -50,3 +50,57 @@ func TestSaveCacheItem(t *testing.T) {
 		t.Errorf("SaveCacheItem saved cache item with negative expiration time")
 	}
 }
+
+func TestGetCacheItemExpiration(t *testing.T) {
+	// test getting the expiration of a non-existent cache item
+	if result := GetCacheItemExpiration("nonexistent"); !result.IsZero() {
+		t.Errorf("GetCacheItemExpiration returned %v, expected zero time", result)
+	}
+
+	// test getting the expiration of a saved cache item
+	SaveCacheItem("expiration", "value", 3600)
+	result := GetCacheItemExpiration("expiration")
+	if result.Before(time.Now().Add(3599*time.Second)) || result.After(time.Now().Add(3600*time.Second)) {
+		t.Errorf("GetCacheItemExpiration returned %v, expected about one hour later", result)
+	}
+}
+
+func TestDeleteCacheItem(t *testing.T) {
+	// test deleting a saved cache item
+	SaveCacheItem("delete", "value", 3600)
+	DeleteCacheItem("delete")
+	if result := GetCacheItem("delete"); result != "" {
+		t.Errorf("GetCacheItem returned %s after delete, expected empty string", result)
+	}
+}
+
+func TestExpirations(t *testing.T) {
+	SaveCacheItem("valid", "value", 3600)
+	cache["outdated"] = &cacheItem{
+		Type:       "outdated",
+		Value:      "value",
+		Expiration: time.Now().Add(time.Duration(-1) * time.Hour),
+	}
+
+	expirations := Expirations()
+	if _, ok := expirations["valid"]; !ok {
+		t.Errorf("Expirations did not return the valid cache item")
+	}
+	if _, ok := expirations["outdated"]; ok {
+		t.Errorf("Expirations returned an expired cache item")
+	}
+}
+
+func TestGetCacheItemCreation(t *testing.T) {
+	// test getting the creation of a non-existent cache item
+	if result := GetCacheItemCreation("nonexistent"); !result.IsZero() {
+		t.Errorf("GetCacheItemCreation returned %v, expected zero time", result)
+	}
+
+	// test getting the creation of a saved cache item
+	before := time.Now()
+	SaveCacheItem("creation", "value", 3600)
+	if result := GetCacheItemCreation("creation"); result.Before(before) || result.After(time.Now()) {
+		t.Errorf("GetCacheItemCreation returned %v, expected now", result)
+	}
+}
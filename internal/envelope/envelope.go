@@ -0,0 +1,227 @@
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// the prefix and format version of the encrypted values, which are
+// enc:v1:{key version}:{wrapped data key}:{nonce and ciphertext}
+const prefix = "enc:v1:"
+
+// KeyProvider wraps and unwraps the data keys with the master keys, like a
+// KMS, so that the master keys never need to leave it
+type KeyProvider interface {
+	// Wrap encrypts the data key with the current master key, and returns
+	// the version of the master key
+	Wrap(dataKey []byte) (version string, wrapped []byte, err error)
+	// Unwrap decrypts the data key wrapped with the master key of the version
+	Unwrap(version string, wrapped []byte) ([]byte, error)
+}
+
+// ErrNoKey is returned when an encrypted value is read without a master key
+var ErrNoKey = errors.New("no master key, set MASTER_KEY_FILE or MASTER_KEY")
+
+// the provider set by SetProvider, or else loaded from the env
+var (
+	mu          sync.Mutex
+	provider    KeyProvider
+	envProvider KeyProvider
+	loadedEnv   string
+)
+
+// SetProvider sets the provider of the master keys, such as a KMS. If it's
+// nil, the local keys in MASTER_KEY_FILE or MASTER_KEY are used.
+func SetProvider(p KeyProvider) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	provider = p
+}
+
+// Enabled reports whether a master key is configured, so that the values are
+// encrypted
+func Enabled() (bool, error) {
+	p, err := current()
+	return p != nil, err
+}
+
+// Check returns an error if the master keys can't be loaded
+func Check() error {
+	_, err := current()
+	return err
+}
+
+// Encrypt encrypts the value with a new data key wrapped by the master key,
+// the name is authenticated so that the value can't be moved to another name.
+// Without a master key the value is returned as is.
+func Encrypt(name string, value string) (string, error) {
+	p, err := current()
+	if err != nil || p == nil {
+		return value, err
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	version, wrapped, err := p.Wrap(dataKey)
+	if err != nil {
+		return "", fmt.Errorf("wrap data key fail: %w", err)
+	}
+	if version == "" || strings.Contains(version, ":") {
+		return "", fmt.Errorf("invalid key version %q", version)
+	}
+	sealed, err := seal(dataKey, []byte(value), []byte(name))
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + version + ":" + base64.StdEncoding.EncodeToString(wrapped) + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts the value encrypted under the name, the values which are
+// not encrypted are returned as is
+func Decrypt(name string, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("invalid encrypted value of %s", name)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value of %s: %w", name, err)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value of %s: %w", name, err)
+	}
+
+	p, err := current()
+	if err != nil {
+		return "", err
+	}
+	if p == nil {
+		return "", ErrNoKey
+	}
+	dataKey, err := p.Unwrap(parts[0], wrapped)
+	if err != nil {
+		return "", fmt.Errorf("unwrap data key of %s fail: %w", name, err)
+	}
+	plaintext, err := open(dataKey, sealed, []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("decrypt %s fail: %w", name, err)
+	}
+	return string(plaintext), nil
+}
+
+// IsEncrypted reports whether the value was encrypted by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Version returns the version of the master key of the encrypted value, or
+// an empty string if it's not encrypted
+func Version(value string) string {
+	if !IsEncrypted(value) {
+		return ""
+	}
+	version, _, _ := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	return version
+}
+
+// DecryptEnv replaces the values of the env vars which are encrypted, such
+// as APPSECRET=enc:v1:..., with their plaintext. The name of the env var is
+// the name the value was encrypted under.
+func DecryptEnv() error {
+	var errs []error
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if !IsEncrypted(value) {
+			continue
+		}
+		plaintext, err := Decrypt(name, value)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		os.Setenv(name, plaintext)
+	}
+	return errors.Join(errs...)
+}
+
+// the provider set by SetProvider, or the local keys of the env, reloaded
+// when the env changes. nil means no master key.
+func current() (KeyProvider, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if provider != nil {
+		return provider, nil
+	}
+
+	file, keys := os.Getenv("MASTER_KEY_FILE"), os.Getenv("MASTER_KEY")
+	env := file + "\n" + keys
+	if env == loadedEnv {
+		return envProvider, nil
+	}
+
+	var p *LocalKeyProvider
+	var err error
+	switch {
+	case file != "":
+		p, err = LoadKeyFile(file)
+	case keys != "":
+		p, err = ParseKeys(keys)
+	}
+	if err != nil {
+		return nil, err
+	}
+	envProvider, loadedEnv = nil, env
+	if p != nil {
+		envProvider = p
+	}
+	return envProvider, nil
+}
+
+// encrypt the plaintext with AES-GCM, the nonce is prepended
+func seal(key []byte, plaintext []byte, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// decrypt the output of seal
+func open(key []byte, sealed []byte, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid ciphertext length %d", len(sealed))
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
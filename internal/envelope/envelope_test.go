@@ -0,0 +1,155 @@
+package envelope
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testKey1 = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	testKey2 = "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	// without a master key the values are kept as is
+	if value, err := Encrypt("name", "secret value"); err != nil || value != "secret value" {
+		t.Errorf("Encrypt() = %s, %v, want the plaintext", value, err)
+	}
+
+	os.Setenv("MASTER_KEY", "v1="+testKey1)
+	defer os.Unsetenv("MASTER_KEY")
+
+	encrypted, err := Encrypt("name", "secret value")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if !IsEncrypted(encrypted) || Version(encrypted) != "v1" || strings.Contains(encrypted, "secret value") {
+		t.Fatalf("Encrypt() = %s, want a value encrypted with v1", encrypted)
+	}
+	if value, err := Decrypt("name", encrypted); err != nil || value != "secret value" {
+		t.Errorf("Decrypt() = %s, %v", value, err)
+	}
+	if value, err := Decrypt("name", "plain value"); err != nil || value != "plain value" {
+		t.Errorf("Decrypt() = %s, %v, want the plain value as is", value, err)
+	}
+
+	// the value can't be moved to another name
+	if _, err := Decrypt("other", encrypted); err == nil {
+		t.Errorf("Decrypt() accepted a value encrypted under another name")
+	}
+
+	// a new key is used for the new values, the old one still decrypts
+	os.Setenv("MASTER_KEY", "v1="+testKey1+",v2="+testKey2)
+	if value, err := Decrypt("name", encrypted); err != nil || value != "secret value" {
+		t.Errorf("Decrypt() = %s, %v with the old key", value, err)
+	}
+	if reencrypted, _ := Encrypt("name", "secret value"); Version(reencrypted) != "v2" {
+		t.Errorf("Encrypt() = %s, want a value encrypted with v2", reencrypted)
+	}
+
+	// once the old key is removed, its values can't be read
+	os.Setenv("MASTER_KEY", "v2="+testKey2)
+	if _, err := Decrypt("name", encrypted); err == nil {
+		t.Errorf("Decrypt() accepted a value of a removed key")
+	}
+	os.Unsetenv("MASTER_KEY")
+	if _, err := Decrypt("name", encrypted); !errors.Is(err, ErrNoKey) {
+		t.Errorf("Decrypt() error = %v, want ErrNoKey", err)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		current string
+		wantErr bool
+	}{
+		{name: "One key", text: "v1=" + testKey1, current: "v1"},
+		{name: "Lines", text: "# rotated on 2024-01-01\nv1=" + testKey1 + "\nv2=" + testKey2 + "\n", current: "v2"},
+		{name: "Empty", text: "", wantErr: true},
+		{name: "No version", text: testKey1, wantErr: true},
+		{name: "Short key", text: "v1=c2hvcnQ=", wantErr: true},
+		{name: "Duplicate", text: "v1=" + testKey1 + ",v1=" + testKey2, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParseKeys(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && p.Current() != tt.current {
+				t.Errorf("Current() = %s, want %s", p.Current(), tt.current)
+			}
+		})
+	}
+}
+
+func TestKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "master.keys")
+	os.WriteFile(path, []byte("v1="+testKey1+"\n"), 0600)
+	os.Setenv("MASTER_KEY_FILE", path)
+	defer os.Unsetenv("MASTER_KEY_FILE")
+
+	if enabled, err := Enabled(); !enabled || err != nil {
+		t.Errorf("Enabled() = %v, %v", enabled, err)
+	}
+
+	os.Setenv("MASTER_KEY_FILE", filepath.Join(t.TempDir(), "missing"))
+	if err := Check(); err == nil {
+		t.Errorf("Check() accepted a missing key file")
+	}
+}
+
+func TestDecryptEnv(t *testing.T) {
+	os.Setenv("MASTER_KEY", "v1="+testKey1)
+	defer os.Unsetenv("MASTER_KEY")
+
+	encrypted, _ := Encrypt("APPSECRET_wxenv", "env_app_secret")
+	os.Setenv("APPSECRET_wxenv", encrypted)
+	defer os.Unsetenv("APPSECRET_wxenv")
+
+	if err := DecryptEnv(); err != nil {
+		t.Fatalf("DecryptEnv() error = %v", err)
+	}
+	if value := os.Getenv("APPSECRET_wxenv"); value != "env_app_secret" {
+		t.Errorf("APPSECRET_wxenv = %s, want the plaintext", value)
+	}
+
+	// the value of another env var is refused
+	os.Setenv("APPSECRET_wxother", encrypted)
+	defer os.Unsetenv("APPSECRET_wxother")
+	if err := DecryptEnv(); err == nil {
+		t.Errorf("DecryptEnv() accepted the value of another env var")
+	}
+}
+
+type testProvider struct {
+	wrapped int
+}
+
+func (p *testProvider) Wrap(dataKey []byte) (string, []byte, error) {
+	p.wrapped++
+	return "kms", append([]byte("wrapped:"), dataKey...), nil
+}
+
+func (p *testProvider) Unwrap(version string, wrapped []byte) ([]byte, error) {
+	return []byte(strings.TrimPrefix(string(wrapped), "wrapped:")), nil
+}
+
+func TestSetProvider(t *testing.T) {
+	p := &testProvider{}
+	SetProvider(p)
+	defer SetProvider(nil)
+
+	encrypted, err := Encrypt("name", "value")
+	if err != nil || Version(encrypted) != "kms" || p.wrapped != 1 {
+		t.Fatalf("Encrypt() = %s, %v, want a value wrapped by the provider", encrypted, err)
+	}
+	if value, err := Decrypt("name", encrypted); err != nil || value != "value" {
+		t.Errorf("Decrypt() = %s, %v", value, err)
+	}
+}
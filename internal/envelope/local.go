@@ -0,0 +1,78 @@
+package envelope
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LocalKeyProvider wraps the data keys with master keys held in memory. The
+// keys are versioned, the last one is used to wrap the new data keys, and the
+// older ones are kept to unwrap the values until they are re-encrypted.
+type LocalKeyProvider struct {
+	keys    map[string][]byte
+	current string
+}
+
+// ParseKeys parses the master keys written as {version}={base64 key}, one per
+// line or separated by commas, such as v1=...,v2=... The keys are 16, 24 or
+// 32 bytes, and the last one is the current key.
+func ParseKeys(text string) (*LocalKeyProvider, error) {
+	p := &LocalKeyProvider{keys: make(map[string][]byte)}
+	for _, entry := range strings.FieldsFunc(text, func(r rune) bool { return r == '\n' || r == ',' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		version, encoded, ok := strings.Cut(entry, "=")
+		version = strings.TrimSpace(version)
+		if !ok || version == "" || strings.Contains(version, ":") {
+			return nil, fmt.Errorf("invalid master key %q, want {version}={base64 key}", version)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("invalid master key %s: %w", version, err)
+		}
+		if len(key) != 16 && len(key) != 24 && len(key) != 32 {
+			return nil, fmt.Errorf("invalid master key %s: must be 16, 24 or 32 bytes", version)
+		}
+		if _, ok := p.keys[version]; ok {
+			return nil, fmt.Errorf("duplicate master key %s", version)
+		}
+		p.keys[version] = key
+		p.current = version
+	}
+	if p.current == "" {
+		return nil, fmt.Errorf("no master key")
+	}
+	return p, nil
+}
+
+// LoadKeyFile reads the master keys from the file, written like ParseKeys
+// with one key per line
+func LoadKeyFile(path string) (*LocalKeyProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read master key file fail: %w", err)
+	}
+	return ParseKeys(string(data))
+}
+
+// Current returns the version of the key wrapping the new data keys
+func (p *LocalKeyProvider) Current() string {
+	return p.current
+}
+
+func (p *LocalKeyProvider) Wrap(dataKey []byte) (string, []byte, error) {
+	wrapped, err := seal(p.keys[p.current], dataKey, []byte(p.current))
+	return p.current, wrapped, err
+}
+
+func (p *LocalKeyProvider) Unwrap(version string, wrapped []byte) ([]byte, error) {
+	key, ok := p.keys[version]
+	if !ok {
+		return nil, fmt.Errorf("unknown master key version %s", version)
+	}
+	return open(key, wrapped, []byte(version))
+}
@@ -0,0 +1,101 @@
+package events
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// the types of the events
+const (
+	// a credential was replaced by a new one, the old one may be rejected
+	TypeCredentialRotated = "credential.rotated"
+)
+
+// the number of recent events kept, replayed to the subscribers reconnecting
+// with the id of the last event they saw
+const recentSize = 100
+
+// the events buffered for each subscriber, a subscriber which doesn't keep
+// up loses the new events
+const bufferSize = 16
+
+// Event is a notification sent to the subscribers, it never carries the
+// credential itself, only its fingerprint
+type Event struct {
+	ID             string    `json:"id"`
+	Type           string    `json:"type"`
+	Time           time.Time `json:"time"`
+	Key            string    `json:"key"`
+	Source         string    `json:"source"`
+	AppID          string    `json:"appid,omitempty"`
+	Agent          string    `json:"agent,omitempty"`
+	CredentialType string    `json:"credential_type"`
+	Fingerprint    string    `json:"fingerprint"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	// the client which asked for the rotation, empty if the hub refreshed it
+	Principal string `json:"principal,omitempty"`
+}
+
+var (
+	mu          sync.Mutex
+	lastID      int64
+	recent      []Event
+	subscribers = make(map[chan Event]bool)
+)
+
+// Publish sends the event to the subscribers, with a new id and the time
+func Publish(e Event) Event {
+	mu.Lock()
+	defer mu.Unlock()
+
+	lastID++
+	e.ID = strconv.FormatInt(lastID, 10)
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	recent = append(recent, e)
+	if len(recent) > recentSize {
+		recent = recent[len(recent)-recentSize:]
+	}
+	for ch := range subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+	return e
+}
+
+// Subscribe returns the channel of the new events, and the function to call
+// to stop receiving them. With the id of the last event seen, the recent
+// events published after it are sent first.
+func Subscribe(lastEventID string) (<-chan Event, func()) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var missed []Event
+	if after, err := strconv.ParseInt(lastEventID, 10, 64); err == nil {
+		for _, e := range recent {
+			if id, _ := strconv.ParseInt(e.ID, 10, 64); id > after {
+				missed = append(missed, e)
+			}
+		}
+	}
+
+	ch := make(chan Event, bufferSize+len(missed))
+	for _, e := range missed {
+		ch <- e
+	}
+	subscribers[ch] = true
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			mu.Lock()
+			defer mu.Unlock()
+			delete(subscribers, ch)
+		})
+	}
+}
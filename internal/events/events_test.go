@@ -0,0 +1,50 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPublishSubscribe(t *testing.T) {
+	events, unsubscribe := Subscribe("")
+	defer unsubscribe()
+
+	first := Publish(Event{Type: TypeCredentialRotated, Key: "access_token_wx1"})
+	select {
+	case e := <-events:
+		if e.ID != first.ID || e.Key != "access_token_wx1" || e.Time.IsZero() {
+			t.Errorf("Unexpected event: %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the published event")
+	}
+
+	// a subscriber reconnecting gets the events it missed
+	Publish(Event{Type: TypeCredentialRotated, Key: "access_token_wx2"})
+	replayed, unsubscribeReplayed := Subscribe(first.ID)
+	defer unsubscribeReplayed()
+	select {
+	case e := <-replayed:
+		if e.Key != "access_token_wx2" {
+			t.Errorf("Expected the missed event, got %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the missed event")
+	}
+
+	// the unsubscribed channels get no more events
+	unsubscribe()
+	unsubscribe()
+	<-events
+	Publish(Event{Type: TypeCredentialRotated, Key: "access_token_wx3"})
+	select {
+	case e := <-events:
+		t.Errorf("Unexpected event after unsubscribe: %+v", e)
+	default:
+	}
+
+	// a slow subscriber doesn't block the publisher
+	for i := 0; i < bufferSize*2; i++ {
+		Publish(Event{Type: TypeCredentialRotated})
+	}
+}
@@ -0,0 +1,126 @@
+package events
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/redact"
+)
+
+// the attempts to deliver an event to a webhook, with the delay doubled after
+// each failure
+const webhookAttempts = 3
+
+var webhookRetryDelay = time.Second
+
+// Sign returns the signature of the webhook body sent at timestamp, which is
+// the hex HMAC-SHA256 of "{timestamp}.{body}" keyed with the secret
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// StartWebhooks posts every event to each url, signed with the secret, until
+// stop is called. Each url has its own queue, so that a slow one doesn't hold
+// back the others.
+func StartWebhooks(urls []string, secret string, client *http.Client) (stop func()) {
+	events, unsubscribe := Subscribe("")
+	done := make(chan struct{})
+
+	queues := make([]chan Event, len(urls))
+	for i, url := range urls {
+		queues[i] = make(chan Event, bufferSize)
+		go func(url string, queue chan Event) {
+			for {
+				select {
+				case e := <-queue:
+					deliver(client, url, secret, e, done)
+				case <-done:
+					return
+				}
+			}
+		}(url, queues[i])
+	}
+
+	go func() {
+		for {
+			select {
+			case e := <-events:
+				for i, queue := range queues {
+					select {
+					case queue <- e:
+					default:
+						slog.Warn("webhook queue full, event dropped", "url", redact.String(urls[i]), "event", e.ID)
+					}
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		unsubscribe()
+		close(done)
+	}
+}
+
+// post the event to the url, retrying the failures
+func deliver(client *http.Client, url string, secret string, e Event, done chan struct{}) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("encode event fail", "error", err)
+		return
+	}
+
+	delay := webhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := post(client, url, secret, e, body)
+		if err == nil {
+			return
+		}
+		if attempt == webhookAttempts {
+			slog.Error("deliver webhook fail", "url", redact.String(url), "event", e.ID, "type", e.Type, "error", err)
+			return
+		}
+		select {
+		case <-time.After(delay):
+		case <-done:
+			return
+		}
+		delay *= 2
+	}
+}
+
+func post(client *http.Client, url string, secret string, e Event, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Hub-Event", e.Type)
+	req.Header.Set("X-Hub-Event-ID", e.ID)
+	req.Header.Set("X-Hub-Timestamp", timestamp)
+	req.Header.Set("X-Hub-Signature", "sha256="+Sign(secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
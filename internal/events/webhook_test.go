@@ -0,0 +1,65 @@
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhooks(t *testing.T) {
+	webhookRetryDelay = time.Millisecond
+	defer func() { webhookRetryDelay = time.Second }()
+
+	// the receiver fails once, then checks the signature
+	received := make(chan Event, 1)
+	var calls int
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		signature := strings.TrimPrefix(r.Header.Get("X-Hub-Signature"), "sha256=")
+		if signature != Sign("webhook_secret", r.Header.Get("X-Hub-Timestamp"), body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var e Event
+		json.Unmarshal(body, &e)
+		if r.Header.Get("X-Hub-Event") != e.Type || r.Header.Get("X-Hub-Event-ID") != e.ID {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- e
+	}))
+	defer receiver.Close()
+
+	stop := StartWebhooks([]string{receiver.URL}, "webhook_secret", receiver.Client())
+	defer stop()
+
+	published := Publish(Event{Type: TypeCredentialRotated, Key: "access_token_webhook", Fingerprint: "0123456789abcdef"})
+	select {
+	case e := <-received:
+		if e.ID != published.ID || e.Key != "access_token_webhook" || e.Fingerprint != "0123456789abcdef" {
+			t.Errorf("Unexpected event: %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the event to be delivered after a retry")
+	}
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"type":"credential.rotated"}`)
+	signature := Sign("secret", "1700000000", body)
+	if len(signature) != 64 {
+		t.Errorf("Sign() = %s, want a hex sha256", signature)
+	}
+	if Sign("secret", "1700000001", body) == signature || Sign("other", "1700000000", body) == signature {
+		t.Errorf("Expected the signature to depend on the timestamp and the secret")
+	}
+}
@@ -0,0 +1,73 @@
+package fingerprint
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/waynecraig/wechat-token-hub/internal/store"
+)
+
+// the number of hex digits kept, enough to tell the credentials apart
+const length = 16
+
+// the key of the generated fingerprint key in the store
+const storeKey = "fingerprint_key"
+
+// the key generated when FINGERPRINT_KEY is not set
+var (
+	mu        sync.Mutex
+	generated []byte
+)
+
+// Of returns a short HMAC identifying the value without revealing it, or an
+// empty string for an empty value. The HMAC is keyed with FINGERPRINT_KEY, so
+// that the fingerprints can't be checked against guesses.
+func Of(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, key())
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))[:length]
+}
+
+// the FINGERPRINT_KEY, or else a random key generated once and kept in the
+// store, so that the fingerprints survive a restart and are shared by the
+// instances sharing the STORE_FILE
+func key() []byte {
+	if key := os.Getenv("FINGERPRINT_KEY"); key != "" {
+		return []byte(key)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if generated != nil {
+		return generated
+	}
+	if stored, err := hex.DecodeString(store.Get(storeKey)); err == nil && len(stored) > 0 {
+		generated = stored
+		return generated
+	}
+
+	generated = make([]byte, 32)
+	if _, err := rand.Read(generated); err != nil {
+		panic(err)
+	}
+	// a stored key which can't be read, such as with another master key, is
+	// not replaced
+	if len(store.Keys(storeKey)) > 0 {
+		slog.Error("read fingerprint key fail, the fingerprints will change after a restart")
+		return generated
+	}
+	if err := store.Save(storeKey, hex.EncodeToString(generated)); err != nil {
+		slog.Error("save fingerprint key fail, the fingerprints will change after a restart", "error", err)
+	}
+	return generated
+}
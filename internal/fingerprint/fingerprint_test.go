@@ -0,0 +1,67 @@
+package fingerprint
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/waynecraig/wechat-token-hub/internal/store"
+)
+
+func TestOf(t *testing.T) {
+	if fp := Of(""); fp != "" {
+		t.Errorf("Of(\"\") = %q, want empty", fp)
+	}
+
+	os.Setenv("FINGERPRINT_KEY", "test_fingerprint_key")
+	defer os.Unsetenv("FINGERPRINT_KEY")
+
+	fp := Of("test_access_token")
+	if len(fp) != length || strings.Contains(fp, "test_access_token") {
+		t.Errorf("Of() = %q, want a %d digit hash", fp, length)
+	}
+	if Of("test_access_token") != fp {
+		t.Errorf("Of() is not stable")
+	}
+	if Of("other_access_token") == fp {
+		t.Errorf("Of() returned the same fingerprint for different values")
+	}
+
+	// the fingerprint is always keyed, never a plain hash
+	os.Unsetenv("FINGERPRINT_KEY")
+	sum := sha256.Sum256([]byte("test_access_token"))
+	if generated := Of("test_access_token"); generated == fp || generated == hex.EncodeToString(sum[:])[:length] || len(generated) != length {
+		t.Errorf("Of() without a key = %q, want a different %d digit hmac", generated, length)
+	}
+}
+
+func TestGeneratedKey(t *testing.T) {
+	os.Setenv("STORE_FILE", filepath.Join(t.TempDir(), "store.json"))
+	defer os.Unsetenv("STORE_FILE")
+	mu.Lock()
+	generated = nil
+	mu.Unlock()
+
+	// the generated key is kept in the store, and used again after a restart
+	fp := Of("test_access_token")
+	stored, err := hex.DecodeString(store.Get(storeKey))
+	if err != nil || len(stored) != 32 {
+		t.Fatalf("Expected the generated key in the store, got %x, %v", stored, err)
+	}
+	mac := hmac.New(sha256.New, stored)
+	mac.Write([]byte("test_access_token"))
+	if want := hex.EncodeToString(mac.Sum(nil))[:length]; fp != want {
+		t.Errorf("Of() = %q, want %q with the stored key", fp, want)
+	}
+
+	mu.Lock()
+	generated = nil
+	mu.Unlock()
+	if Of("test_access_token") != fp {
+		t.Errorf("Of() changed after a restart")
+	}
+}
@@ -1,22 +1,113 @@
 package handler
 
 import (
+	"encoding/json"
+	"errors"
+	"mime"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/waynecraig/wechat-token-hub/internal/cache"
+	"github.com/waynecraig/wechat-token-hub/internal/fingerprint"
 	"github.com/waynecraig/wechat-token-hub/internal/tokens"
 )
 
+// the longest a client may wait for a newer credential, and the default
+const (
+	maxWait     = 60 * time.Second
+	defaultWait = 30 * time.Second
+)
+
+// the errors of the requests the client should fix
+var (
+	errInvalidWait = errors.New("invalid wait, expected a duration such as 30s, at most 60s")
+	errInvalidBody = errors.New("invalid body, expected rotate_fingerprint as json or a form")
+)
+
 // AccessToken handles requests to the /access_token path
 func AccessToken(w http.ResponseWriter, r *http.Request) {
-	rotateToken := r.URL.Query().Get("rotate_token")
-	accessToken, err := tokens.GetAccessToken(rotateToken)
+	query := r.URL.Query()
+	appid := query.Get("appid")
+	rotateToken := query.Get("rotate_token")
+	p := tokens.AccessTokenProvider(appid)
+	accessToken, err := getCredential(w, r, p, rotateToken)
 	if err != nil {
 		// return error if get access token fail
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
+		writeError(w, err)
 		return
 	}
 	// return the access token
+	writeCredential(w, p.Key(), accessToken)
+}
+
+// get the credential of the provider, rotating the one the client holds,
+// given by the rotate query or by its fingerprint in the X-Rotate-Fingerprint
+// header or the rotate_fingerprint of a POST body. With the newer_than query,
+// the fingerprint of the credential the client holds, wait until the
+// credential differs from it.
+func getCredential(w http.ResponseWriter, r *http.Request, p tokens.Provider, rotate string) (string, error) {
+	query := r.URL.Query()
+	if newerThan := query.Get("newer_than"); newerThan != "" {
+		wait := defaultWait
+		if s := query.Get("wait"); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil || d < 0 || d > maxWait {
+				return "", errInvalidWait
+			}
+			wait = d
+		}
+		return tokens.GetNewer(r.Context(), p, newerThan, wait)
+	}
+
+	rotateFingerprint, err := rotateFingerprintOf(w, r)
+	if err != nil {
+		return "", err
+	}
+	if rotateFingerprint != "" {
+		return tokens.GetByFingerprint(r.Context(), p, rotateFingerprint)
+	}
+	return tokens.GetContext(r.Context(), p, rotate)
+}
+
+// the fingerprint of the credential to rotate, from the header or the POST
+// body, as json or a form
+func rotateFingerprintOf(w http.ResponseWriter, r *http.Request) (string, error) {
+	if fp := r.Header.Get("X-Rotate-Fingerprint"); fp != "" {
+		return fp, nil
+	}
+	if r.Method != http.MethodPost {
+		return "", nil
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		var body struct {
+			RotateFingerprint string `json:"rotate_fingerprint"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return "", errInvalidBody
+		}
+		return body.RotateFingerprint, nil
+	}
+	if err := r.ParseForm(); err != nil {
+		return "", errInvalidBody
+	}
+	return r.PostForm.Get("rotate_fingerprint"), nil
+}
+
+// write the credential to the response, with the seconds until it expires in
+// the X-Expires-In header so that clients can cache it, and its fingerprint in
+// the X-Credential-Fingerprint header to wait for a newer one
+func writeCredential(w http.ResponseWriter, key string, value string) {
+	w.Header().Set("X-Credential-Fingerprint", fingerprint.Of(value))
+	// the credential may have been rotated by another request in the meantime
+	if cache.GetCacheItem(key) == value {
+		if expiresIn := int(time.Until(cache.GetCacheItemExpiration(key)).Seconds()); expiresIn > 0 {
+			w.Header().Set("X-Expires-In", strconv.Itoa(expiresIn))
+		}
+	}
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(accessToken))
+	w.Write([]byte(value))
 }
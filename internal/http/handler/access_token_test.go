@@ -1,11 +1,16 @@
 package handler
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/waynecraig/wechat-token-hub/internal/auth"
 	"github.com/waynecraig/wechat-token-hub/internal/cache"
+	"github.com/waynecraig/wechat-token-hub/internal/fingerprint"
+	"github.com/waynecraig/wechat-token-hub/pkg/wechatmock"
 )
 
 func TestAccessToken(t *testing.T) {
@@ -38,6 +43,11 @@ func TestAccessToken(t *testing.T) {
 			rr.Body.String(), "token1")
 	}
 
+	// Check the seconds until the token expires are sent
+	if expiresIn := rr.Header().Get("X-Expires-In"); expiresIn != "3599" && expiresIn != "3600" {
+		t.Errorf("handler returned unexpected X-Expires-In: got %v want 3600", expiresIn)
+	}
+
 	// Create a new request with a rotate_token query parameter
 	req, err = http.NewRequest("GET", "/access_token?rotate_token=token1", nil)
 	if err != nil {
@@ -57,3 +67,105 @@ func TestAccessToken(t *testing.T) {
 	}
 
 }
+
+func TestAccessTokenNewerThan(t *testing.T) {
+	t.Setenv("ROTATE_MIN_INTERVAL", "1h")
+	cache.SaveCacheItem("access_token", "token1", 3600)
+	ctx := auth.NewContext(context.Background(), &auth.Principal{Subject: "backend"})
+
+	tests := []struct {
+		name        string
+		query       string
+		status      int
+		body        string
+		fingerprint string
+	}{
+		{"older", "?newer_than=" + fingerprint.Of("token0"), http.StatusOK, "token1", fingerprint.Of("token1")},
+		{"not changed", "?newer_than=" + fingerprint.Of("token1") + "&wait=10ms", http.StatusNotModified, "", ""},
+		{"invalid wait", "?newer_than=" + fingerprint.Of("token1") + "&wait=1h", http.StatusBadRequest, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/access_token"+tt.query, nil).WithContext(ctx)
+			rr := httptest.NewRecorder()
+			AccessToken(rr, req)
+			if rr.Code != tt.status {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tt.status)
+			}
+			if tt.body != "" && rr.Body.String() != tt.body {
+				t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), tt.body)
+			}
+			if got := rr.Header().Get("X-Credential-Fingerprint"); got != tt.fingerprint {
+				t.Errorf("handler returned unexpected X-Credential-Fingerprint: got %v want %v", got, tt.fingerprint)
+			}
+		})
+	}
+}
+
+func TestAccessTokenRotateFingerprint(t *testing.T) {
+	mock := wechatmock.New()
+	mock.AddAccount("wxrotate", "rotate_app_secret")
+	server := httptest.NewServer(mock)
+	defer server.Close()
+	t.Setenv("WECHAT_API_ROOT", server.URL)
+	t.Setenv("APPSECRET_wxrotate", "rotate_app_secret")
+	defer cache.DeleteCacheItem("access_token_wxrotate")
+
+	get := func(method string, header string, contentType string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/access_token?appid=wxrotate", strings.NewReader(body))
+		if header != "" {
+			req.Header.Set("X-Rotate-Fingerprint", header)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rr := httptest.NewRecorder()
+		AccessToken(rr, req)
+		return rr
+	}
+
+	rr := get(http.MethodGet, "", "", "")
+	current := rr.Body.String()
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Credential-Fingerprint") != fingerprint.Of(current) {
+		t.Fatalf("Unexpected response: %d %s", rr.Code, current)
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		header      string
+		contentType string
+		body        func(fp string) string
+		rotated     bool
+		status      int
+	}{
+		{"outdated header", http.MethodGet, "0000000000000000", "", nil, false, http.StatusOK},
+		{"header", http.MethodGet, "current", "", nil, true, http.StatusOK},
+		{"form", http.MethodPost, "", "application/x-www-form-urlencoded", func(fp string) string { return "rotate_fingerprint=" + fp }, true, http.StatusOK},
+		{"json", http.MethodPost, "", "application/json", func(fp string) string { return `{"rotate_fingerprint":"` + fp + `"}` }, true, http.StatusOK},
+		{"invalid json", http.MethodPost, "", "application/json", func(fp string) string { return "{" }, false, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fp := fingerprint.Of(current)
+			header, body := tt.header, ""
+			if header == "current" {
+				header = fp
+			}
+			if tt.body != nil {
+				body = tt.body(fp)
+			}
+			rr := get(tt.method, header, tt.contentType, body)
+			if rr.Code != tt.status {
+				t.Fatalf("handler returned wrong status code: got %v want %v, %s", rr.Code, tt.status, rr.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if rotated := rr.Body.String() != current; rotated != tt.rotated {
+				t.Errorf("Expected rotated to be %v, got %s after %s", tt.rotated, rr.Body.String(), current)
+			}
+			current = rr.Body.String()
+		})
+	}
+}
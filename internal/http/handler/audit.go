@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/audit"
+)
+
+// the number of events returned by default
+const defaultAuditLimit = 100
+
+// AdminAudit handles requests to the /admin/audit path, it returns the recent
+// events of the audit log, filtered by the type, key, principal and since queries
+func AdminAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Type:      query.Get("type"),
+		Key:       query.Get("key"),
+		Principal: query.Get("principal"),
+		Limit:     defaultAuditLimit,
+	}
+
+	if since := query.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			http.Error(w, "invalid since, want an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		filter.Since = t
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	writeJSON(w, audit.Recent(filter))
+}
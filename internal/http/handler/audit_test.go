@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/waynecraig/wechat-token-hub/internal/audit"
+)
+
+func TestAdminAudit(t *testing.T) {
+	audit.Record(audit.Event{Type: audit.EventRotate, Key: "handler_audit", Principal: "client1"})
+	audit.Record(audit.Event{Type: audit.EventRotateRejected, Key: "handler_audit", Principal: "client2"})
+
+	testCases := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedCount  int
+	}{
+		{name: "All", query: "key=handler_audit", expectedStatus: http.StatusOK, expectedCount: 2},
+		{name: "Principal", query: "key=handler_audit&principal=client2", expectedStatus: http.StatusOK, expectedCount: 1},
+		{name: "Limit", query: "key=handler_audit&limit=1", expectedStatus: http.StatusOK, expectedCount: 1},
+		{name: "Future", query: "key=handler_audit&since=2999-01-01T00:00:00Z", expectedStatus: http.StatusOK, expectedCount: 0},
+		{name: "Invalid since", query: "since=yesterday", expectedStatus: http.StatusBadRequest},
+		{name: "Invalid limit", query: "limit=-1", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "/admin/audit?"+tc.query, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(AdminAudit).ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+			var events []audit.Event
+			if err := json.Unmarshal(rr.Body.Bytes(), &events); err != nil {
+				t.Fatalf("Expected a json array, got %s", rr.Body.String())
+			}
+			if len(events) != tc.expectedCount {
+				t.Errorf("Expected %d events, got %d", tc.expectedCount, len(events))
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/waynecraig/wechat-token-hub/internal/tokens"
+)
+
+// AuthorizerAccessToken handles requests to the /authorizers/{appid}/access_token path
+func AuthorizerAccessToken(w http.ResponseWriter, r *http.Request) {
+	// get the appid from the path
+	path := strings.TrimPrefix(r.URL.Path, "/authorizers/")
+	appid := strings.TrimSuffix(path, "/access_token")
+	if appid == path || appid == "" || strings.Contains(appid, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	rotateToken := r.URL.Query().Get("rotate_token")
+	p := tokens.AuthorizerAccessTokenProvider(appid)
+	accessToken, err := getCredential(w, r, p, rotateToken)
+	if err != nil {
+		// return error if get authorizer access token fail
+		writeError(w, err)
+		return
+	}
+	// return the authorizer access token
+	writeCredential(w, p.Key(), accessToken)
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/waynecraig/wechat-token-hub/internal/cache"
+)
+
+func TestAuthorizerAccessToken(t *testing.T) {
+	handler := http.HandlerFunc(AuthorizerAccessToken)
+
+	// Set the expect result to cache
+	cache.SaveCacheItem("authorizer_access_token_wxa1", "atoken1", 3600)
+
+	testCases := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Get authorizer access token",
+			url:            "/authorizers/wxa1/access_token",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "atoken1",
+		},
+		{
+			name:           "Get unknown authorizer",
+			url:            "/authorizers/wxa2/access_token",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Missing appid",
+			url:            "/authorizers//access_token",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Unknown path",
+			url:            "/authorizers/wxa1/ticket",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tc.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tc.expectedStatus)
+			}
+			if tc.expectedBody != "" && rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %v want %v",
+					rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/waynecraig/wechat-token-hub/internal/redact"
+	"github.com/waynecraig/wechat-token-hub/internal/tokens"
+)
+
+// ComponentAccessToken handles requests to the /component_access_token path
+func ComponentAccessToken(w http.ResponseWriter, r *http.Request) {
+	rotateToken := r.URL.Query().Get("rotate_token")
+	p := tokens.ComponentAccessTokenProvider()
+	componentAccessToken, err := getCredential(w, r, p, rotateToken)
+	if err != nil {
+		// return error if get component access token fail
+		writeError(w, err)
+		return
+	}
+	// return the component access token
+	writeCredential(w, p.Key(), componentAccessToken)
+}
+
+// PreAuthCode handles requests to the /pre_auth_code path
+func PreAuthCode(w http.ResponseWriter, r *http.Request) {
+	preAuthCode, err := tokens.GetPreAuthCode()
+	if err != nil {
+		// return error if get pre auth code fail
+		writeError(w, err)
+		return
+	}
+	// return the pre auth code
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(preAuthCode))
+}
+
+// ComponentCallback handles the authorization events pushed by wechat to the
+// /component/callback path, such as the component_verify_ticket
+func ComponentCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	err = tokens.HandleComponentNotification(query.Get("msg_signature"), query.Get("timestamp"), query.Get("nonce"), body)
+	if err != nil {
+		http.Error(w, redact.String(err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	// wechat expects the plain text "success"
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("success"))
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/waynecraig/wechat-token-hub/internal/cache"
+	"github.com/waynecraig/wechat-token-hub/internal/wxcrypt"
+)
+
+func TestComponentAccessToken(t *testing.T) {
+	handler := http.HandlerFunc(ComponentAccessToken)
+
+	// Set the expect result to cache
+	cache.SaveCacheItem("component_access_token", "ctoken1", 3600)
+
+	req, err := http.NewRequest("GET", "/component_access_token", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	// Check the status code and body are what we expect
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+	if rr.Body.String() != "ctoken1" {
+		t.Errorf("handler returned unexpected body: got %v want %v",
+			rr.Body.String(), "ctoken1")
+	}
+
+	// Rotating without a verify ticket should fail
+	req, err = http.NewRequest("GET", "/component_access_token?rotate_token=ctoken1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusInternalServerError {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusInternalServerError)
+	}
+}
+
+func TestComponentCallback(t *testing.T) {
+	handler := http.HandlerFunc(ComponentCallback)
+
+	key := "abcdefghijklmnopqrstuvwxyz0123456789ABCDEFG"
+	os.Setenv("COMPONENT_APPID", "component1")
+	os.Setenv("COMPONENT_TOKEN", "token1")
+	os.Setenv("COMPONENT_ENCODING_AES_KEY", key)
+	defer os.Unsetenv("COMPONENT_APPID")
+	defer os.Unsetenv("COMPONENT_TOKEN")
+	defer os.Unsetenv("COMPONENT_ENCODING_AES_KEY")
+
+	// Build a verify ticket message the way wechat pushes it
+	msg := "<xml><InfoType>component_verify_ticket</InfoType><ComponentVerifyTicket>verify1</ComponentVerifyTicket></xml>"
+	encrypted, err := wxcrypt.Encrypt(key, "component1", []byte(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := wxcrypt.Signature("token1", "1409659813", "1372623149", encrypted)
+	body := fmt.Sprintf("<xml><AppId>component1</AppId><Encrypt>%s</Encrypt></xml>", encrypted)
+
+	testCases := []struct {
+		name           string
+		method         string
+		signature      string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "valid message",
+			method:         http.MethodPost,
+			signature:      signature,
+			expectedStatus: http.StatusOK,
+			expectedBody:   "success",
+		},
+		{
+			name:           "invalid signature",
+			method:         http.MethodPost,
+			signature:      "invalid",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "wrong method",
+			method:         http.MethodGet,
+			signature:      signature,
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			url := fmt.Sprintf("/component/callback?timestamp=1409659813&nonce=1372623149&encrypt_type=aes&msg_signature=%s", tc.signature)
+			req, err := http.NewRequest(tc.method, url, strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tc.expectedStatus)
+			}
+			if tc.expectedBody != "" && rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %v want %v",
+					rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/tokens"
+)
+
+// a credential listed by the admin api
+type credential struct {
+	tokens.Status
+	// seconds since the cached credential was fetched, and until it expires
+	Age       int `json:"age,omitempty"`
+	ExpiresIn int `json:"expires_in,omitempty"`
+}
+
+// AdminCredentials handles requests to the /admin/credentials path, it lists
+// the credentials fetched by the hub with their fingerprint, age, expiry and
+// source. The values are never returned.
+func AdminCredentials(w http.ResponseWriter, r *http.Request) {
+	credentials := []credential{}
+	for _, s := range tokens.Statuses() {
+		c := credential{Status: s}
+		if !s.ExpiresAt.IsZero() {
+			c.Age = int(time.Since(s.CreatedAt).Seconds())
+			c.ExpiresIn = int(time.Until(s.ExpiresAt).Seconds())
+		}
+		credentials = append(credentials, c)
+	}
+	writeJSON(w, credentials)
+}
+
+// AdminCredential handles requests to the /admin/credentials/{key}/refresh
+// and /admin/credentials/{key}/evict paths, it fetches a new credential or
+// removes the cached one
+func AdminCredential(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/admin/credentials/")
+	key, action, ok := strings.Cut(path, "/")
+	if !ok || key == "" || (action != "refresh" && action != "evict") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var err error
+	if action == "refresh" {
+		err = tokens.RefreshCredential(r.Context(), key)
+	} else {
+		err = tokens.EvictCredential(r.Context(), key)
+	}
+	if errors.Is(err, tokens.ErrUnknownCredential) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// AdminRefresh handles requests to the /admin/refresh path, it tells whether
+// the background refresh is paused
+func AdminRefresh(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]bool{"paused": tokens.RefreshPaused()})
+}
+
+// AdminPauseRefresh handles requests to the /admin/refresh/pause path, it
+// stops the background refresh until it's resumed
+func AdminPauseRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	tokens.PauseRefresh()
+	AdminRefresh(w, r)
+}
+
+// AdminResumeRefresh handles requests to the /admin/refresh/resume path, it
+// restarts the background refresh
+func AdminResumeRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	tokens.ResumeRefresh()
+	AdminRefresh(w, r)
+}
+
+// AdminUpstreamErrors handles requests to the /admin/upstream_errors path, it
+// returns the recent failed requests to the upstream API, the newest first
+func AdminUpstreamErrors(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, tokens.UpstreamErrors())
+}
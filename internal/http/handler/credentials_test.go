@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/waynecraig/wechat-token-hub/internal/cache"
+	"github.com/waynecraig/wechat-token-hub/internal/tokens"
+)
+
+func TestAdminCredentials(t *testing.T) {
+	// fetch a wecom token from a mock server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok","access_token":"wecom_admin_token","expires_in":7200}`))
+	}))
+	defer server.Close()
+	os.Setenv("WECOM_API_ROOT", server.URL)
+	os.Setenv("WECOM_SECRET_2000001", "admin_agent_secret")
+	defer os.Unsetenv("WECOM_API_ROOT")
+	defer os.Unsetenv("WECOM_SECRET_2000001")
+	defer cache.DeleteCacheItem("wecom_access_token_2000001")
+	if _, err := tokens.GetWecomAccessToken("2000001", ""); err != nil {
+		t.Fatalf("GetWecomAccessToken() error = %v", err)
+	}
+
+	// the credential is listed without its value
+	rr := serve(t, AdminCredentials, "GET", "/admin/credentials")
+	if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), "wecom_admin_token") {
+		t.Fatalf("handler returned %v: %s", rr.Code, rr.Body.String())
+	}
+	var credentials []credential
+	json.Unmarshal(rr.Body.Bytes(), &credentials)
+	found := false
+	for _, c := range credentials {
+		if c.Key == "wecom_access_token_2000001" {
+			found = true
+			if c.Source != "wecom" || c.Fingerprint == "" || c.ExpiresIn <= 0 {
+				t.Errorf("Unexpected credential: %+v", c)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Expected the wecom token to be listed, got %s", rr.Body.String())
+	}
+
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{name: "Refresh", method: "POST", path: "/admin/credentials/wecom_access_token_2000001/refresh", expectedStatus: http.StatusOK},
+		{name: "Evict", method: "POST", path: "/admin/credentials/wecom_access_token_2000001/evict", expectedStatus: http.StatusOK},
+		{name: "Unknown credential", method: "POST", path: "/admin/credentials/access_token_unknown/refresh", expectedStatus: http.StatusNotFound},
+		{name: "Unknown action", method: "POST", path: "/admin/credentials/wecom_access_token_2000001/delete", expectedStatus: http.StatusNotFound},
+		{name: "GET", method: "GET", path: "/admin/credentials/wecom_access_token_2000001/refresh", expectedStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := serve(t, AdminCredential, tc.method, tc.path)
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+		})
+	}
+	if value := cache.GetCacheItem("wecom_access_token_2000001"); value != "" {
+		t.Errorf("Expected the credential to be evicted, got %s", value)
+	}
+}
+
+func TestAdminRefresh(t *testing.T) {
+	defer tokens.ResumeRefresh()
+
+	if rr := serve(t, AdminPauseRefresh, "GET", "/admin/refresh/pause"); rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusMethodNotAllowed)
+	}
+	if rr := serve(t, AdminPauseRefresh, "POST", "/admin/refresh/pause"); !strings.Contains(rr.Body.String(), `"paused":true`) {
+		t.Errorf("Expected the refresh to be paused, got %s", rr.Body.String())
+	}
+	if rr := serve(t, AdminRefresh, "GET", "/admin/refresh"); !strings.Contains(rr.Body.String(), `"paused":true`) {
+		t.Errorf("Expected the refresh to be paused, got %s", rr.Body.String())
+	}
+	if rr := serve(t, AdminResumeRefresh, "POST", "/admin/refresh/resume"); !strings.Contains(rr.Body.String(), `"paused":false`) {
+		t.Errorf("Expected the refresh to be resumed, got %s", rr.Body.String())
+	}
+}
+
+func TestAdminUpstreamErrors(t *testing.T) {
+	rr := serve(t, AdminUpstreamErrors, "GET", "/admin/upstream_errors")
+	var errs []tokens.UpstreamError
+	if rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &errs) != nil {
+		t.Errorf("handler returned %v: %s", rr.Code, rr.Body.String())
+	}
+}
+
+// serve a request to the handler
+func serve(t *testing.T, h http.HandlerFunc, method string, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
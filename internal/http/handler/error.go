@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/waynecraig/wechat-token-hub/internal/redact"
+	"github.com/waynecraig/wechat-token-hub/internal/tokens"
+)
+
+// write the error to the response, with the status code matching its type.
+// The secrets and credentials in the error are redacted.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	// the client already holds the credential, there is nothing to send
+	if errors.Is(err, tokens.ErrNotChanged) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	var quotaErr *tokens.QuotaError
+	var rateLimitErr *tokens.RateLimitError
+	if errors.Is(err, errInvalidWait) || errors.Is(err, errInvalidBody) || errors.Is(err, tokens.ErrNotConfigured) {
+		status = http.StatusBadRequest
+	} else if errors.As(err, &quotaErr) {
+		status = http.StatusTooManyRequests
+	} else if errors.As(err, &rateLimitErr) {
+		status = http.StatusTooManyRequests
+		// round up, so that the client doesn't retry too early
+		retryAfter := int(math.Ceil(rateLimitErr.RetryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+
+	w.WriteHeader(status)
+	w.Write([]byte(redact.String(err.Error())))
+}
+
+// write the error of an api on behalf of a user, such as the mini program and
+// oauth apis. The errors of wechat, mostly an invalid code, and of the user
+// data are the fault of the client, and the missing session is not found.
+func writeUserError(w http.ResponseWriter, err error) {
+	var apiErr *tokens.APIError
+	switch {
+	case errors.Is(err, tokens.ErrNoSessionKey), errors.Is(err, tokens.ErrNoRefreshToken):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.As(err, &apiErr), errors.Is(err, tokens.ErrInvalidUserData):
+		http.Error(w, redact.String(err.Error()), http.StatusBadRequest)
+	default:
+		writeError(w, err)
+	}
+}
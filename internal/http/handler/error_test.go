@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/tokens"
+)
+
+func TestWriteError(t *testing.T) {
+	testCases := []struct {
+		name               string
+		err                error
+		expectedStatus     int
+		expectedRetryAfter string
+	}{
+		{
+			name:           "Upstream error",
+			err:            &tokens.APIError{Name: "access token", ErrCode: 40013, ErrMsg: "invalid appid"},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "Quota error",
+			err:            &tokens.QuotaError{Key: "access_token"},
+			expectedStatus: http.StatusTooManyRequests,
+		},
+		{
+			name:               "Rate limit error",
+			err:                fmt.Errorf("wrapped: %w", &tokens.RateLimitError{Key: "access_token", RetryAfter: 1500 * time.Millisecond}),
+			expectedStatus:     http.StatusTooManyRequests,
+			expectedRetryAfter: "2",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			writeError(rr, tc.err)
+
+			if status := rr.Code; status != tc.expectedStatus {
+				t.Errorf("writeError wrote wrong status code: got %v want %v",
+					status, tc.expectedStatus)
+			}
+			if retryAfter := rr.Header().Get("Retry-After"); retryAfter != tc.expectedRetryAfter {
+				t.Errorf("writeError wrote wrong Retry-After: got %v want %v",
+					retryAfter, tc.expectedRetryAfter)
+			}
+			if rr.Body.String() != tc.err.Error() {
+				t.Errorf("writeError wrote unexpected body: got %v want %v",
+					rr.Body.String(), tc.err.Error())
+			}
+		})
+	}
+}
+
+func TestWriteErrorRedactsSecrets(t *testing.T) {
+	// the upstream is unreachable, so the error includes the request url
+	os.Setenv("WECHAT_API_ROOT", "http://127.0.0.1:1")
+	os.Setenv("APPSECRET_wxleak", "leaked_app_secret")
+	defer os.Unsetenv("WECHAT_API_ROOT")
+	defer os.Unsetenv("APPSECRET_wxleak")
+
+	req, err := http.NewRequest("GET", "/access_token?appid=wxleak", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(AccessToken).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusInternalServerError)
+	}
+	if strings.Contains(rr.Body.String(), "leaked_app_secret") {
+		t.Errorf("handler leaked the secret: %s", rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), "secret=[REDACTED]") {
+		t.Errorf("Expected the secret to be redacted, got %s", rr.Body.String())
+	}
+}
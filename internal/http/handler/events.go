@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/events"
+)
+
+// the interval of the comments sent to keep the idle streams open through
+// the proxies
+var eventsKeepAlive = 30 * time.Second
+
+// Events handles requests to the /events path, it streams the events, such as
+// credential.rotated, as Server-Sent Events. The events may be filtered by the
+// appid and credential_type queries, and a client reconnecting with the
+// Last-Event-ID header gets the recent events it missed.
+func Events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	appid := r.URL.Query().Get("appid")
+	credentialType := r.URL.Query().Get("credential_type")
+
+	subscription, unsubscribe := events.Subscribe(r.Header.Get("Last-Event-ID"))
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case e := <-subscription:
+			if (appid != "" && e.AppID != appid) || (credentialType != "" && e.CredentialType != credentialType) {
+				continue
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
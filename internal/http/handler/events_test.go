@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/events"
+)
+
+// read the next event of the stream, skipping the comments
+func readEvent(t *testing.T, reader *bufio.Reader) (string, events.Event) {
+	t.Helper()
+	var id string
+	var e events.Event
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read stream fail: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e); err != nil {
+				t.Fatalf("decode event fail: %v", err)
+			}
+		case line == "" && id != "":
+			return id, e
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	eventsKeepAlive = 10 * time.Millisecond
+	defer func() { eventsKeepAlive = 30 * time.Second }()
+
+	server := httptest.NewServer(http.HandlerFunc(Events))
+	defer server.Close()
+
+	first := events.Publish(events.Event{Type: events.TypeCredentialRotated, Key: "access_token_wx1", AppID: "wx1", CredentialType: "access_token"})
+
+	// the client reconnecting gets the events after the last one it saw
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"?appid=wx2", nil)
+	req.Header.Set("Last-Event-ID", first.ID)
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Unexpected response: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// the events of the other appids are filtered out
+	events.Publish(events.Event{Type: events.TypeCredentialRotated, Key: "access_token_wx1", AppID: "wx1", CredentialType: "access_token"})
+	want := events.Publish(events.Event{Type: events.TypeCredentialRotated, Key: "ticket_wx2_jsapi", AppID: "wx2", CredentialType: "jsapi_ticket", Fingerprint: "0123456789abcdef"})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		id, e := readEvent(t, bufio.NewReader(resp.Body))
+		if id != want.ID || e.Key != "ticket_wx2_jsapi" || e.Fingerprint != "0123456789abcdef" {
+			t.Errorf("Unexpected event %s: %+v", id, e)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the event to be streamed")
+	}
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/waynecraig/wechat-token-hub/internal/auth"
+	"github.com/waynecraig/wechat-token-hub/internal/redact"
+	"github.com/waynecraig/wechat-token-hub/internal/store"
+	"github.com/waynecraig/wechat-token-hub/internal/tokens"
+)
+
+// the result of a readiness check, the errors are only logged since the
+// probe doesn't need the Authorization header
+type check struct {
+	Status string `json:"status"`
+}
+
+// Healthz handles requests to the /healthz path, it tells the process is alive
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]string{"status": "ok"})
+}
+
+// Readyz handles requests to the /readyz path, it tells whether the hub can
+// serve the credentials: the config is valid, the store is readable, and no
+// credential has expired after a failed refresh. A failed refresh alone
+// doesn't make the hub unready while the cached credential is still served.
+func Readyz(w http.ResponseWriter, r *http.Request) {
+	var expiredErrs []string
+	for _, s := range tokens.Statuses() {
+		if !s.Healthy() {
+			expiredErrs = append(expiredErrs, s.Key+" has expired: "+s.LastError)
+		}
+	}
+
+	checks := map[string]check{
+		"config":      newCheck("config", errors.Join(tokens.CheckConfig(), auth.CheckKeys())),
+		"store":       newCheck("store", store.Check()),
+		"credentials": newCheck("credentials", joinErrors(expiredErrs)),
+	}
+
+	status, code := "ok", http.StatusOK
+	for _, c := range checks {
+		if c.Status != "ok" {
+			status, code = "unavailable", http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": status,
+		"checks": checks,
+	})
+}
+
+func newCheck(name string, err error) check {
+	if err != nil {
+		slog.Warn("readiness check fail", "check", name, "error", redact.String(err.Error()))
+		return check{Status: "fail"}
+	}
+	return check{Status: "ok"}
+}
+
+func joinErrors(messages []string) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHealthz(t *testing.T) {
+	req, err := http.NewRequest("GET", "/healthz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Healthz).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	testCases := []struct {
+		name           string
+		envVars        map[string]string
+		expectedStatus int
+		expectedConfig string
+	}{
+		{
+			name: "Ready",
+			envVars: map[string]string{
+				"WECHAT_API_ROOT": "http://127.0.0.1:1",
+				"APPID":           "wxready",
+				"APPSECRET":       "ready_app_secret",
+				"JWT_KEY_ready":   "ready_jwt_key",
+			},
+			expectedStatus: http.StatusOK,
+			expectedConfig: "ok",
+		},
+		{
+			name: "Missing secret",
+			envVars: map[string]string{
+				"WECHAT_API_ROOT": "http://127.0.0.1:1",
+				"APPID":           "wxready",
+				"JWT_KEY_ready":   "ready_jwt_key",
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedConfig: "fail",
+		},
+		{
+			name: "Missing JWT key",
+			envVars: map[string]string{
+				"WECHAT_API_ROOT": "http://127.0.0.1:1",
+				"APPID":           "wxready",
+				"APPSECRET":       "ready_app_secret",
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedConfig: "fail",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.envVars {
+				os.Setenv(k, v)
+			}
+			defer func() {
+				for k := range tc.envVars {
+					os.Unsetenv(k)
+				}
+			}()
+
+			req, err := http.NewRequest("GET", "/readyz", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(Readyz).ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body %s", rr.Code, tc.expectedStatus, rr.Body.String())
+			}
+			var result struct {
+				Status string
+				Checks map[string]check
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+				t.Fatalf("Expected a json body, got %s", rr.Body.String())
+			}
+			if result.Checks["config"].Status != tc.expectedConfig {
+				t.Errorf("Expected the config check to be %s, got %+v", tc.expectedConfig, result.Checks["config"])
+			}
+			if strings.Contains(rr.Body.String(), "error") {
+				t.Errorf("Expected no error details in the body, got %s", rr.Body.String())
+			}
+			for _, name := range []string{"store", "credentials"} {
+				if _, ok := result.Checks[name]; !ok {
+					t.Errorf("Expected the %s check, got %v", name, result.Checks)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/waynecraig/wechat-token-hub/internal/tokens"
+	"github.com/waynecraig/wechat-token-hub/internal/vault"
+)
+
+// the largest json body of the mini program apis, the encrypted user data is
+// a few KB
+const maxMiniProgramBody = 1 << 20
+
+// MiniProgram handles requests to the /miniprogram/{appid}/... paths:
+//
+//   - GET code2session?code= exchanges the login code for the openid and
+//     unionid of the user. The session key is kept in the vault of the hub
+//     instead of being returned, unless store_session_key=false.
+//   - POST decrypt_user_data decrypts the user data with the session key
+//     kept in the vault.
+//   - POST check_signature checks the signature of the raw user data with
+//     the session key kept in the vault.
+func MiniProgram(w http.ResponseWriter, r *http.Request) {
+	// get the appid and the action from the path
+	path := strings.TrimPrefix(r.URL.Path, "/miniprogram/")
+	appid, action, ok := strings.Cut(path, "/")
+	if !ok || appid == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch action {
+	case "code2session":
+		code2Session(w, r, appid)
+	case "decrypt_user_data":
+		decryptUserData(w, r, appid)
+	case "check_signature":
+		checkSignature(w, r, appid)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func code2Session(w http.ResponseWriter, r *http.Request, appid string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	// check the vault can keep the session key before the code is used up
+	keep := r.URL.Query().Get("store_session_key") != "false"
+	if keep {
+		if err := vault.Check(); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+
+	session, err := tokens.Code2Session(appid, code)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+
+	// the session key never leaves the hub once it's in the vault
+	if keep {
+		if err := tokens.SaveSessionKey(appid, session.OpenID, session.SessionKey); err != nil {
+			writeError(w, err)
+			return
+		}
+		session.SessionKey = ""
+	}
+	writeJSON(w, session)
+}
+
+func decryptUserData(w http.ResponseWriter, r *http.Request, appid string) {
+	var body struct {
+		OpenID        string `json:"openid"`
+		EncryptedData string `json:"encrypted_data"`
+		IV            string `json:"iv"`
+	}
+	if !readMiniProgramBody(w, r, &body) {
+		return
+	}
+	if body.OpenID == "" || body.EncryptedData == "" || body.IV == "" {
+		http.Error(w, "openid, encrypted_data and iv are required", http.StatusBadRequest)
+		return
+	}
+
+	data, err := tokens.DecryptUserData(appid, body.OpenID, body.EncryptedData, body.IV)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func checkSignature(w http.ResponseWriter, r *http.Request, appid string) {
+	var body struct {
+		OpenID    string `json:"openid"`
+		RawData   string `json:"raw_data"`
+		Signature string `json:"signature"`
+	}
+	if !readMiniProgramBody(w, r, &body) {
+		return
+	}
+	if body.OpenID == "" || body.Signature == "" {
+		http.Error(w, "openid and signature are required", http.StatusBadRequest)
+		return
+	}
+
+	valid, err := tokens.CheckUserSignature(appid, body.OpenID, body.RawData, body.Signature)
+	if err != nil {
+		writeUserError(w, err)
+		return
+	}
+	writeJSON(w, map[string]bool{"valid": valid})
+}
+
+// decode the json body of a POST request, or write the error
+func readMiniProgramBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMiniProgramBody)).Decode(v); err != nil {
+		http.Error(w, "invalid json body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/waynecraig/wechat-token-hub/internal/wxcrypt"
+	"github.com/waynecraig/wechat-token-hub/pkg/wechatmock"
+)
+
+func TestMiniProgram(t *testing.T) {
+	mock := wechatmock.New()
+	mock.AddAccount("wxmini", "mini_app_secret")
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	os.Setenv("WECHAT_API_ROOT", server.URL)
+	os.Setenv("APPSECRET_wxmini", "mini_app_secret")
+	defer os.Unsetenv("WECHAT_API_ROOT")
+	defer os.Unsetenv("APPSECRET_wxmini")
+
+	call := func(method string, path string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(MiniProgram).ServeHTTP(rr, req)
+		return rr
+	}
+
+	// without storing, the session key is returned like wechat does
+	rr := call("GET", "/miniprogram/wxmini/code2session?code=code1&store_session_key=false", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"session_key"`) {
+		t.Errorf("Expected the session key, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// the session key is stored by default, which needs a master key, and
+	// the code is not used up without one
+	rr = call("GET", "/miniprogram/wxmini/code2session?code=code2", "")
+	if rr.Code != http.StatusInternalServerError || strings.Contains(rr.Body.String(), `"session_key"`) {
+		t.Errorf("Expected the master key to be required, got %d %s", rr.Code, rr.Body.String())
+	}
+	t.Setenv("MASTER_KEY", "v1=MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+
+	// once stored, the session key never leaves the hub
+	rr = call("GET", "/miniprogram/wxmini/code2session?code=code2", "")
+	var session struct {
+		OpenID     string `json:"openid"`
+		SessionKey string `json:"session_key"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &session)
+	if rr.Code != http.StatusOK || session.OpenID != wechatmock.OpenID("wxmini", "code2") || session.SessionKey != "" {
+		t.Fatalf("Expected the openid only, got %d %s", rr.Code, rr.Body.String())
+	}
+	sessionKey := mock.SessionKey("wxmini", session.OpenID)
+
+	iv := "r7BXXKkLb8qrSNn05n0qiA=="
+	data := `{"phoneNumber":"13800138000","watermark":{"appid":"wxmini","timestamp":1477314187}}`
+	encrypted, _ := wxcrypt.EncryptUserData(sessionKey, iv, []byte(data))
+	signature := wxcrypt.UserDataSignature(`{"nickName":"Band"}`, sessionKey)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		want   string
+	}{
+		{name: "Used code", method: "GET", path: "/miniprogram/wxmini/code2session?code=code2", status: http.StatusBadRequest},
+		{name: "Missing code", method: "GET", path: "/miniprogram/wxmini/code2session", status: http.StatusBadRequest},
+		{name: "Unknown appid", method: "GET", path: "/miniprogram/wxunknown/code2session?code=code3", status: http.StatusBadRequest},
+		{name: "Unknown action", method: "GET", path: "/miniprogram/wxmini/other", status: http.StatusNotFound},
+		{name: "Missing appid", method: "GET", path: "/miniprogram/", status: http.StatusNotFound},
+		{
+			name:   "Decrypt",
+			method: "POST",
+			path:   "/miniprogram/wxmini/decrypt_user_data",
+			body:   `{"openid":"` + session.OpenID + `","encrypted_data":"` + encrypted + `","iv":"` + iv + `"}`,
+			status: http.StatusOK,
+			want:   data,
+		},
+		{
+			name:   "Decrypt with GET",
+			method: "GET",
+			path:   "/miniprogram/wxmini/decrypt_user_data",
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "Decrypt invalid data",
+			method: "POST",
+			path:   "/miniprogram/wxmini/decrypt_user_data",
+			body:   `{"openid":"` + session.OpenID + `","encrypted_data":"YWJj","iv":"` + iv + `"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "Decrypt without session key",
+			method: "POST",
+			path:   "/miniprogram/wxmini/decrypt_user_data",
+			body:   `{"openid":"unknown","encrypted_data":"` + encrypted + `","iv":"` + iv + `"}`,
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "Valid signature",
+			method: "POST",
+			path:   "/miniprogram/wxmini/check_signature",
+			body:   `{"openid":"` + session.OpenID + `","raw_data":"{\"nickName\":\"Band\"}","signature":"` + signature + `"}`,
+			status: http.StatusOK,
+			want:   `{"valid":true}` + "\n",
+		},
+		{
+			name:   "Invalid signature",
+			method: "POST",
+			path:   "/miniprogram/wxmini/check_signature",
+			body:   `{"openid":"` + session.OpenID + `","raw_data":"{}","signature":"` + signature + `"}`,
+			status: http.StatusOK,
+			want:   `{"valid":false}` + "\n",
+		},
+		{
+			name:   "Invalid json",
+			method: "POST",
+			path:   "/miniprogram/wxmini/check_signature",
+			body:   `{`,
+			status: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := call(tt.method, tt.path, tt.body)
+			if rr.Code != tt.status {
+				t.Errorf("Expected status %d, got %d %s", tt.status, rr.Code, rr.Body.String())
+			}
+			if tt.want != "" && rr.Body.String() != tt.want {
+				t.Errorf("Expected body %s, got %s", tt.want, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/waynecraig/wechat-token-hub/internal/tokens"
+)
+
+// OAuth handles requests to the /oauth/{appid}/... paths of the web
+// authorization of an official account:
+//
+//   - access_token?code= exchanges the code for the access token of the
+//     user, the refresh token is kept in the store of the hub.
+//   - refresh?openid= refreshes the access token of the user.
+//   - userinfo?openid=&lang= returns the profile of the user.
+func OAuth(w http.ResponseWriter, r *http.Request) {
+	// get the appid and the action from the path
+	path := strings.TrimPrefix(r.URL.Path, "/oauth/")
+	appid, action, ok := strings.Cut(path, "/")
+	if !ok || appid == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	switch action {
+	case "access_token":
+		if query.Get("code") == "" {
+			http.Error(w, "code is required", http.StatusBadRequest)
+			return
+		}
+		token, err := tokens.ExchangeOAuthCode(appid, query.Get("code"))
+		if err != nil {
+			writeUserError(w, err)
+			return
+		}
+		writeJSON(w, token)
+	case "refresh":
+		if query.Get("openid") == "" {
+			http.Error(w, "openid is required", http.StatusBadRequest)
+			return
+		}
+		token, err := tokens.RefreshOAuthToken(appid, query.Get("openid"))
+		if err != nil {
+			writeUserError(w, err)
+			return
+		}
+		writeJSON(w, token)
+	case "userinfo":
+		if query.Get("openid") == "" {
+			http.Error(w, "openid is required", http.StatusBadRequest)
+			return
+		}
+		lang := query.Get("lang")
+		if lang == "" {
+			lang = "zh_CN"
+		}
+		info, err := tokens.OAuthUserInfo(appid, query.Get("openid"), lang)
+		if err != nil {
+			writeUserError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(info)
+	default:
+		http.NotFound(w, r)
+	}
+}
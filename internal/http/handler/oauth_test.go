@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/waynecraig/wechat-token-hub/pkg/wechatmock"
+)
+
+func TestOAuth(t *testing.T) {
+	mock := wechatmock.New()
+	mock.AddAccount("wxoauth", "oauth_app_secret")
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	os.Setenv("WECHAT_API_ROOT", server.URL)
+	os.Setenv("APPSECRET_wxoauth", "oauth_app_secret")
+	defer os.Unsetenv("WECHAT_API_ROOT")
+	defer os.Unsetenv("APPSECRET_wxoauth")
+
+	rr := serve(t, OAuth, "GET", "/oauth/wxoauth/access_token?code=code1")
+	var token struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		OpenID       string `json:"openid"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &token)
+	if rr.Code != http.StatusOK || token.AccessToken == "" || token.OpenID != wechatmock.OpenID("wxoauth", "code1") {
+		t.Fatalf("Expected the access token, got %d %s", rr.Code, rr.Body.String())
+	}
+	// the refresh token never leaves the hub
+	if token.RefreshToken != "" {
+		t.Errorf("Expected no refresh token, got %s", rr.Body.String())
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		want   string
+	}{
+		{name: "Used code", path: "/oauth/wxoauth/access_token?code=code1", status: http.StatusBadRequest},
+		{name: "Missing code", path: "/oauth/wxoauth/access_token", status: http.StatusBadRequest},
+		{name: "Unknown appid", path: "/oauth/wxunknown/access_token?code=code2", status: http.StatusBadRequest},
+		{name: "Refresh", path: "/oauth/wxoauth/refresh?openid=" + token.OpenID, status: http.StatusOK, want: `"access_token"`},
+		{name: "Refresh unknown user", path: "/oauth/wxoauth/refresh?openid=unknown", status: http.StatusNotFound},
+		{name: "User info", path: "/oauth/wxoauth/userinfo?openid=" + token.OpenID, status: http.StatusOK, want: `"nickname"`},
+		{name: "Missing openid", path: "/oauth/wxoauth/userinfo", status: http.StatusBadRequest},
+		{name: "Unknown action", path: "/oauth/wxoauth/other", status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(t, OAuth, "GET", tt.path)
+			if rr.Code != tt.status {
+				t.Errorf("Expected status %d, got %d %s", tt.status, rr.Code, rr.Body.String())
+			}
+			if !strings.Contains(rr.Body.String(), tt.want) {
+				t.Errorf("Expected body with %s, got %s", tt.want, rr.Body.String())
+			}
+		})
+	}
+}
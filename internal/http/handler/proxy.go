@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/waynecraig/wechat-token-hub/internal/audit"
+	"github.com/waynecraig/wechat-token-hub/internal/auth"
+	"github.com/waynecraig/wechat-token-hub/internal/logging"
+	"github.com/waynecraig/wechat-token-hub/internal/policy"
+	"github.com/waynecraig/wechat-token-hub/internal/redact"
+	"github.com/waynecraig/wechat-token-hub/internal/tokens"
+)
+
+// the largest request body forwarded, wechat limits the media uploads to 10MB
+const maxProxyBody = 20 << 20
+
+// the headers which are not forwarded, besides the hop-by-hop ones the
+// credentials of the client are kept inside the hub
+var proxySkippedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Cookie":              true,
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+	"Content-Length":      true,
+	// let the transport ask for gzip and decode it, the response is read
+	// to check the errcode
+	"Accept-Encoding": true,
+}
+
+// Proxy handles requests to the /proxy/{appid}/cgi-bin/... path, it forwards
+// the request to WECHAT_API_ROOT with the access token of the account. If
+// wechat rejects the token, it's rotated and the request is sent again once.
+// The calls which are not allowed by the policy are refused and audited.
+func Proxy(w http.ResponseWriter, r *http.Request) {
+	// get the appid and the api path from the path
+	path := strings.TrimPrefix(r.URL.Path, "/proxy/")
+	appid, apiPath, ok := strings.Cut(path, "/")
+	if !ok || appid == "" || !strings.HasPrefix(apiPath, "cgi-bin/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	p := tokens.AccessTokenProvider(appid)
+
+	// check the client may call the api, the rules are keyed on the key id
+	// since the subject is chosen by the client itself
+	principal := auth.FromContext(r.Context())
+	kid := ""
+	if principal != nil {
+		kid = principal.KeyID
+	}
+	if err := policy.Current().AllowProxy(kid, appid, r.Method, "/"+apiPath); err != nil {
+		audit.Record(audit.Event{
+			Type:      audit.EventProxyDenied,
+			Key:       p.Key(),
+			Principal: kid,
+			RequestID: logging.RequestID(r.Context()),
+			Method:    r.Method,
+			Path:      "/" + apiPath,
+			Error:     err.Error(),
+		})
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxProxyBody))
+	if err != nil {
+		http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	accessToken, err := tokens.GetContext(r.Context(), p, "")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	resp, data, err := forward(r, apiPath, body, accessToken)
+
+	// rotate the token rejected by wechat and try again
+	if err == nil && invalidAccessToken(data) {
+		accessToken, err = tokens.GetContext(r.Context(), p, accessToken)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		resp, data, err = forward(r, apiPath, body, accessToken)
+	}
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return
+		}
+		http.Error(w, redact.String(err.Error()), http.StatusBadGateway)
+		return
+	}
+
+	for name, values := range resp.Header {
+		if !proxySkippedHeaders[name] {
+			w.Header()[name] = values
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	w.Write(data)
+}
+
+// send the request to wechat with the access token, and read the response
+func forward(r *http.Request, apiPath string, body []byte, accessToken string) (*http.Response, []byte, error) {
+	query := r.URL.Query()
+	query.Set("access_token", accessToken)
+	url := os.Getenv("WECHAT_API_ROOT") + "/" + apiPath + "?" + query.Encode()
+
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, values := range r.Header {
+		if !proxySkippedHeaders[name] {
+			req.Header[name] = values
+		}
+	}
+
+	resp, err := tokens.UpstreamClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, data, nil
+}
+
+// report whether wechat rejected the access token as invalid or expired
+func invalidAccessToken(data []byte) bool {
+	var result struct {
+		ErrCode int `json:"errcode"`
+	}
+	return json.Unmarshal(data, &result) == nil && tokens.InvalidTokenCode(result.ErrCode)
+}
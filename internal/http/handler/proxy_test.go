@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/waynecraig/wechat-token-hub/internal/audit"
+	"github.com/waynecraig/wechat-token-hub/internal/auth"
+	"github.com/waynecraig/wechat-token-hub/internal/cache"
+	"github.com/waynecraig/wechat-token-hub/internal/policy"
+	"github.com/waynecraig/wechat-token-hub/internal/quota"
+)
+
+func TestProxy(t *testing.T) {
+	// wechat issues proxy_token2 and accepts only it
+	var apiCalls int
+	wechat := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/cgi-bin/token" {
+			w.Write([]byte(`{"access_token":"proxy_token2","expires_in":7200}`))
+			return
+		}
+		apiCalls++
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case r.Header.Get("Authorization") != "":
+			w.Write([]byte(`{"errcode":-1,"errmsg":"the jwt was forwarded"}`))
+		case r.URL.Query().Get("access_token") != "proxy_token2":
+			// compressed when asked, the hub must still see the errcode
+			if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+				w.Header().Set("Content-Encoding", "gzip")
+				gz := gzip.NewWriter(w)
+				gz.Write([]byte(`{"errcode":40001,"errmsg":"invalid credential"}`))
+				gz.Close()
+				return
+			}
+			w.Write([]byte(`{"errcode":40001,"errmsg":"invalid credential"}`))
+		case r.URL.Path != "/cgi-bin/message/custom/send" || r.URL.Query().Get("debug") != "1" || string(body) != `{"touser":"openid1"}`:
+			w.Write([]byte(`{"errcode":-1,"errmsg":"unexpected request"}`))
+		default:
+			w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+		}
+	}))
+	defer wechat.Close()
+
+	os.Setenv("WECHAT_API_ROOT", wechat.URL)
+	os.Setenv("APPSECRET_wxproxy", "proxy_app_secret")
+	os.Setenv("ROTATE_MIN_INTERVAL", "0s")
+	defer os.Unsetenv("WECHAT_API_ROOT")
+	defer os.Unsetenv("APPSECRET_wxproxy")
+	defer os.Unsetenv("ROTATE_MIN_INTERVAL")
+	defer quota.Reset("wxproxy:/cgi-bin/token")
+
+	// the cached token was invalidated by someone else
+	cache.SaveCacheItem("access_token_wxproxy", "proxy_token1", 7200)
+	defer cache.DeleteCacheItem("access_token_wxproxy")
+
+	req := httptest.NewRequest("POST", "/proxy/wxproxy/cgi-bin/message/custom/send?debug=1", strings.NewReader(`{"touser":"openid1"}`))
+	req.Header.Set("Authorization", "Bearer jwt")
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Proxy).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Body.String() != `{"errcode":0,"errmsg":"ok"}` {
+		t.Errorf("handler returned %v: %s", rr.Code, rr.Body.String())
+	}
+	if apiCalls != 2 {
+		t.Errorf("Expected the call to be sent again after rotating, got %d calls", apiCalls)
+	}
+	if rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected the headers of wechat, got %v", rr.Header())
+	}
+	if strings.Contains(rr.Body.String(), "proxy_token") {
+		t.Errorf("The access token leaked: %s", rr.Body.String())
+	}
+}
+
+func TestProxyErrors(t *testing.T) {
+	os.Setenv("WECHAT_API_ROOT", "http://127.0.0.1:1")
+	defer os.Unsetenv("WECHAT_API_ROOT")
+	cache.SaveCacheItem("access_token_wxproxydown", "proxy_down_token", 7200)
+	defer cache.DeleteCacheItem("access_token_wxproxydown")
+
+	testCases := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{name: "Missing appid", path: "/proxy//cgi-bin/user/info", expectedStatus: http.StatusNotFound},
+		{name: "Not an api", path: "/proxy/wxproxydown/sns/oauth2", expectedStatus: http.StatusNotFound},
+		{name: "Wechat is down", path: "/proxy/wxproxydown/cgi-bin/user/info", expectedStatus: http.StatusBadGateway},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := serve(t, Proxy, "GET", tc.path)
+			if rr.Code != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tc.expectedStatus)
+			}
+			if strings.Contains(rr.Body.String(), "proxy_down_token") {
+				t.Errorf("The access token leaked: %s", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestProxyPolicy(t *testing.T) {
+	policy.Set(&policy.Policy{Proxy: &policy.Proxy{
+		Clients: map[string][]policy.ProxyRule{
+			"notifier": {{Methods: []string{"POST"}, Paths: []string{"/cgi-bin/message/template/*"}}},
+		},
+	}})
+	defer policy.Set(&policy.Policy{})
+
+	ctx := auth.NewContext(context.Background(), &auth.Principal{Subject: "notifier", KeyID: "notifier"})
+	req := httptest.NewRequest("POST", "/proxy/wxpolicy/cgi-bin/menu/create", strings.NewReader(`{}`)).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Proxy).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "may not call POST /cgi-bin/menu/create") {
+		t.Errorf("handler returned %v: %s", rr.Code, rr.Body.String())
+	}
+	events := audit.Recent(audit.Filter{Type: audit.EventProxyDenied, Principal: "notifier", Limit: 1})
+	if len(events) != 1 || events[0].Path != "/cgi-bin/menu/create" || events[0].Method != "POST" || events[0].Key != "access_token_wxpolicy" {
+		t.Errorf("Unexpected denied events: %+v", events)
+	}
+	// the rules are keyed on the key id, a client can't claim the subject of another one
+	ctx = auth.NewContext(context.Background(), &auth.Principal{Subject: "notifier", KeyID: "service-a"})
+	req = httptest.NewRequest("POST", "/proxy/wxpolicy/cgi-bin/message/template/send", strings.NewReader(`{}`)).WithContext(ctx)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Proxy).ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("handler returned %v for a subject of another key: %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/waynecraig/wechat-token-hub/internal/quota"
+	"github.com/waynecraig/wechat-token-hub/internal/tokens"
+)
+
+// Quota handles requests to the /quota path, it returns the upstream calls
+// counted by the hub in the last 24 hours and the remaining budget
+func Quota(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, quota.Usages())
+}
+
+// AdminAPIQuota handles requests to the /admin/quota path, it asks wechat for
+// the quota of the API in the cgi_path query
+func AdminAPIQuota(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	cgiPath := query.Get("cgi_path")
+	if cgiPath == "" {
+		cgiPath = "/cgi-bin/token"
+	}
+	result, err := tokens.GetAPIQuota(query.Get("appid"), cgiPath)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, result)
+}
+
+// AdminClearQuota handles requests to the /admin/quota/clear path, it asks
+// wechat to reset the daily quota of the account
+func AdminClearQuota(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := tokens.ClearQuota(r.URL.Query().Get("appid")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// write the value as a json response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(v)
+}
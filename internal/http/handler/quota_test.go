@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/waynecraig/wechat-token-hub/internal/quota"
+)
+
+func TestQuota(t *testing.T) {
+	handler := http.HandlerFunc(Quota)
+
+	// Count some upstream calls
+	quota.Reset("quota_test")
+	quota.Record("quota_test")
+	quota.Record("quota_test")
+
+	req, err := http.NewRequest("GET", "/quota", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusOK)
+	}
+
+	var usages []quota.Usage
+	if err := json.Unmarshal(rr.Body.Bytes(), &usages); err != nil {
+		t.Fatalf("handler returned invalid json: %v", err)
+	}
+	found := false
+	for _, u := range usages {
+		if u.Key == "quota_test" {
+			found = true
+			if u.Used != 2 || u.Remaining != u.Limit-2 {
+				t.Errorf("handler returned unexpected usage: %+v", u)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("handler did not return the usage of quota_test: %s", rr.Body.String())
+	}
+}
+
+func TestAdminClearQuota(t *testing.T) {
+	handler := http.HandlerFunc(AdminClearQuota)
+
+	// Only POST is allowed
+	req, err := http.NewRequest("GET", "/admin/quota/clear", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusMethodNotAllowed {
+		t.Errorf("handler returned wrong status code: got %v want %v",
+			status, http.StatusMethodNotAllowed)
+	}
+}
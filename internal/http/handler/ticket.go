@@ -9,16 +9,16 @@ import (
 // Ticket handles requests to the /ticket path
 func Ticket(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query()
+	appid := query.Get("appid")
 	ticketType := query.Get("type")
 	rotateTicket := query.Get("rotate_ticket")
-	ticket, err := tokens.GetTicket(ticketType, rotateTicket)
+	p := tokens.TicketProvider(appid, ticketType)
+	ticket, err := getCredential(w, r, p, rotateTicket)
 	if err != nil {
 		// return error if get ticket fail
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
+		writeError(w, err)
 		return
 	}
 	// return the access token
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(ticket))
+	writeCredential(w, p.Key(), ticket)
 }
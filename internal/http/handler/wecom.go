@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/waynecraig/wechat-token-hub/internal/tokens"
+)
+
+// WecomAccessToken handles requests to the /wecom/access_token path
+func WecomAccessToken(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	agent := query.Get("agent")
+	rotateToken := query.Get("rotate_token")
+	p := tokens.WecomAccessTokenProvider(agent)
+	accessToken, err := getCredential(w, r, p, rotateToken)
+	if err != nil {
+		// return error if get access token fail
+		writeError(w, err)
+		return
+	}
+	// return the access token
+	writeCredential(w, p.Key(), accessToken)
+}
+
+// WecomTicket handles requests to the /wecom/ticket path
+func WecomTicket(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	agent := query.Get("agent")
+	ticketType := query.Get("type")
+	rotateTicket := query.Get("rotate_ticket")
+	p := tokens.WecomTicketProvider(agent, ticketType)
+	ticket, err := getCredential(w, r, p, rotateTicket)
+	if err != nil {
+		// return error if get ticket fail
+		writeError(w, err)
+		return
+	}
+	// return the ticket
+	writeCredential(w, p.Key(), ticket)
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/waynecraig/wechat-token-hub/internal/cache"
+)
+
+func TestWecom(t *testing.T) {
+	// Set the expect result to cache
+	cache.SaveCacheItem("wecom_access_token_1000001", "wtoken1", 3600)
+	cache.SaveCacheItem("wecom_ticket_1000001_jsapi", "corpticket1", 3600)
+	cache.SaveCacheItem("wecom_ticket_1000001_agent_config", "agentticket1", 3600)
+
+	testCases := []struct {
+		name           string
+		handler        http.HandlerFunc
+		url            string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Get access token",
+			handler:        WecomAccessToken,
+			url:            "/wecom/access_token?agent=1000001",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "wtoken1",
+		},
+		{
+			name:           "Get access token of unknown agent",
+			handler:        WecomAccessToken,
+			url:            "/wecom/access_token?agent=1000002",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Get enterprise ticket",
+			handler:        WecomTicket,
+			url:            "/wecom/ticket?agent=1000001&type=jsapi",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "corpticket1",
+		},
+		{
+			name:           "Get agent ticket",
+			handler:        WecomTicket,
+			url:            "/wecom/ticket?agent=1000001&type=agent_config",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "agentticket1",
+		},
+		{
+			name:           "Get unsupported ticket",
+			handler:        WecomTicket,
+			url:            "/wecom/ticket?agent=1000001&type=wx_card",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tc.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			tc.handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tc.expectedStatus)
+			}
+			if tc.expectedBody != "" && rr.Body.String() != tc.expectedBody {
+				t.Errorf("handler returned unexpected body: got %v want %v",
+					rr.Body.String(), tc.expectedBody)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/waynecraig/wechat-token-hub/internal/auth"
+	"github.com/waynecraig/wechat-token-hub/internal/redact"
 )
 
 // a middleware function that checks the authorization header for a valid JWT token
@@ -27,12 +28,19 @@ func Auth(next http.Handler) http.Handler {
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
 		// parse and validate the token
-		if err := auth.VerifyJwtToken(tokenString); err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+		principal, err := auth.ParseJwtToken(tokenString)
+		if err != nil {
+			http.Error(w, redact.String(err.Error()), http.StatusUnauthorized)
 			return
 		}
 
-		// call the next handler
-		next.ServeHTTP(w, r)
+		// let the outer middlewares know the client
+		if recorder, ok := w.(*StatusRecorder); ok {
+			recorder.Principal = principal.Subject
+			recorder.KeyID = principal.KeyID
+		}
+
+		// call the next handler with the principal in the context
+		next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), principal)))
 	})
 }
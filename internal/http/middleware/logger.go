@@ -1,14 +1,25 @@
 package middleware
 
 import (
-	"log"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
 	"net/http"
+	"regexp"
 	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/logging"
 )
 
 type StatusRecorder struct {
 	http.ResponseWriter
 	Status int
+	// the authenticated client and the key id of its JWT, set by the Auth
+	// middleware. The client names itself, only the key id is verified.
+	Principal string
+	KeyID     string
+	// the number of bytes of the body written
+	Bytes int
 }
 
 func (r *StatusRecorder) WriteHeader(status int) {
@@ -16,25 +27,71 @@ func (r *StatusRecorder) WriteHeader(status int) {
 	r.ResponseWriter.WriteHeader(status)
 }
 
+func (r *StatusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.Bytes += n
+	return n, err
+}
+
+// Flush sends the buffered body to the client, for the streamed responses
+func (r *StatusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// the request ids accepted from the clients
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// Logger logs every request with slog. Only the path is logged, never the
+// query which may carry the token to rotate.
 func Logger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
+		// use the request id of the client, or generate one
+		requestID := r.Header.Get("X-Request-ID")
+		if !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		fields := &logging.Fields{RequestID: requestID}
+		ctx := logging.NewContext(r.Context(), fields)
+
 		recorder := &StatusRecorder{
 			ResponseWriter: w,
 			Status:         200,
 		}
 
 		// Call the next handler, which can be another middleware in the chain, or the final handler.
-		next.ServeHTTP(recorder, r)
+		next.ServeHTTP(recorder, r.WithContext(ctx))
 
 		// Log the request
-		log.Printf(
-			"%s %s %s %s",
-			r.Method,
-			r.URL.Path,
-			http.StatusText(recorder.Status),
-			time.Since(start),
-		)
+		level := slog.LevelInfo
+		if recorder.Status >= 500 {
+			level = slog.LevelError
+		} else if recorder.Status >= 400 {
+			level = slog.LevelWarn
+		}
+		attrs := []slog.Attr{
+			slog.String("request_id", requestID),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", recorder.Status),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote_addr", r.RemoteAddr),
+			slog.String("principal", recorder.Principal),
+			slog.String("kid", recorder.KeyID),
+			slog.Int("bytes", recorder.Bytes),
+		}
+		attrs = append(attrs, fields.Attrs()...)
+		slog.LogAttrs(ctx, level, "request", attrs...)
 	})
 }
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
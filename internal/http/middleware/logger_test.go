@@ -2,35 +2,101 @@ package middleware
 
 import (
 	"bytes"
-	"fmt"
-	"log"
+	"encoding/json"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"github.com/waynecraig/wechat-token-hub/internal/logging"
 )
 
 func TestLogger(t *testing.T) {
 	var logOutput bytes.Buffer
-	log.SetOutput(&logOutput)
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logOutput, nil)))
 
-	// Create a mock handler
+	// Create a mock handler which reads a credential from the cache
 	mockHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).CacheHit("access_token")
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
 
 	// Create a mock request and response
-	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req := httptest.NewRequest(http.MethodGet, "/test?rotate_token=secret_token", nil)
+	req.Header.Set("X-Request-ID", "req-1")
 	resp := httptest.NewRecorder()
 
 	// Call the Logger middleware with the mock handler
 	loggerHandler := Logger(mockHandler)
 	loggerHandler.ServeHTTP(resp, req)
 
-	// Assert that the log output matches the expected format
-	expectedLog := fmt.Sprintf("%s %s %s", http.MethodGet, "/test", http.StatusText(http.StatusOK))
-	if !strings.Contains(logOutput.String(), expectedLog) {
-		t.Errorf("Expected log output to contain '%s', but got '%s'", expectedLog, logOutput.String())
+	// Assert that the log output is a json line with the expected fields
+	var entry map[string]any
+	if err := json.Unmarshal(logOutput.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected log output to be json, but got '%s'", logOutput.String())
+	}
+	expected := map[string]any{
+		"msg":        "request",
+		"request_id": "req-1",
+		"method":     http.MethodGet,
+		"path":       "/test",
+		"status":     float64(http.StatusOK),
+		"bytes":      float64(2),
+	}
+	for k, v := range expected {
+		if entry[k] != v {
+			t.Errorf("Expected log field %s to be %v, but got %v", k, v, entry[k])
+		}
+	}
+	if cache, ok := entry["cache"].(map[string]any); !ok || cache["access_token"] != "hit" {
+		t.Errorf("Expected log field cache to record the hit, but got %v", entry["cache"])
+	}
+
+	// Assert that the query is never logged
+	if strings.Contains(logOutput.String(), "secret_token") {
+		t.Errorf("Expected log output not to contain the query, but got '%s'", logOutput.String())
+	}
+
+	// Assert that the request id is sent back
+	if id := resp.Header().Get("X-Request-ID"); id != "req-1" {
+		t.Errorf("Expected X-Request-ID to be req-1, but got '%s'", id)
+	}
+}
+
+func TestLoggerRequestID(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&bytes.Buffer{}, nil)))
+
+	handler := Logger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if logging.RequestID(r.Context()) == "" {
+			t.Errorf("Expected the request id in the context")
+		}
+	}))
+
+	// an invalid request id is replaced
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("X-Request-ID", "bad id\n")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	if id := resp.Header().Get("X-Request-ID"); id == "" || id == "bad id\n" {
+		t.Errorf("Expected a generated request id, but got '%s'", id)
+	}
+}
+
+func TestStatusRecorderFlush(t *testing.T) {
+	resp := httptest.NewRecorder()
+	var w http.ResponseWriter = &StatusRecorder{ResponseWriter: resp, Status: 200}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		t.Fatal("Expected the recorder to be a flusher")
+	}
+	w.Write([]byte("data: {}\n\n"))
+	flusher.Flush()
+	if !resp.Flushed {
+		t.Errorf("Expected the response to be flushed")
 	}
 }
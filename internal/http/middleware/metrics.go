@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/metrics"
+)
+
+var (
+	httpRequests = metrics.NewCounter("wechat_token_hub_http_requests_total",
+		"The number of http requests.", "route", "status", "client")
+	httpDuration = metrics.NewHistogram("wechat_token_hub_http_request_duration_seconds",
+		"The duration of the http requests.", metrics.DefaultBuckets, "route")
+)
+
+// Metrics counts the requests by route, status and client. The route is
+// resolved by route, usually the pattern of the mux, and the client is the
+// key id of its JWT rather than the subject it chooses, so that neither
+// creates new series at will.
+func Metrics(route func(r *http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		// reuse the recorder of the Logger, so that Auth can set the client
+		recorder, ok := w.(*StatusRecorder)
+		if !ok {
+			recorder = &StatusRecorder{
+				ResponseWriter: w,
+				Status:         200,
+			}
+		}
+
+		next.ServeHTTP(recorder, r)
+
+		name := route(r)
+		httpRequests.Inc(name, strconv.Itoa(recorder.Status), recorder.KeyID)
+		httpDuration.Observe(time.Since(start).Seconds(), name)
+	})
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestMetrics(t *testing.T) {
+	route := func(r *http.Request) string {
+		return "/route"
+	}
+	handler := Logger(Metrics(route, Auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))))
+
+	// Create a JWT token for the client service-a
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"aud": "wechat-token-hub",
+		"sub": "service-a",
+		"exp": time.Now().Add(time.Second * 300).Unix(),
+	})
+	token.Header["kid"] = "key1"
+	os.Setenv("JWT_KEY_key1", "secret1")
+	defer os.Unsetenv("JWT_KEY_key1")
+	tokenString, err := token.SignedString([]byte("secret1"))
+	if err != nil {
+		t.Fatalf("Error creating JWT token: %v", err)
+	}
+
+	// Send an authenticated request and an unauthenticated one
+	req := httptest.NewRequest(http.MethodGet, "/route", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/route", nil))
+
+	if v := httpRequests.Value("/route", "200", "key1"); v != 1 {
+		t.Errorf("Expected 1 request of the key key1, got %v", v)
+	}
+	if v := httpRequests.Value("/route", "200", "service-a"); v != 0 {
+		t.Errorf("Expected the subject not to be a label, got %v", v)
+	}
+	if v := httpRequests.Value("/route", "401", ""); v != 1 {
+		t.Errorf("Expected 1 unauthorized request, got %v", v)
+	}
+}
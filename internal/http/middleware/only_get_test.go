@@ -48,3 +48,26 @@ func TestOnlyGet(t *testing.T) {
 			status, http.StatusOK)
 	}
 }
+
+func TestOnlyGetOrPost(t *testing.T) {
+	handler := OnlyGetOrPost(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		method string
+		status int
+	}{
+		{http.MethodGet, http.StatusOK},
+		{http.MethodPost, http.StatusOK},
+		{http.MethodPut, http.StatusMethodNotAllowed},
+		{http.MethodDelete, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(tt.method, "/access_token", nil))
+		if rr.Code != tt.status {
+			t.Errorf("%s returned wrong status code: got %v want %v", tt.method, rr.Code, tt.status)
+		}
+	}
+}
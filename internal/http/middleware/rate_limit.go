@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/auth"
+	"github.com/waynecraig/wechat-token-hub/internal/policy"
+	"github.com/waynecraig/wechat-token-hub/internal/ratelimit"
+)
+
+// the result of the ip limit in the context of the request, so that the
+// RateLimit middleware reports the most restrictive of the limits
+type ipResultKey struct{}
+
+// IPRateLimit limits the requests of each remote ip with the ip limit of the
+// policy. It must be used before the Auth middleware, so that the requests
+// without a valid JWT are limited too.
+func IPRateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := policy.Current()
+		limit := p.RateLimits.IP
+		if limit == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		result := ratelimit.Shared("ip", limit.PerMinute, limit.Burst).Allow(RemoteIP(r, p.RateLimits.TrustForwardedFor))
+		if !report(w, result) {
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ipResultKey{}, result)))
+	})
+}
+
+// RateLimit limits the requests of each client with the limits of the policy,
+// it must be used after the Auth middleware. The RateLimit-* headers report
+// the most restrictive of the client limit and the ip limit checked by
+// IPRateLimit.
+func RateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := policy.Current()
+
+		var results []ratelimit.Result
+		// the clients are limited by the key id of their JWT, since they may
+		// put any subject in the tokens they sign
+		if principal := auth.FromContext(r.Context()); principal != nil {
+			if limit := p.ClientLimit(principal.KeyID); limit != nil {
+				// clients with their own limit don't share the buckets of the default limit
+				limiter := ratelimit.Shared("client_"+principal.KeyID, limit.PerMinute, limit.Burst)
+				results = append(results, limiter.Allow(principal.KeyID))
+			}
+		}
+		if len(results) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if ipResult, ok := r.Context().Value(ipResultKey{}).(ratelimit.Result); ok {
+			results = append(results, ipResult)
+		}
+
+		// report the limit with the fewest remaining requests, or the one
+		// which refused the request
+		result := results[0]
+		for _, res := range results[1:] {
+			if (!res.Allowed && (result.Allowed || res.RetryAfter > result.RetryAfter)) ||
+				(res.Allowed == result.Allowed && res.Remaining < result.Remaining) {
+				result = res
+			}
+		}
+		if !report(w, result) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// set the RateLimit-* headers of the result, and refuse the request if it's
+// not allowed. Returns whether the request may go on.
+func report(w http.ResponseWriter, result ratelimit.Result) bool {
+	header := w.Header()
+	header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+
+	if !result.Allowed {
+		header.Set("Retry-After", strconv.Itoa(seconds(result.RetryAfter)))
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// RemoteIP returns the ip of the client, from X-Forwarded-For if it's trusted
+func RemoteIP(r *http.Request, trustForwardedFor bool) string {
+	if trustForwardedFor {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// round up to whole seconds, so that the client doesn't retry too early
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
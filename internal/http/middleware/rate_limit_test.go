@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/waynecraig/wechat-token-hub/internal/auth"
+	"github.com/waynecraig/wechat-token-hub/internal/policy"
+)
+
+func TestRateLimit(t *testing.T) {
+	policy.Set(&policy.Policy{RateLimits: policy.RateLimits{
+		Client:  &policy.Limit{PerMinute: 1, Burst: 2},
+		Clients: map[string]*policy.Limit{"trusted": nil},
+		IP:      &policy.Limit{PerMinute: 1, Burst: 3},
+	}})
+	defer policy.Set(&policy.Policy{})
+
+	// the ip limit is checked before the client is authenticated
+	var handler http.Handler
+	handler = RateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	handler = IPRateLimit(authenticate(handler))
+	request := func(kid string, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/access_token", nil)
+		req.RemoteAddr = remoteAddr
+		if kid != "" {
+			req.Header.Set("X-Kid", kid)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// the client limit is the most restrictive
+	rr := request("rl-service-a", "10.0.0.1:1234")
+	if rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Limit") != "2" || rr.Header().Get("RateLimit-Remaining") != "1" {
+		t.Errorf("got status %d and headers %v, want 200 with 1 of 2 remaining", rr.Code, rr.Header())
+	}
+	request("rl-service-a", "10.0.0.1:1234")
+
+	// the third request of the client is refused, although the subject of
+	// each of its requests is different
+	rr = request("rl-service-a", "10.0.0.1:1234")
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "60" {
+		t.Errorf("got status %d and headers %v, want 429 with Retry-After 60", rr.Code, rr.Header())
+	}
+
+	// the ip limit applies to the clients without limit
+	rr = request("trusted", "10.0.0.1:1234")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("got status %d, want 429 from the ip limit", rr.Code)
+	}
+	rr = request("trusted", "10.0.0.2:1234")
+	if rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Remaining") != "2" {
+		t.Errorf("got status %d and headers %v, want 200 with 2 remaining", rr.Code, rr.Header())
+	}
+
+	// and to the requests which are not authenticated
+	request("", "10.0.0.3:1234")
+	request("", "10.0.0.3:1234")
+	request("", "10.0.0.3:1234")
+	rr = request("", "10.0.0.3:1234")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("got status %d, want 429 from the ip limit before the authentication", rr.Code)
+	}
+}
+
+// a stand-in for the Auth middleware, the X-Kid header is the key id of the
+// principal, which gets a new subject with each request like a client minting
+// tokens at will. The requests without it are refused.
+func authenticate(next http.Handler) http.Handler {
+	var requests int
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kid := r.Header.Get("X-Kid")
+		if kid == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		requests++
+		principal := &auth.Principal{Subject: kid + "-" + strconv.Itoa(requests), KeyID: kid}
+		next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), principal)))
+	})
+}
+
+func TestRemoteIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4, 10.0.0.1")
+
+	if ip := RemoteIP(req, false); ip != "10.0.0.1" {
+		t.Errorf("RemoteIP() = %s, want 10.0.0.1", ip)
+	}
+	if ip := RemoteIP(req, true); ip != "1.2.3.4" {
+		t.Errorf("RemoteIP() = %s, want 1.2.3.4", ip)
+	}
+}
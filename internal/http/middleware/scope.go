@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/waynecraig/wechat-token-hub/internal/auth"
+)
+
+// RequireScope only lets the principals granted the scope through, it must be
+// used after the Auth middleware
+func RequireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !auth.FromContext(r.Context()).HasScope(scope) {
+			http.Error(w, "Scope "+scope+" required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
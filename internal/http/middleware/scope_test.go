@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/waynecraig/wechat-token-hub/internal/auth"
+)
+
+func TestRequireScope(t *testing.T) {
+	handler := RequireScope("admin", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	testCases := []struct {
+		name           string
+		principal      *auth.Principal
+		expectedStatus int
+	}{
+		{"no principal", nil, http.StatusForbidden},
+		{"without scope", &auth.Principal{Subject: "service-a"}, http.StatusForbidden},
+		{"with scope", &auth.Principal{Subject: "operator", Scopes: []string{"admin"}}, http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			if tc.principal != nil {
+				req = req.WithContext(auth.NewContext(req.Context(), tc.principal))
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tc.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v",
+					status, tc.expectedStatus)
+			}
+		})
+	}
+}
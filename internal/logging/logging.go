@@ -0,0 +1,133 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/redact"
+)
+
+// Setup makes the default logger write to w at the level, in the "json" or
+// "text" format. The log package is redirected to it as well. The secrets
+// and credentials are redacted from every record.
+func Setup(w io.Writer, level string, format string) error {
+	var l slog.Level
+	if level != "" {
+		if err := l.UnmarshalText([]byte(level)); err != nil {
+			return fmt.Errorf("invalid log level %q", level)
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: l}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "", "json":
+		handler = slog.NewJSONHandler(w, opts)
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return fmt.Errorf("invalid log format %q", format)
+	}
+
+	slog.SetDefault(slog.New(redact.NewHandler(handler)))
+	return nil
+}
+
+// Fields are the details of a request collected while it's handled, such as
+// whether the credentials came from the cache
+type Fields struct {
+	RequestID string
+
+	mu       sync.Mutex
+	cache    map[string]string
+	upstream time.Duration
+}
+
+type fieldsKey struct{}
+
+// NewContext returns a copy of ctx carrying the fields
+func NewContext(ctx context.Context, f *Fields) context.Context {
+	return context.WithValue(ctx, fieldsKey{}, f)
+}
+
+// FromContext returns the fields of the request, or nil outside a request.
+// The methods of Fields can be called on nil.
+func FromContext(ctx context.Context) *Fields {
+	f, _ := ctx.Value(fieldsKey{}).(*Fields)
+	return f
+}
+
+// RequestID returns the id of the request in ctx, or an empty string
+func RequestID(ctx context.Context) string {
+	if f := FromContext(ctx); f != nil {
+		return f.RequestID
+	}
+	return ""
+}
+
+// CacheHit records that the credential of key was served from the cache
+func (f *Fields) CacheHit(key string) {
+	f.setCache(key, "hit")
+}
+
+// CacheMiss records that the credential of key was fetched from upstream
+func (f *Fields) CacheMiss(key string) {
+	f.setCache(key, "miss")
+}
+
+func (f *Fields) setCache(key string, result string) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.cache == nil {
+		f.cache = make(map[string]string)
+	}
+	f.cache[key] = result
+}
+
+// AddUpstream adds the time spent waiting for upstream
+func (f *Fields) AddUpstream(d time.Duration) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.upstream += d
+}
+
+// Attrs returns the collected fields as log attributes
+func (f *Fields) Attrs() []slog.Attr {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var attrs []slog.Attr
+	if len(f.cache) > 0 {
+		keys := make([]string, 0, len(f.cache))
+		for key := range f.cache {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		cache := make([]any, 0, len(keys))
+		for _, key := range keys {
+			cache = append(cache, slog.String(key, f.cache[key]))
+		}
+		attrs = append(attrs, slog.Group("cache", cache...))
+	}
+	if f.upstream > 0 {
+		attrs = append(attrs, slog.Duration("upstream", f.upstream))
+	}
+	return attrs
+}
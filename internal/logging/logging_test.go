@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetup(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	// test the json format and the level
+	var buf bytes.Buffer
+	if err := Setup(&buf, "warn", "json"); err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	slog.Info("hidden")
+	slog.Warn("shown", "key", "value")
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected one json line, got %s", buf.String())
+	}
+	if entry["msg"] != "shown" || entry["key"] != "value" {
+		t.Errorf("Unexpected log entry: %v", entry)
+	}
+
+	// test the text format and the redirection of the log package
+	buf.Reset()
+	if err := Setup(&buf, "", "text"); err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	log.Printf("from log")
+	if !strings.Contains(buf.String(), `msg="from log"`) {
+		t.Errorf("Expected the log package to be redirected, got %s", buf.String())
+	}
+
+	// test the redaction of secrets
+	buf.Reset()
+	slog.Error("fetch fail", "err", "Get https://api.weixin.qq.com/cgi-bin/token?secret=leaked_app_secret")
+	if strings.Contains(buf.String(), "leaked_app_secret") {
+		t.Errorf("Expected the secret to be redacted, got %s", buf.String())
+	}
+
+	// test invalid settings
+	if err := Setup(&buf, "verbose", "json"); err == nil {
+		t.Errorf("Setup() accepted an invalid level")
+	}
+	if err := Setup(&buf, "info", "xml"); err == nil {
+		t.Errorf("Setup() accepted an invalid format")
+	}
+}
+
+func TestFields(t *testing.T) {
+	// the methods can be called outside a request
+	var empty *Fields
+	empty.CacheHit("access_token")
+	if attrs := FromContext(context.Background()).Attrs(); attrs != nil {
+		t.Errorf("Attrs() = %v, want nil", attrs)
+	}
+
+	f := &Fields{RequestID: "req1"}
+	ctx := NewContext(context.Background(), f)
+	FromContext(ctx).CacheMiss("ticket_jsapi")
+	FromContext(ctx).CacheHit("access_token")
+	FromContext(ctx).AddUpstream(100 * time.Millisecond)
+
+	if id := RequestID(ctx); id != "req1" {
+		t.Errorf("RequestID() = %s, want req1", id)
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	logger.LogAttrs(ctx, slog.LevelInfo, "request", f.Attrs()...)
+	for _, want := range []string{`"cache":{"access_token":"hit","ticket_jsapi":"miss"}`, `"upstream":100000000`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected log to contain %s, got %s", want, buf.String())
+		}
+	}
+}
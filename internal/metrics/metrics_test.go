@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCounter(t *testing.T) {
+	c := NewCounter("test_requests_total", "The number of requests.", "route", "status")
+	c.Inc("/a", "200")
+	c.Inc("/a", "200")
+	c.Add(3, "/b", "500")
+
+	if v := c.Value("/a", "200"); v != 2 {
+		t.Errorf("Value() = %v, want 2", v)
+	}
+
+	var buf bytes.Buffer
+	WriteTo(&buf)
+	for _, line := range []string{
+		"# HELP test_requests_total The number of requests.",
+		"# TYPE test_requests_total counter",
+		`test_requests_total{route="/a",status="200"} 2`,
+		`test_requests_total{route="/b",status="500"} 3`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("Expected output to contain %q, but got %s", line, buf.String())
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram("test_duration_seconds", "The duration.", []float64{0.1, 1}, "name")
+	h.Observe(0.05, "x")
+	h.Observe(0.5, "x")
+	h.Observe(5, "x")
+
+	var buf bytes.Buffer
+	WriteTo(&buf)
+	for _, line := range []string{
+		"# TYPE test_duration_seconds histogram",
+		`test_duration_seconds_bucket{name="x",le="0.1"} 1`,
+		`test_duration_seconds_bucket{name="x",le="1"} 2`,
+		`test_duration_seconds_bucket{name="x",le="+Inf"} 3`,
+		`test_duration_seconds_sum{name="x"} 5.55`,
+		`test_duration_seconds_count{name="x"} 3`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("Expected output to contain %q, but got %s", line, buf.String())
+		}
+	}
+}
+
+func TestGaugeFunc(t *testing.T) {
+	NewGaugeFunc("test_expiry_seconds", "The expiry.", "credential", func() map[string]float64 {
+		return map[string]float64{"a\"b": 10}
+	})
+
+	// the metrics should be served over http
+	rr := httptest.NewRecorder()
+	Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(rr.Body.String(), `test_expiry_seconds{credential="a\"b"} 10`+"\n") {
+		t.Errorf("Expected output to contain the gauge, but got %s", rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Expected text/plain content type, got %s", ct)
+	}
+}
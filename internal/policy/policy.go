@@ -0,0 +1,191 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Policy is the access policy of the clients, loaded from the json file at POLICY_FILE
+type Policy struct {
+	RateLimits RateLimits `json:"rate_limits"`
+	// the WeChat APIs the clients may call through the proxy, every call is
+	// allowed if it's not set
+	Proxy *Proxy `json:"proxy"`
+}
+
+// RateLimits are the request rate limits, a nil limit means no limit
+type RateLimits struct {
+	// the default limit of each client
+	Client *Limit `json:"client"`
+	// the limits of some clients by the key id of their JWT, overriding the default
+	Clients map[string]*Limit `json:"clients"`
+	// the limit of each remote ip
+	IP *Limit `json:"ip"`
+	// use the first address in X-Forwarded-For as the remote ip, only set it
+	// behind a proxy which overwrites the header
+	TrustForwardedFor bool `json:"trust_forwarded_for"`
+}
+
+// Limit is a token bucket limit
+type Limit struct {
+	PerMinute float64 `json:"per_minute"`
+	Burst     int     `json:"burst"`
+}
+
+// Proxy lists the WeChat APIs each client may call through the proxy, a call
+// is allowed if it matches one of the rules of the client
+type Proxy struct {
+	// the rules of some clients by the key id of their JWT
+	Clients map[string][]ProxyRule `json:"clients"`
+	// the rules of the clients which are not listed
+	Default []ProxyRule `json:"default"`
+}
+
+// ProxyRule allows the calls to the paths with the methods for the appids,
+// an empty list matches anything
+type ProxyRule struct {
+	AppIDs  []string `json:"appids"`
+	Methods []string `json:"methods"`
+	// the patterns of the paths, such as /cgi-bin/message/template/*, where a
+	// * matches any part of the path between two slashes
+	Paths []string `json:"paths"`
+}
+
+var (
+	mu      sync.RWMutex
+	current = &Policy{}
+)
+
+// Current returns the policy in use, an empty policy if none is loaded
+func Current() *Policy {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return current
+}
+
+// Set replaces the policy in use
+func Set(p *Policy) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	current = p
+}
+
+// Load reads the policy from the file and uses it
+func Load(path string) error {
+	p, err := Parse(path)
+	if err != nil {
+		return err
+	}
+	Set(p)
+	return nil
+}
+
+// Parse reads the policy from the file without using it
+func Parse(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &Policy{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// check the rate limits and the path patterns, so that a typo doesn't deny
+// every request
+func (p *Policy) validate() error {
+	limits := map[string]*Limit{"client": p.RateLimits.Client, "ip": p.RateLimits.IP}
+	for kid, limit := range p.RateLimits.Clients {
+		limits["clients."+kid] = limit
+	}
+	for name, limit := range limits {
+		if limit == nil {
+			continue
+		}
+		if limit.PerMinute <= 0 || limit.Burst < 0 {
+			return fmt.Errorf("invalid rate limit %s: per_minute must be positive and burst not negative", name)
+		}
+		// a burst which is not set allows a minute of requests at once
+		if limit.Burst == 0 {
+			limit.Burst = int(math.Ceil(limit.PerMinute))
+		}
+	}
+
+	if p.Proxy == nil {
+		return nil
+	}
+	rules := p.Proxy.Default
+	for _, clientRules := range p.Proxy.Clients {
+		rules = append(rules, clientRules...)
+	}
+	for _, rule := range rules {
+		for _, pattern := range rule.Paths {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid proxy path %q: %w", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ClientLimit returns the rate limit of the client with the key id, or nil if
+// it's not limited
+func (p *Policy) ClientLimit(kid string) *Limit {
+	if limit, ok := p.RateLimits.Clients[kid]; ok {
+		return limit
+	}
+	return p.RateLimits.Client
+}
+
+// AllowProxy returns an error telling why the client with the key id may not
+// call the WeChat API at the path with the method for the appid, or nil if it may
+func (p *Policy) AllowProxy(kid string, appid string, method string, apiPath string) error {
+	if p.Proxy == nil {
+		return nil
+	}
+
+	rules, ok := p.Proxy.Clients[kid]
+	if !ok {
+		rules = p.Proxy.Default
+	}
+	for _, rule := range rules {
+		if rule.allows(appid, method, apiPath) {
+			return nil
+		}
+	}
+	return fmt.Errorf("client %s may not call %s %s of %s", kid, method, apiPath, appid)
+}
+
+func (r ProxyRule) allows(appid string, method string, apiPath string) bool {
+	return matchAny(r.AppIDs, func(a string) bool { return a == "*" || a == appid }) &&
+		matchAny(r.Methods, func(m string) bool { return strings.EqualFold(m, method) }) &&
+		matchAny(r.Paths, func(pattern string) bool {
+			ok, _ := path.Match(pattern, apiPath)
+			return ok
+		})
+}
+
+// report whether one of the values matches, an empty list matches anything
+func matchAny(values []string, match func(string) bool) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if match(v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	err := os.WriteFile(path, []byte(`{
+		"rate_limits": {
+			"client": {"per_minute": 600, "burst": 60},
+			"clients": {"batch-job": {"per_minute": 60, "burst": 5}, "trusted": null},
+			"ip": {"per_minute": 1200, "burst": 100}
+		}
+	}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Load(path); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	defer Set(&Policy{})
+
+	p := Current()
+	if limit := p.ClientLimit("service-a"); limit == nil || limit.PerMinute != 600 {
+		t.Errorf("ClientLimit(service-a) = %+v, want the default limit", limit)
+	}
+	if limit := p.ClientLimit("batch-job"); limit == nil || limit.PerMinute != 60 || limit.Burst != 5 {
+		t.Errorf("ClientLimit(batch-job) = %+v, want the overridden limit", limit)
+	}
+	if limit := p.ClientLimit("trusted"); limit != nil {
+		t.Errorf("ClientLimit(trusted) = %+v, want no limit", limit)
+	}
+	if p.RateLimits.IP == nil || p.RateLimits.IP.Burst != 100 {
+		t.Errorf("IP limit = %+v, want burst 100", p.RateLimits.IP)
+	}
+
+	// invalid files are rejected and the policy is kept
+	os.WriteFile(path, []byte(`{`), 0600)
+	if err := Load(path); err == nil {
+		t.Errorf("Load() accepted an invalid file")
+	}
+	if Current() != p {
+		t.Errorf("Load() replaced the policy with an invalid one")
+	}
+}
+
+func TestAllowProxy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	os.WriteFile(path, []byte(`{
+		"proxy": {
+			"clients": {
+				"notifier": [{"appids": ["wx1"], "methods": ["POST"], "paths": ["/cgi-bin/message/template/*"]}],
+				"admin-tool": [{}]
+			},
+			"default": [{"methods": ["GET"], "paths": ["/cgi-bin/user/info"]}]
+		}
+	}`), 0600)
+	p, err := Parse(path)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	testCases := []struct {
+		name    string
+		subject string
+		appid   string
+		method  string
+		path    string
+		allowed bool
+	}{
+		{name: "Allowed", subject: "notifier", appid: "wx1", method: "POST", path: "/cgi-bin/message/template/send", allowed: true},
+		{name: "Other path", subject: "notifier", appid: "wx1", method: "POST", path: "/cgi-bin/menu/create"},
+		{name: "Nested path", subject: "notifier", appid: "wx1", method: "POST", path: "/cgi-bin/message/template/send/more"},
+		{name: "Other method", subject: "notifier", appid: "wx1", method: "GET", path: "/cgi-bin/message/template/send"},
+		{name: "Other appid", subject: "notifier", appid: "wx2", method: "POST", path: "/cgi-bin/message/template/send"},
+		{name: "Everything", subject: "admin-tool", appid: "wx2", method: "POST", path: "/cgi-bin/menu/create", allowed: true},
+		{name: "Default", subject: "service-a", appid: "wx2", method: "get", path: "/cgi-bin/user/info", allowed: true},
+		{name: "Default denied", subject: "service-a", appid: "wx2", method: "POST", path: "/cgi-bin/user/info"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := p.AllowProxy(tc.subject, tc.appid, tc.method, tc.path)
+			if (err == nil) != tc.allowed {
+				t.Errorf("AllowProxy() error = %v, want allowed %v", err, tc.allowed)
+			}
+		})
+	}
+
+	// without the proxy rules every call is allowed
+	if err := (&Policy{}).AllowProxy("service-a", "wx1", "POST", "/cgi-bin/menu/create"); err != nil {
+		t.Errorf("AllowProxy() error = %v", err)
+	}
+
+	// invalid patterns are rejected
+	os.WriteFile(path, []byte(`{"proxy": {"default": [{"paths": ["/cgi-bin/[menu"]}]}}`), 0600)
+	if _, err := Parse(path); err == nil {
+		t.Errorf("Parse() accepted an invalid path pattern")
+	}
+}
+
+func TestRateLimitsValidation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+
+	// a burst which is not set defaults to the requests of a minute
+	os.WriteFile(path, []byte(`{"rate_limits": {"client": {"per_minute": 0.5}, "ip": {"per_minute": 90}}}`), 0600)
+	p, err := Parse(path)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if p.RateLimits.Client.Burst != 1 || p.RateLimits.IP.Burst != 90 {
+		t.Errorf("Burst = %d and %d, want 1 and 90", p.RateLimits.Client.Burst, p.RateLimits.IP.Burst)
+	}
+
+	testCases := []struct {
+		name   string
+		policy string
+	}{
+		{name: "Zero per minute", policy: `{"rate_limits": {"client": {"burst": 10}}}`},
+		{name: "Negative per minute", policy: `{"rate_limits": {"ip": {"per_minute": -1, "burst": 10}}}`},
+		{name: "Negative burst", policy: `{"rate_limits": {"clients": {"batch-job": {"per_minute": 60, "burst": -1}}}}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			os.WriteFile(path, []byte(tc.policy), 0600)
+			if _, err := Parse(path); err == nil {
+				t.Errorf("Parse() accepted an invalid rate limit")
+			}
+		})
+	}
+}
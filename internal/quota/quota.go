@@ -0,0 +1,196 @@
+package quota
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/store"
+)
+
+// the store key of the counters, so that they survive a restart
+const storeKey = "quota"
+
+// the rolling window is made of hourly buckets
+const windowHours = 24
+
+// wechat allows 2000 calls a day to cgi-bin/token by default
+const defaultDailyLimit = 2000
+
+// rotations are refused when 90% of the daily limit is used by default
+const defaultRotateThreshold = 0.9
+
+// the counters are saved to the store at most once in this interval, rather
+// than rewriting the store on every upstream call. The calls of the last
+// interval are lost if the process is killed.
+var flushInterval = 10 * time.Second
+
+// Usage is the number of upstream calls of an account to an API in the last 24 hours
+type Usage struct {
+	Key       string `json:"key"`
+	Used      int    `json:"used"`
+	Limit     int    `json:"limit"`
+	Remaining int    `json:"remaining"`
+}
+
+type bucket struct {
+	Hour  int64 `json:"hour"`
+	Count int   `json:"count"`
+}
+
+var (
+	mu       sync.Mutex
+	counters map[string][]bucket
+	now      = time.Now
+	// the pending save of the counters, nil if they are saved
+	flushTimer *time.Timer
+)
+
+// Record counts one upstream call of the key, such as the calls of an
+// account to an API
+func Record(key string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	load()
+	hour := now().Unix() / 3600
+	buckets := prune(counters[key], hour)
+	if len(buckets) > 0 && buckets[len(buckets)-1].Hour == hour {
+		buckets[len(buckets)-1].Count++
+	} else {
+		buckets = append(buckets, bucket{Hour: hour, Count: 1})
+	}
+	counters[key] = buckets
+	if flushTimer == nil {
+		flushTimer = time.AfterFunc(flushInterval, Flush)
+	}
+}
+
+// Flush saves the counters to the store now, instead of at the end of the
+// flush interval
+func Flush() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if flushTimer != nil {
+		flushTimer.Stop()
+		flushTimer = nil
+	}
+	if counters != nil {
+		save()
+	}
+}
+
+// Used returns the number of upstream calls of key in the last 24 hours
+func Used(key string) int {
+	mu.Lock()
+	defer mu.Unlock()
+
+	load()
+	return used(key)
+}
+
+// Exceeded reports whether the calls of key have reached the rotate threshold,
+// after which rotations should be refused to keep the remaining budget for
+// the refreshes of expired credentials
+func Exceeded(key string) bool {
+	return float64(Used(key)) >= float64(DailyLimit())*rotateThreshold()
+}
+
+// Usages returns the usage of every key which was counted in the last 24 hours
+func Usages() []Usage {
+	mu.Lock()
+	defer mu.Unlock()
+
+	load()
+	limit := DailyLimit()
+	usages := []Usage{}
+	for key := range counters {
+		n := used(key)
+		if n == 0 {
+			continue
+		}
+		remaining := limit - n
+		if remaining < 0 {
+			remaining = 0
+		}
+		usages = append(usages, Usage{Key: key, Used: n, Limit: limit, Remaining: remaining})
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].Key < usages[j].Key
+	})
+	return usages
+}
+
+// Reset clears the counters of the keys, after the quota is cleared upstream
+func Reset(keys ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	load()
+	for _, key := range keys {
+		delete(counters, key)
+	}
+	save()
+}
+
+// DailyLimit returns the daily limit set in QUOTA_DAILY_LIMIT
+func DailyLimit() int {
+	limit, err := strconv.Atoi(os.Getenv("QUOTA_DAILY_LIMIT"))
+	if err != nil || limit <= 0 {
+		return defaultDailyLimit
+	}
+	return limit
+}
+
+// the fraction of the daily limit set in QUOTA_ROTATE_THRESHOLD
+func rotateThreshold() float64 {
+	threshold, err := strconv.ParseFloat(os.Getenv("QUOTA_ROTATE_THRESHOLD"), 64)
+	if err != nil || threshold <= 0 {
+		return defaultRotateThreshold
+	}
+	return threshold
+}
+
+func used(key string) int {
+	n := 0
+	for _, b := range prune(counters[key], now().Unix()/3600) {
+		n += b.Count
+	}
+	return n
+}
+
+// drop the buckets which are out of the window
+func prune(buckets []bucket, hour int64) []bucket {
+	for len(buckets) > 0 && buckets[0].Hour <= hour-windowHours {
+		buckets = buckets[1:]
+	}
+	return buckets
+}
+
+// load the counters from the store on first use
+func load() {
+	if counters != nil {
+		return
+	}
+	counters = make(map[string][]bucket)
+	if data := store.Get(storeKey); data != "" {
+		if err := json.Unmarshal([]byte(data), &counters); err != nil {
+			slog.Error("load quota fail", "error", err)
+		}
+	}
+}
+
+func save() {
+	data, err := json.Marshal(counters)
+	if err == nil {
+		err = store.Save(storeKey, string(data))
+	}
+	if err != nil {
+		slog.Error("save quota fail", "error", err)
+	}
+}
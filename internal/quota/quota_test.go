@@ -0,0 +1,68 @@
+package quota
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/store"
+)
+
+func TestQuota(t *testing.T) {
+	os.Setenv("QUOTA_DAILY_LIMIT", "10")
+	os.Setenv("QUOTA_ROTATE_THRESHOLD", "0.5")
+	defer os.Unsetenv("QUOTA_DAILY_LIMIT")
+	defer os.Unsetenv("QUOTA_ROTATE_THRESHOLD")
+
+	// freeze the clock
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return start }
+	defer func() { now = time.Now }()
+
+	for i := 0; i < 4; i++ {
+		Record("access_token")
+	}
+	if n := Used("access_token"); n != 4 {
+		t.Errorf("Used() = %d, want 4", n)
+	}
+	if Exceeded("access_token") {
+		t.Errorf("Exceeded() = true with 4 of 10 calls used")
+	}
+
+	// the counters are persisted once flushed, not on every call
+	if store.Get(storeKey) != "" {
+		t.Errorf("Expected the counters to be saved at the end of the flush interval, got %s", store.Get(storeKey))
+	}
+	Flush()
+	counters = nil
+	if n := Used("access_token"); n != 4 {
+		t.Errorf("Used() after reload = %d, want 4", n)
+	}
+
+	// calls in a later hour are added to the window
+	now = func() time.Time { return start.Add(2 * time.Hour) }
+	Record("access_token")
+	if !Exceeded("access_token") {
+		t.Errorf("Exceeded() = false with 5 of 10 calls used")
+	}
+
+	usages := Usages()
+	if len(usages) != 1 || usages[0].Used != 5 || usages[0].Remaining != 5 || usages[0].Limit != 10 {
+		t.Errorf("Usages() = %+v, want 5 used and 5 remaining", usages)
+	}
+
+	// the calls older than 24 hours are dropped
+	now = func() time.Time { return start.Add(25 * time.Hour) }
+	if n := Used("access_token"); n != 1 {
+		t.Errorf("Used() after a day = %d, want 1", n)
+	}
+
+	// the counters can be reset
+	Reset("access_token")
+	if n := Used("access_token"); n != 0 {
+		t.Errorf("Used() after reset = %d, want 0", n)
+	}
+	if store.Get(storeKey) != "{}" {
+		t.Errorf("Expected the reset to be persisted, got %s", store.Get(storeKey))
+	}
+}
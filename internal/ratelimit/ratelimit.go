@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// the buckets which are full are dropped when there are more than this many
+const maxBuckets = 10000
+
+// Limiter is a token bucket rate limiter with one bucket for each key
+type Limiter struct {
+	// tokens added per second
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Result is the outcome of a call to Allow
+type Result struct {
+	Allowed bool
+	// the size of the bucket
+	Limit int
+	// the tokens left after this call
+	Remaining int
+	// how long to wait before the next call is allowed, zero if allowed
+	RetryAfter time.Duration
+	// how long until the bucket is full again
+	Reset time.Duration
+}
+
+// New returns a limiter allowing perMinute calls a minute for each key, with
+// bursts of up to burst calls
+func New(perMinute float64, burst int) *Limiter {
+	return &Limiter{
+		rate:    perMinute / 60,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the bucket of key if there is one
+func (l *Limiter) Allow(key string) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxBuckets {
+			l.prune(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	// refill the bucket for the time passed
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	result := Result{Limit: int(l.burst)}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = l.duration(1 - b.tokens)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = l.duration(l.burst - b.tokens)
+
+	return result
+}
+
+// the time to refill n tokens
+func (l *Limiter) duration(n float64) time.Duration {
+	if l.rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(n / l.rate * float64(time.Second))
+}
+
+// drop the buckets which would be full by now
+func (l *Limiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// the shared limiters, rebuilt when their limits change
+var (
+	sharedMu sync.Mutex
+	shared   = make(map[string]*sharedLimiter)
+)
+
+type sharedLimiter struct {
+	perMinute float64
+	burst     int
+	limiter   *Limiter
+}
+
+// Shared returns the limiter named name, so that the limits read from the
+// configuration on each request keep their buckets until they are changed
+func Shared(name string, perMinute float64, burst int) *Limiter {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+
+	s, ok := shared[name]
+	if !ok || s.perMinute != perMinute || s.burst != burst {
+		s = &sharedLimiter{perMinute: perMinute, burst: burst, limiter: New(perMinute, burst)}
+		shared[name] = s
+	}
+	return s.limiter
+}
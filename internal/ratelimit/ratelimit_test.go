@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	// 6 calls a minute is one every 10 seconds
+	l := New(6, 2)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return start }
+
+	// the burst is allowed
+	for i := 0; i < 2; i++ {
+		if result := l.Allow("a"); !result.Allowed || result.Remaining != 1-i {
+			t.Errorf("Allow() = %+v, want allowed with %d remaining", result, 1-i)
+		}
+	}
+
+	// the next call is limited
+	result := l.Allow("a")
+	if result.Allowed {
+		t.Errorf("Allow() = %+v, want limited", result)
+	}
+	if result.RetryAfter != 10*time.Second || result.Reset != 20*time.Second || result.Limit != 2 {
+		t.Errorf("Allow() = %+v, want retry after 10s and reset after 20s", result)
+	}
+
+	// other keys have their own bucket
+	if result := l.Allow("b"); !result.Allowed {
+		t.Errorf("Allow() = %+v, want allowed for another key", result)
+	}
+
+	// a token is added after 10 seconds
+	l.now = func() time.Time { return start.Add(10 * time.Second) }
+	if result := l.Allow("a"); !result.Allowed {
+		t.Errorf("Allow() = %+v, want allowed after 10 seconds", result)
+	}
+	if result := l.Allow("a"); result.Allowed {
+		t.Errorf("Allow() = %+v, want limited", result)
+	}
+}
+
+func TestLimiterPrune(t *testing.T) {
+	l := New(60, 1)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return start }
+	l.Allow("a")
+
+	// the bucket of a is full again after a second and can be dropped
+	l.now = func() time.Time { return start.Add(time.Second) }
+	l.prune(l.now())
+	if len(l.buckets) != 0 {
+		t.Errorf("Expected the full bucket to be dropped, got %d buckets", len(l.buckets))
+	}
+}
+
+func TestShared(t *testing.T) {
+	// the same limits share the limiter
+	l := Shared("test", 1, 1)
+	if Shared("test", 1, 1) != l {
+		t.Errorf("Shared() returned a new limiter for the same limits")
+	}
+
+	// new limits rebuild the limiter
+	if Shared("test", 2, 1) == l {
+		t.Errorf("Shared() returned the old limiter for new limits")
+	}
+}
@@ -0,0 +1,145 @@
+package redact
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Replacement is written in place of the redacted values
+const Replacement = "[REDACTED]"
+
+// values shorter than this are not registered, so that common words are not
+// redacted by mistake
+const minLength = 8
+
+// the query parameters and json fields which carry secrets or credentials
+var (
+	queryPattern = regexp.MustCompile(`(?i)\b((?:app|corp|component_app)?secret|(?:component_|authorizer_|rotate_)?access_token|(?:authorizer_)?refresh_token|rotate_token|rotate_ticket|ticket|component_verify_ticket|session_key|js_code|code)=([^&\s"']+)`)
+	jsonPattern  = regexp.MustCompile(`(?i)"((?:app|corp|component_app)?secret|(?:component_|authorizer_)?access_token|(?:authorizer_)?refresh_token|ticket|component_verify_ticket|session_key)"\s*:\s*"([^"]*)"`)
+)
+
+// the env vars whose values are secrets
+var secretEnvPrefixes = []string{"APPSECRET", "WECOM_SECRET_", "COMPONENT_APPSECRET", "COMPONENT_TOKEN", "COMPONENT_ENCODING_AES_KEY", "JWT_KEY_", "VAULT_TOKEN", "MASTER_KEY", "WEBHOOK_SECRET"}
+
+// the known secret values, with the time they can be forgotten
+var (
+	mu     sync.RWMutex
+	values = make(map[string]time.Time)
+)
+
+// Register adds secret values to redact until ttl has passed, a ttl of zero
+// means forever
+func Register(ttl time.Duration, secrets ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now()
+	for value, expiration := range values {
+		if !expiration.IsZero() && expiration.Before(now) {
+			delete(values, value)
+		}
+	}
+
+	var expiration time.Time
+	if ttl > 0 {
+		expiration = now.Add(ttl)
+	}
+	for _, secret := range secrets {
+		if len(secret) >= minLength {
+			values[secret] = expiration
+		}
+	}
+}
+
+// RegisterEnv adds the values of the secret env vars, such as APPSECRET and JWT_KEY_{kid}
+func RegisterEnv() {
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		for _, prefix := range secretEnvPrefixes {
+			if strings.HasPrefix(name, prefix) {
+				Register(0, value)
+			}
+		}
+	}
+}
+
+// String removes the secrets, credentials and known secret values from s
+func String(s string) string {
+	s = queryPattern.ReplaceAllString(s, "$1="+Replacement)
+	s = jsonPattern.ReplaceAllString(s, `"$1":"`+Replacement+`"`)
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for value := range values {
+		if strings.Contains(s, value) {
+			s = strings.ReplaceAll(s, value, Replacement)
+		}
+	}
+	return s
+}
+
+// Handler is a slog handler which redacts the message and the attributes
+// before passing the record to the wrapped handler
+type Handler struct {
+	next slog.Handler
+}
+
+// NewHandler wraps the slog handler
+func NewHandler(next slog.Handler) *Handler {
+	return &Handler{next: next}
+}
+
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, String(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(attr(a))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = attr(a)
+	}
+	return &Handler{next: h.next.WithAttrs(redacted)}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{next: h.next.WithGroup(name)}
+}
+
+// redact the string values of the attribute, including errors and groups
+func attr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, String(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		redacted := make([]any, len(group))
+		for i, ga := range group {
+			redacted[i] = attr(ga)
+		}
+		return slog.Group(a.Key, redacted...)
+	case slog.KindAny:
+		switch x := v.Any().(type) {
+		case error:
+			return slog.String(a.Key, String(x.Error()))
+		case interface{ String() string }:
+			return slog.String(a.Key, String(x.String()))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
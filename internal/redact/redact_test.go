@@ -0,0 +1,107 @@
+package redact
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		secret string
+	}{
+		{
+			name:   "url error",
+			input:  `Get "http://127.0.0.1:1/cgi-bin/token?grant_type=client_credential&appid=app1&secret=appsecret1": dial tcp: connection refused`,
+			secret: "appsecret1",
+		},
+		{
+			name:   "wecom url",
+			input:  `Get "http://127.0.0.1:1/cgi-bin/gettoken?corpid=corp1&corpsecret=corpsecret1": EOF`,
+			secret: "corpsecret1",
+		},
+		{
+			name:   "access token in url",
+			input:  `Post "http://127.0.0.1:1/cgi-bin/clear_quota?access_token=accesstoken1": EOF`,
+			secret: "accesstoken1",
+		},
+		{
+			name:   "code2session url",
+			input:  `Get "http://127.0.0.1:1/sns/jscode2session?appid=app1&js_code=jscode1&grant_type=authorization_code": EOF`,
+			secret: "jscode1",
+		},
+		{
+			name:   "json body",
+			input:  `{"component_appsecret": "componentsecret1", "component_appid": "wx1"}`,
+			secret: "componentsecret1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := String(tt.input)
+			if strings.Contains(result, tt.secret) {
+				t.Errorf("String() = %s, the secret %s is not redacted", result, tt.secret)
+			}
+			if !strings.Contains(result, Replacement) {
+				t.Errorf("String() = %s, want it to contain %s", result, Replacement)
+			}
+		})
+	}
+
+	// the appid is not a secret
+	if result := String("appid=wx1234567890"); result != "appid=wx1234567890" {
+		t.Errorf("String() = %s, want the appid kept", result)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register(0, "registeredsecret1", "short")
+	Register(time.Nanosecond, "expiredsecret1")
+	time.Sleep(time.Millisecond)
+	Register(time.Hour, "validtoken1")
+
+	result := String("registeredsecret1 short expiredsecret1 validtoken1")
+	if result != Replacement+" short expiredsecret1 "+Replacement {
+		t.Errorf("String() = %s, want the registered values redacted", result)
+	}
+}
+
+func TestRegisterEnv(t *testing.T) {
+	os.Setenv("APPSECRET_wxmini", "envsecret1")
+	os.Setenv("JWT_KEY_key1", "jwtsecret1")
+	defer os.Unsetenv("APPSECRET_wxmini")
+	defer os.Unsetenv("JWT_KEY_key1")
+
+	RegisterEnv()
+	if result := String("envsecret1 jwtsecret1"); strings.Contains(result, "secret1") {
+		t.Errorf("String() = %s, want the env secrets redacted", result)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	Register(0, "handlersecret1")
+
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(slog.NewJSONHandler(&buf, nil)))
+	logger.With("token", "handlersecret1").Error("fetch handlersecret1 fail",
+		"error", fmt.Errorf(`Get "http://x/cgi-bin/token?secret=querysecret1": EOF`),
+		slog.Group("details", "value", "handlersecret1"),
+		"count", 1,
+	)
+
+	for _, secret := range []string{"handlersecret1", "querysecret1"} {
+		if strings.Contains(buf.String(), secret) {
+			t.Errorf("Expected %s to be redacted, got %s", secret, buf.String())
+		}
+	}
+	if !strings.Contains(buf.String(), `"count":1`) {
+		t.Errorf("Expected the other attributes kept, got %s", buf.String())
+	}
+}
@@ -0,0 +1,179 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Provider resolves the references of a scheme, such as vault://path#field,
+// to the secret values kept in an external store
+type Provider interface {
+	Resolve(ctx context.Context, ref string) (string, error)
+}
+
+// ProviderFunc adapts a function to a Provider
+type ProviderFunc func(ctx context.Context, ref string) (string, error)
+
+func (f ProviderFunc) Resolve(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+var (
+	mu        sync.Mutex
+	providers = map[string]Provider{
+		"file": ProviderFunc(resolveFile),
+		"env":  ProviderFunc(resolveEnv),
+		"vault": ProviderFunc(func(ctx context.Context, ref string) (string, error) {
+			return NewVaultProvider().Resolve(ctx, ref)
+		}),
+	}
+	// the resolved values by reference, until the next reload
+	cache = make(map[string]string)
+	// the env vars set to a reference, by name
+	refs = make(map[string]string)
+)
+
+// Register sets the provider of the references of the scheme, replacing the
+// built-in one if any
+func Register(scheme string, p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	providers[scheme] = p
+}
+
+// IsReference reports whether the value is a reference to a secret, with the
+// scheme of a registered provider, such as file:///run/secrets/appsecret
+func IsReference(value string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	_, ok := providerOf(value)
+	return ok
+}
+
+// Resolve returns the secret value of the reference, which is cached until
+// the next reload
+func Resolve(ctx context.Context, ref string) (string, error) {
+	mu.Lock()
+	if value, ok := cache[ref]; ok {
+		mu.Unlock()
+		return value, nil
+	}
+	p, ok := providerOf(ref)
+	mu.Unlock()
+	if !ok {
+		return "", fmt.Errorf("no secret provider for %s", ref)
+	}
+
+	value, err := p.Resolve(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	cache[ref] = value
+	return value, nil
+}
+
+// ResolveEnv replaces the env vars set to a reference, such as
+// APPSECRET=file:///run/secrets/appsecret, with the secret values, so that
+// the secrets don't show up in the environment of the process. The file://
+// and env:// references are resolved first, so that the credentials of the
+// external stores, such as VAULT_TOKEN, may be references too.
+func ResolveEnv(ctx context.Context) error {
+	mu.Lock()
+	// the env vars unset since the last time are forgotten
+	for name := range refs {
+		if _, ok := os.LookupEnv(name); !ok {
+			delete(refs, name)
+		}
+	}
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if _, ok := providerOf(value); ok {
+			refs[name] = value
+		}
+	}
+	mu.Unlock()
+	return resolveRefs(ctx)
+}
+
+// Reload forgets the cached values and resolves the env vars set to a
+// reference again, such as after a secret is rotated in the external store
+func Reload(ctx context.Context) error {
+	mu.Lock()
+	cache = make(map[string]string)
+	mu.Unlock()
+	return ResolveEnv(ctx)
+}
+
+// resolve the references of the env vars and set their values
+func resolveRefs(ctx context.Context) error {
+	mu.Lock()
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	local := func(name string) bool {
+		return strings.HasPrefix(refs[name], "file://") || strings.HasPrefix(refs[name], "env://")
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if local(names[i]) != local(names[j]) {
+			return local(names[i])
+		}
+		return names[i] < names[j]
+	})
+	snapshot := make(map[string]string, len(refs))
+	for name, ref := range refs {
+		snapshot[name] = ref
+	}
+	mu.Unlock()
+
+	var errs []error
+	for _, name := range names {
+		value, err := Resolve(ctx, snapshot[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("resolve %s fail: %w", name, err))
+			continue
+		}
+		os.Setenv(name, value)
+	}
+	return errors.Join(errs...)
+}
+
+// the provider of the scheme of the reference, mu must be held
+func providerOf(ref string) (Provider, bool) {
+	scheme, _, ok := strings.Cut(ref, "://")
+	if !ok {
+		return nil, false
+	}
+	p, ok := providers[scheme]
+	return p, ok
+}
+
+// read the secret from the file, such as a Docker or Kubernetes secret,
+// without the trailing newline
+func resolveFile(_ context.Context, ref string) (string, error) {
+	data, err := os.ReadFile(strings.TrimPrefix(ref, "file://"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// read the secret from another env var
+func resolveEnv(_ context.Context, ref string) (string, error) {
+	name := strings.TrimPrefix(ref, "env://")
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("%s is not set", name)
+	}
+	return value, nil
+}
@@ -0,0 +1,126 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appsecret")
+	os.WriteFile(path, []byte("file_app_secret\n"), 0600)
+	os.Setenv("SECRETS_TEST_SOURCE", "env_app_secret")
+	defer os.Unsetenv("SECRETS_TEST_SOURCE")
+
+	tests := []struct {
+		name    string
+		ref     string
+		value   string
+		wantErr bool
+	}{
+		{name: "File", ref: "file://" + path, value: "file_app_secret"},
+		{name: "Missing file", ref: "file://" + path + ".missing", wantErr: true},
+		{name: "Env", ref: "env://SECRETS_TEST_SOURCE", value: "env_app_secret"},
+		{name: "Missing env", ref: "env://SECRETS_TEST_MISSING", wantErr: true},
+		{name: "Unknown scheme", ref: "unknown://secret", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := Resolve(context.Background(), tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if value != tt.value {
+				t.Errorf("Resolve() = %s, want %s", value, tt.value)
+			}
+		})
+	}
+
+	if !IsReference("file:///run/secrets/appsecret") || IsReference("https://api.weixin.qq.com") || IsReference("plain") {
+		t.Errorf("IsReference() doesn't match the registered schemes only")
+	}
+}
+
+func TestResolveEnvAndReload(t *testing.T) {
+	var calls int
+	server := mockVaultServer(t, &calls)
+	tokenPath := filepath.Join(t.TempDir(), "vault_token")
+	os.WriteFile(tokenPath, []byte("vault_test_token"), 0600)
+	secretPath := filepath.Join(t.TempDir(), "jwt_key")
+	os.WriteFile(secretPath, []byte("jwt_key_v1"), 0600)
+
+	envVars := map[string]string{
+		"VAULT_ADDR":             server.URL,
+		"VAULT_TOKEN":            "file://" + tokenPath,
+		"APPSECRET_wxsecrets":    "vault://secret/wechat/app#appsecret",
+		"APPSECRET_wxsecrets2":   "vault://secret/wechat/app#appsecret",
+		"JWT_KEY_secrets":        "file://" + secretPath,
+		"SECRETS_TEST_UNTOUCHED": "https://api.weixin.qq.com",
+	}
+	for k, v := range envVars {
+		os.Setenv(k, v)
+	}
+	defer func() {
+		for k := range envVars {
+			os.Unsetenv(k)
+		}
+		mu.Lock()
+		refs = make(map[string]string)
+		mu.Unlock()
+	}()
+
+	// the vault token is read from its file before the vault secrets
+	if err := ResolveEnv(context.Background()); err != nil {
+		t.Fatalf("ResolveEnv() error = %v", err)
+	}
+	if value := os.Getenv("APPSECRET_wxsecrets"); value != "vault_app_secret" {
+		t.Errorf("APPSECRET_wxsecrets = %s, want the vault secret", value)
+	}
+	if value := os.Getenv("JWT_KEY_secrets"); value != "jwt_key_v1" {
+		t.Errorf("JWT_KEY_secrets = %s, want the file secret", value)
+	}
+	if value := os.Getenv("SECRETS_TEST_UNTOUCHED"); value != "https://api.weixin.qq.com" {
+		t.Errorf("SECRETS_TEST_UNTOUCHED = %s, want it untouched", value)
+	}
+	// the same reference is read once
+	if calls != 1 {
+		t.Errorf("Expected 1 call to the vault, got %d", calls)
+	}
+
+	// the secrets are read again on reload
+	os.WriteFile(secretPath, []byte("jwt_key_v2"), 0600)
+	if err := Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if value := os.Getenv("JWT_KEY_secrets"); value != "jwt_key_v2" {
+		t.Errorf("JWT_KEY_secrets = %s, want the rotated secret", value)
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 calls to the vault after reload, got %d", calls)
+	}
+
+	// a failed reload keeps the resolved values
+	os.Remove(secretPath)
+	if err := Reload(context.Background()); err == nil {
+		t.Errorf("Reload() accepted a missing file")
+	}
+	if value := os.Getenv("JWT_KEY_secrets"); value != "jwt_key_v2" {
+		t.Errorf("JWT_KEY_secrets = %s, want the last value", value)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("stub", ProviderFunc(func(ctx context.Context, ref string) (string, error) {
+		return "stub_secret", nil
+	}))
+	defer func() {
+		mu.Lock()
+		delete(providers, "stub")
+		mu.Unlock()
+	}()
+
+	if value, err := Resolve(context.Background(), "stub://anything"); err != nil || value != "stub_secret" {
+		t.Errorf("Resolve() = %s, %v", value, err)
+	}
+}
@@ -0,0 +1,73 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// VaultProvider reads the secrets from the KV version 2 engine of a
+// HashiCorp Vault compatible store. The references are
+// vault://{mount}/{path}#{field}, such as vault://secret/wechat/app#appsecret,
+// which is read from {Addr}/v1/secret/data/wechat/app.
+type VaultProvider struct {
+	Addr   string
+	Token  string
+	Client *http.Client
+}
+
+// NewVaultProvider returns the provider of the store at VAULT_ADDR, with the
+// token in VAULT_TOKEN
+func NewVaultProvider() *VaultProvider {
+	return &VaultProvider{
+		Addr:   os.Getenv("VAULT_ADDR"),
+		Token:  os.Getenv("VAULT_TOKEN"),
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *VaultProvider) Resolve(ctx context.Context, ref string) (string, error) {
+	if p.Addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR is not set")
+	}
+	path, field, ok := strings.Cut(strings.TrimPrefix(ref, "vault://"), "#")
+	mount, secretPath, _ := strings.Cut(path, "/")
+	if !ok || field == "" || mount == "" || secretPath == "" {
+		return "", fmt.Errorf("invalid reference %s, want vault://{mount}/{path}#{field}", ref)
+	}
+
+	url := strings.TrimSuffix(p.Addr, "/") + "/v1/" + mount + "/data/" + secretPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", p.Token)
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("read %s fail, status: %d, body: %s", path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var result struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	value, ok := result.Data.Data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("field %s not found in %s", field, path)
+	}
+	return value, nil
+}
@@ -0,0 +1,65 @@
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// a stub of the KV version 2 engine, with the secret/wechat/app secret
+func mockVaultServer(t *testing.T, calls *int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault_test_token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		if r.URL.Path != "/v1/secret/data/wechat/app" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		if calls != nil {
+			*calls++
+		}
+		w.Write([]byte(`{"data":{"data":{"appsecret":"vault_app_secret"},"metadata":{"version":3}}}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestVaultProvider(t *testing.T) {
+	server := mockVaultServer(t, nil)
+	p := &VaultProvider{Addr: server.URL, Token: "vault_test_token", Client: server.Client()}
+
+	tests := []struct {
+		name    string
+		ref     string
+		value   string
+		wantErr bool
+	}{
+		{name: "Field", ref: "vault://secret/wechat/app#appsecret", value: "vault_app_secret"},
+		{name: "Missing field", ref: "vault://secret/wechat/app#other", wantErr: true},
+		{name: "Missing secret", ref: "vault://secret/wechat/other#appsecret", wantErr: true},
+		{name: "No field", ref: "vault://secret/wechat/app", wantErr: true},
+		{name: "No path", ref: "vault://secret#appsecret", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := p.Resolve(context.Background(), tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if value != tt.value {
+				t.Errorf("Resolve() = %s, want %s", value, tt.value)
+			}
+		})
+	}
+
+	// the token is checked by the store
+	p.Token = "wrong"
+	if _, err := p.Resolve(context.Background(), "vault://secret/wechat/app#appsecret"); err == nil {
+		t.Errorf("Resolve() accepted a wrong token")
+	}
+}
@@ -0,0 +1,215 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/waynecraig/wechat-token-hub/internal/envelope"
+)
+
+// values that must survive a restart, saved as a json file at STORE_FILE.
+// if STORE_FILE is not set, values are only kept in memory. With a master
+// key, the values are encrypted with envelope encryption.
+var (
+	mu         sync.Mutex
+	values     map[string]string
+	loadedPath string
+)
+
+// Get returns the stored value of key, or an empty string if not set
+func Get(key string) string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := ensureLoaded(); err != nil {
+		return ""
+	}
+	value, err := envelope.Decrypt(key, values[key])
+	if err != nil {
+		slog.Error("decrypt stored value fail", "key", key, "error", err)
+		return ""
+	}
+	return value
+}
+
+// Save stores the value of key and writes it to the store file
+func Save(key string, value string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := ensureLoaded(); err != nil {
+		return err
+	}
+	encrypted, err := envelope.Encrypt(key, value)
+	if err != nil {
+		return err
+	}
+	values[key] = encrypted
+	return flush()
+}
+
+// Delete removes the keys from the store, the file is written once
+func Delete(keys ...string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := ensureLoaded(); err != nil {
+		return err
+	}
+	deleted := false
+	for _, key := range keys {
+		if _, ok := values[key]; ok {
+			delete(values, key)
+			deleted = true
+		}
+	}
+	if !deleted {
+		return nil
+	}
+	return flush()
+}
+
+// Keys returns the sorted keys which start with prefix
+func Keys(prefix string) []string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := ensureLoaded(); err != nil {
+		return nil
+	}
+	keys := []string{}
+	for k := range values {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Reencrypt encrypts every value again with the current master key, or
+// decrypts them without a master key, and returns the number of values
+func Reencrypt() (int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := ensureLoaded(); err != nil {
+		return 0, err
+	}
+	reencrypted := make(map[string]string, len(values))
+	for key, value := range values {
+		plaintext, err := envelope.Decrypt(key, value)
+		if err != nil {
+			return 0, err
+		}
+		if reencrypted[key], err = envelope.Encrypt(key, plaintext); err != nil {
+			return 0, err
+		}
+	}
+	values = reencrypted
+	return len(values), flush()
+}
+
+// Versions returns the number of values encrypted with each version of the
+// master key, the plain values are counted under an empty version
+func Versions() map[string]int {
+	mu.Lock()
+	defer mu.Unlock()
+
+	versions := make(map[string]int)
+	if err := ensureLoaded(); err != nil {
+		return versions
+	}
+	for _, value := range values {
+		versions[envelope.Version(value)]++
+	}
+	return versions
+}
+
+// Check returns an error if the store file can't be read or its directory
+// doesn't exist, so that the values can't be saved, or if the values can't be
+// decrypted with the master keys
+func Check() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := ensureLoaded(); err != nil {
+		return err
+	}
+	if err := envelope.Check(); err != nil {
+		return err
+	}
+	for key, value := range values {
+		if _, err := envelope.Decrypt(key, value); err != nil {
+			return fmt.Errorf("stored value can't be read: %w", err)
+		}
+	}
+	if loadedPath == "" {
+		return nil
+	}
+	if _, err := os.ReadFile(loadedPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	_, err := os.Stat(filepath.Dir(loadedPath))
+	return err
+}
+
+// load the store file if it's not loaded or the path has changed
+func ensureLoaded() error {
+	path := os.Getenv("STORE_FILE")
+	if values != nil && path == loadedPath {
+		return nil
+	}
+
+	loaded := make(map[string]string)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &loaded); err != nil {
+				return err
+			}
+		}
+	}
+
+	values = loaded
+	loadedPath = path
+	return nil
+}
+
+// write all values to the store file, through a temp file so that a crash
+// never leaves a partial file behind
+func flush() error {
+	if loadedPath == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(loadedPath), filepath.Base(loadedPath)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), loadedPath)
+}
@@ -0,0 +1,157 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	os.Setenv("STORE_FILE", path)
+	defer os.Unsetenv("STORE_FILE")
+
+	// test getting a value that is not set
+	if result := Get("missing"); result != "" {
+		t.Errorf("Get returned %s, expected empty string", result)
+	}
+
+	// test saving values
+	if err := Save("a_1", "value1"); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+	if err := Save("a_2", "value2"); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+	if err := Save("b_1", "value3"); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+	if result := Get("a_1"); result != "value1" {
+		t.Errorf("Get returned %s, expected value1", result)
+	}
+
+	// test listing keys by prefix
+	keys := Keys("a_")
+	if len(keys) != 2 || keys[0] != "a_1" || keys[1] != "a_2" {
+		t.Errorf("Keys returned %v, expected [a_1 a_2]", keys)
+	}
+
+	// test deleting a value
+	if err := Delete("a_2"); err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+	if result := Get("a_2"); result != "" {
+		t.Errorf("Get returned %s after delete, expected empty string", result)
+	}
+
+	// test deleting several values at once, the missing ones are ignored
+	if err := Delete("a_1", "missing"); err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+	if keys := Keys("a_"); len(keys) != 0 {
+		t.Errorf("Keys returned %v after delete, expected none", keys)
+	}
+
+	// test the values survive a reload
+	values = nil
+	if result := Get("b_1"); result != "value3" {
+		t.Errorf("Get returned %s after reload, expected value3", result)
+	}
+
+	// test the store file is not readable by others
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		t.Errorf("store file mode is %v, expected no group or other permissions", info.Mode().Perm())
+	}
+}
+
+func TestStoreInMemory(t *testing.T) {
+	os.Unsetenv("STORE_FILE")
+
+	// without a store file the values are kept in memory
+	if err := Save("key", "value"); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+	if result := Get("key"); result != "value" {
+		t.Errorf("Get returned %s, expected value", result)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	os.Setenv("STORE_FILE", filepath.Join(dir, "store.json"))
+	defer os.Unsetenv("STORE_FILE")
+
+	// a missing file is fine, it's created on the first save
+	if err := Check(); err != nil {
+		t.Errorf("Check() error = %v", err)
+	}
+
+	// the directory must exist to save the values
+	os.Setenv("STORE_FILE", filepath.Join(dir, "missing", "store.json"))
+	if err := Check(); err == nil {
+		t.Errorf("Check() accepted a missing directory")
+	}
+}
+
+func TestEncryptedStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	os.Setenv("STORE_FILE", path)
+	defer os.Unsetenv("STORE_FILE")
+
+	// the values saved before the master key is set are kept in clear
+	if err := Save("plain", "plain_value"); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+
+	os.Setenv("MASTER_KEY", "v1=MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	defer os.Unsetenv("MASTER_KEY")
+	if err := Save("secret", "secret_value"); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "secret_value") {
+		t.Errorf("Expected the value to be encrypted in the store file, got %s", data)
+	}
+	if result := Get("secret"); result != "secret_value" {
+		t.Errorf("Get returned %s, expected secret_value", result)
+	}
+	if result := Get("plain"); result != "plain_value" {
+		t.Errorf("Get returned %s, expected plain_value", result)
+	}
+	if versions := Versions(); versions[""] != 1 || versions["v1"] != 1 {
+		t.Errorf("Versions returned %v, expected one plain and one v1 value", versions)
+	}
+
+	// the values are encrypted again with the new key
+	os.Setenv("MASTER_KEY", "v1=MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=,v2=ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA=")
+	if n, err := Reencrypt(); err != nil || n != 2 {
+		t.Fatalf("Reencrypt returned %d, %v", n, err)
+	}
+	if versions := Versions(); versions["v2"] != 2 {
+		t.Errorf("Versions returned %v, expected two v2 values", versions)
+	}
+
+	// the old key can be removed once the values are encrypted again
+	os.Setenv("MASTER_KEY", "v2=ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA=")
+	values = nil
+	if result := Get("secret"); result != "secret_value" {
+		t.Errorf("Get returned %s after the rotation, expected secret_value", result)
+	}
+	if err := Check(); err != nil {
+		t.Errorf("Check() error = %v", err)
+	}
+
+	// without the master key the values can't be read
+	os.Unsetenv("MASTER_KEY")
+	if result := Get("secret"); result != "" {
+		t.Errorf("Get returned %s without the master key, expected empty string", result)
+	}
+	if err := Check(); err == nil {
+		t.Errorf("Check() accepted values which can't be decrypted")
+	}
+}
@@ -0,0 +1,47 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+
+	"github.com/waynecraig/wechat-token-hub/internal/audit"
+	"github.com/waynecraig/wechat-token-hub/internal/auth"
+	"github.com/waynecraig/wechat-token-hub/internal/fingerprint"
+	"github.com/waynecraig/wechat-token-hub/internal/logging"
+)
+
+// record an upstream fetch of the credential in the audit log
+func auditFetch(ctx context.Context, key string, credential *Credential, err error) {
+	e := newAuditEvent(ctx, audit.EventFetch, key, err)
+	if credential != nil {
+		e.NewFingerprint = fingerprint.Of(credential.Value)
+	}
+	audit.Record(e)
+}
+
+// record a rotation of the credential from old to new in the audit log
+func auditRotate(ctx context.Context, eventType string, key string, old string, new string, err error) {
+	e := newAuditEvent(ctx, eventType, key, err)
+	e.OldFingerprint = fingerprint.Of(old)
+	e.NewFingerprint = fingerprint.Of(new)
+	audit.Record(e)
+}
+
+func newAuditEvent(ctx context.Context, eventType string, key string, err error) audit.Event {
+	e := audit.Event{
+		Type:      eventType,
+		Key:       key,
+		RequestID: logging.RequestID(ctx),
+	}
+	if principal := auth.FromContext(ctx); principal != nil {
+		e.Principal = principal.Subject
+	}
+	if err != nil {
+		e.Error = err.Error()
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			e.ErrCode = apiErr.ErrCode
+		}
+	}
+	return e
+}
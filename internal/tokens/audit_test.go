@@ -0,0 +1,69 @@
+package tokens
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/waynecraig/wechat-token-hub/internal/audit"
+	"github.com/waynecraig/wechat-token-hub/internal/auth"
+	"github.com/waynecraig/wechat-token-hub/internal/fingerprint"
+	"github.com/waynecraig/wechat-token-hub/internal/quota"
+)
+
+func TestAuditEvents(t *testing.T) {
+	p := &fakeProvider{key: "fake_audit"}
+	ctx := auth.NewContext(context.Background(), &auth.Principal{Subject: "client1"})
+
+	// the first fetch is recorded with the fingerprint of the new value
+	if _, err := GetContext(ctx, p, ""); err != nil {
+		t.Fatalf("GetContext() error = %v", err)
+	}
+	events := audit.Recent(audit.Filter{Key: "fake_audit"})
+	if len(events) != 1 || events[0].Type != audit.EventFetch || events[0].Principal != "client1" ||
+		events[0].NewFingerprint != fingerprint.Of("fake_audit1") {
+		t.Fatalf("Unexpected fetch events: %+v", events)
+	}
+
+	// an honored rotation is recorded with the old and new fingerprints
+	os.Setenv("ROTATE_MIN_INTERVAL", "0s")
+	if _, err := GetContext(ctx, p, "fake_audit1"); err != nil {
+		t.Fatalf("GetContext() error = %v", err)
+	}
+	os.Unsetenv("ROTATE_MIN_INTERVAL")
+	events = audit.Recent(audit.Filter{Key: "fake_audit", Type: audit.EventRotate})
+	if len(events) != 1 || events[0].OldFingerprint != fingerprint.Of("fake_audit1") ||
+		events[0].NewFingerprint != fingerprint.Of("fake_audit2") || events[0].Principal != "client1" {
+		t.Fatalf("Unexpected rotate events: %+v", events)
+	}
+
+	// a rejected rotation is recorded with the reason
+	if _, err := GetContext(ctx, p, "fake_audit2"); err == nil {
+		t.Fatalf("Expected the rotation to be refused")
+	}
+	events = audit.Recent(audit.Filter{Key: "fake_audit", Type: audit.EventRotateRejected})
+	if len(events) != 1 || events[0].OldFingerprint != fingerprint.Of("fake_audit2") || events[0].Error == "" {
+		t.Fatalf("Unexpected rejected events: %+v", events)
+	}
+	quota.Reset("fake_audit")
+
+	// the values are never recorded
+	for _, e := range audit.Recent(audit.Filter{Key: "fake_audit"}) {
+		if e.OldFingerprint == "fake_audit1" || e.NewFingerprint == "fake_audit2" {
+			t.Errorf("Expected fingerprints, got %+v", e)
+		}
+	}
+}
+
+func TestAuditErrCode(t *testing.T) {
+	// the dependency is rejected, the errcode of wechat is recorded
+	p := &fakeProvider{key: "fake_audit_errcode", dependency: &fakeProvider{key: "fake_audit_dep"}}
+	if _, err := Get(p, ""); err == nil {
+		t.Fatalf("Expected the fetch to fail")
+	}
+	events := audit.Recent(audit.Filter{Key: "fake_audit_errcode"})
+	if len(events) != 1 || events[0].ErrCode != 40001 || events[0].NewFingerprint != "" {
+		t.Errorf("Unexpected fetch events: %+v", events)
+	}
+	quota.Reset("fake_audit_errcode", "fake_audit_dep")
+}
@@ -0,0 +1,211 @@
+package tokens
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/cache"
+	"github.com/waynecraig/wechat-token-hub/internal/redact"
+	"github.com/waynecraig/wechat-token-hub/internal/store"
+)
+
+// the store key prefix of the authorizer refresh tokens, losing them means
+// the merchant has to authorize the platform again
+const authorizerRefreshTokenPrefix = "authorizer_refresh_token_"
+
+// set by an admin to stop the background refresh, such as during an incident
+var refreshPaused atomic.Bool
+
+// GetAuthorizerAccessToken returns the authorizer_access_token of an account
+// which has authorized the open platform
+func GetAuthorizerAccessToken(appid string, rotateToken string) (string, error) {
+	return Get(AuthorizerAccessTokenProvider(appid), rotateToken)
+}
+
+// AuthorizerAccessTokenProvider returns the provider of the
+// authorizer_access_token, which is refreshed with the stored refresh token
+func AuthorizerAccessTokenProvider(appid string) Provider {
+	return authorizerAccessTokenProvider{appid: appid}
+}
+
+// ListAuthorizers returns the appids of the accounts which have a stored refresh token
+func ListAuthorizers() []string {
+	appids := []string{}
+	for _, key := range store.Keys(authorizerRefreshTokenPrefix) {
+		appids = append(appids, strings.TrimPrefix(key, authorizerRefreshTokenPrefix))
+	}
+	return appids
+}
+
+// SaveAuthorizerRefreshToken stores the refresh token of an authorizer durably
+func SaveAuthorizerRefreshToken(appid string, refreshToken string) error {
+	if appid == "" || refreshToken == "" {
+		return fmt.Errorf("empty authorizer appid or refresh token")
+	}
+	redact.Register(0, refreshToken)
+	return store.Save(authorizerRefreshTokenPrefix+appid, refreshToken)
+}
+
+// RemoveAuthorizer forgets an authorizer, after it has revoked the authorization
+func RemoveAuthorizer(appid string) error {
+	cache.DeleteCacheItem(authorizerCacheKey(appid))
+	return store.Delete(authorizerRefreshTokenPrefix + appid)
+}
+
+// RefreshAuthorizers refreshes the authorizer access tokens which are not
+// cached or will expire within margin
+func RefreshAuthorizers(margin time.Duration) {
+	if refreshPaused.Load() {
+		return
+	}
+	for _, appid := range ListAuthorizers() {
+		if time.Until(cache.GetCacheItemExpiration(authorizerCacheKey(appid))) > margin {
+			continue
+		}
+		if _, err := Refresh(AuthorizerAccessTokenProvider(appid)); err != nil {
+			slog.Error("refresh authorizer fail", "appid", appid, "error", err)
+		}
+	}
+}
+
+// StartAuthorizerRefresher refreshes the authorizer access tokens in the
+// background every interval, so that clients rarely wait for wechat
+func StartAuthorizerRefresher(interval time.Duration, margin time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			RefreshAuthorizers(margin)
+			<-ticker.C
+		}
+	}()
+}
+
+// PauseRefresh stops the background refresh until ResumeRefresh is called,
+// the credentials are still refreshed when they expire
+func PauseRefresh() {
+	refreshPaused.Store(true)
+}
+
+// ResumeRefresh restarts the background refresh
+func ResumeRefresh() {
+	refreshPaused.Store(false)
+}
+
+// RefreshPaused reports whether the background refresh is paused
+func RefreshPaused() bool {
+	return refreshPaused.Load()
+}
+
+// exchange the authorization code pushed with the authorized event for the
+// authorizer tokens, and keep the refresh token
+func queryAuth(authorizationCode string) error {
+	componentAccessToken, err := GetComponentAccessToken("")
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/cgi-bin/component/api_query_auth?component_access_token=%s", os.Getenv("WECHAT_API_ROOT"), componentAccessToken)
+	body := map[string]string{
+		"component_appid":    os.Getenv("COMPONENT_APPID"),
+		"authorization_code": authorizationCode,
+	}
+	var result struct {
+		apiResult
+		AuthorizationInfo struct {
+			AuthorizerAppid        string `json:"authorizer_appid"`
+			AuthorizerAccessToken  string `json:"authorizer_access_token"`
+			ExpiresIn              int    `json:"expires_in"`
+			AuthorizerRefreshToken string `json:"authorizer_refresh_token"`
+		} `json:"authorization_info"`
+	}
+	if err := postJSON(url, body, &result); err != nil {
+		return err
+	}
+
+	info := result.AuthorizationInfo
+	if info.AuthorizerRefreshToken == "" {
+		return &APIError{Name: "authorization info", ErrCode: result.ErrCode, ErrMsg: result.ErrMsg}
+	}
+
+	// save the refresh token first, it's the one which can not be lost
+	if err := SaveAuthorizerRefreshToken(info.AuthorizerAppid, info.AuthorizerRefreshToken); err != nil {
+		return err
+	}
+	cache.SaveCacheItem(authorizerCacheKey(info.AuthorizerAppid), info.AuthorizerAccessToken, info.ExpiresIn)
+	recordStatus(AuthorizerAccessTokenProvider(info.AuthorizerAppid), nil)
+
+	return nil
+}
+
+func authorizerCacheKey(appid string) string {
+	return "authorizer_access_token_" + appid
+}
+
+type authorizerAccessTokenProvider struct {
+	appid string
+}
+
+func (p authorizerAccessTokenProvider) Key() string {
+	return authorizerCacheKey(p.appid)
+}
+
+func (p authorizerAccessTokenProvider) Dependency() Provider {
+	return componentAccessTokenProvider{}
+}
+
+// the authorizer must have authorized the platform, with its refresh token stored
+func (p authorizerAccessTokenProvider) check() error {
+	if store.Get(authorizerRefreshTokenPrefix+p.appid) == "" {
+		return fmt.Errorf("%w: authorizer %s not found", ErrNotConfigured, p.appid)
+	}
+	return nil
+}
+
+// request the wechat API to get a new authorizer access token with the stored
+// refresh token, the engine holds the lock of the key so refreshes of the same
+// authorizer never overlap
+func (p authorizerAccessTokenProvider) Fetch(componentAccessToken string) (*Credential, error) {
+	refreshToken := store.Get(authorizerRefreshTokenPrefix + p.appid)
+	if refreshToken == "" {
+		return nil, fmt.Errorf("authorizer %s not found", p.appid)
+	}
+	redact.Register(0, refreshToken)
+
+	url := fmt.Sprintf("%s/cgi-bin/component/api_authorizer_token?component_access_token=%s", os.Getenv("WECHAT_API_ROOT"), componentAccessToken)
+	body := map[string]string{
+		"component_appid":          os.Getenv("COMPONENT_APPID"),
+		"authorizer_appid":         p.appid,
+		"authorizer_refresh_token": refreshToken,
+	}
+	var result struct {
+		apiResult
+		AuthorizerAccessToken  string `json:"authorizer_access_token"`
+		ExpiresIn              int    `json:"expires_in"`
+		AuthorizerRefreshToken string `json:"authorizer_refresh_token"`
+	}
+	if err := postJSON(url, body, &result); err != nil {
+		return nil, err
+	}
+
+	if result.AuthorizerAccessToken == "" {
+		return nil, &APIError{Name: "authorizer access token", ErrCode: result.ErrCode, ErrMsg: result.ErrMsg}
+	}
+
+	// wechat may issue a new refresh token, keep it before using the access token
+	if result.AuthorizerRefreshToken != "" && result.AuthorizerRefreshToken != refreshToken {
+		if err := SaveAuthorizerRefreshToken(p.appid, result.AuthorizerRefreshToken); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Credential{Value: result.AuthorizerAccessToken, ExpiresIn: result.ExpiresIn}, nil
+}
+
+func (p authorizerAccessTokenProvider) Classify(err error) ErrorClass {
+	return classifyInvalidToken(err)
+}
@@ -0,0 +1,127 @@
+package tokens
+
+import (
+	"testing"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/cache"
+	"github.com/waynecraig/wechat-token-hub/internal/store"
+)
+
+func TestAuthorizerEvents(t *testing.T) {
+	server := mockComponentServer(t)
+	setComponentEnv(t, server.URL)
+	store.Save(componentVerifyTicketKey, "verify1")
+
+	// test the authorized event saves the refresh token
+	signature, timestamp, nonce, body := pushComponentMessage(t,
+		"<xml><InfoType>authorized</InfoType><AuthorizerAppid>wxa1</AuthorizerAppid><AuthorizationCode>authcode1</AuthorizationCode></xml>")
+	if err := HandleComponentNotification(signature, timestamp, nonce, body); err != nil {
+		t.Fatalf("HandleComponentNotification() error = %v", err)
+	}
+	if result := store.Get(authorizerRefreshTokenPrefix + "wxa1"); result != "refresh1" {
+		t.Errorf("Expect refresh token = refresh1, got %s", result)
+	}
+	if result := cache.GetCacheItem(authorizerCacheKey("wxa1")); result != "atoken1" {
+		t.Errorf("Expect authorizer access token = atoken1, got %s", result)
+	}
+
+	// test an expired authorization code
+	signature, timestamp, nonce, body = pushComponentMessage(t,
+		"<xml><InfoType>authorized</InfoType><AuthorizerAppid>wxa2</AuthorizerAppid><AuthorizationCode>authcode2</AuthorizationCode></xml>")
+	if err := HandleComponentNotification(signature, timestamp, nonce, body); err == nil {
+		t.Errorf("HandleComponentNotification() accepted an expired authorization code")
+	}
+
+	// test the unauthorized event removes the authorizer
+	signature, timestamp, nonce, body = pushComponentMessage(t,
+		"<xml><InfoType>unauthorized</InfoType><AuthorizerAppid>wxa1</AuthorizerAppid></xml>")
+	if err := HandleComponentNotification(signature, timestamp, nonce, body); err != nil {
+		t.Fatalf("HandleComponentNotification() error = %v", err)
+	}
+	if result := store.Get(authorizerRefreshTokenPrefix + "wxa1"); result != "" {
+		t.Errorf("Expect refresh token removed, got %s", result)
+	}
+	if result := cache.GetCacheItem(authorizerCacheKey("wxa1")); result != "" {
+		t.Errorf("Expect authorizer access token removed, got %s", result)
+	}
+}
+
+func TestGetAuthorizerAccessToken(t *testing.T) {
+	server := mockComponentServer(t)
+	setComponentEnv(t, server.URL)
+	store.Save(componentVerifyTicketKey, "verify1")
+	SaveAuthorizerRefreshToken("wxa1", "refresh1")
+	cache.DeleteCacheItem(authorizerCacheKey("wxa1"))
+
+	// test an unknown authorizer
+	if _, err := GetAuthorizerAccessToken("wxunknown", ""); err == nil {
+		t.Errorf("GetAuthorizerAccessToken() should fail for unknown authorizer")
+	}
+
+	tests := []struct {
+		name        string
+		rotateToken string
+		token       string
+	}{
+		{name: "normal", token: "atoken2"},
+		{name: "from cache", token: "atoken2"},
+		{name: "rotate token", rotateToken: "atoken2", token: "atoken2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := GetAuthorizerAccessToken("wxa1", tt.rotateToken)
+			if err != nil {
+				t.Errorf("GetAuthorizerAccessToken() error = %v", err)
+			}
+			if token != tt.token {
+				t.Errorf("Expect authorizer access token = %s, got %s", tt.token, token)
+			}
+		})
+	}
+
+	// test the new refresh token issued by wechat is kept
+	if result := store.Get(authorizerRefreshTokenPrefix + "wxa1"); result != "refresh2" {
+		t.Errorf("Expect refresh token = refresh2, got %s", result)
+	}
+
+	RemoveAuthorizer("wxa1")
+}
+
+func TestRefreshAuthorizers(t *testing.T) {
+	server := mockComponentServer(t)
+	setComponentEnv(t, server.URL)
+	store.Save(componentVerifyTicketKey, "verify1")
+	SaveAuthorizerRefreshToken("wxa1", "refresh1")
+	SaveAuthorizerRefreshToken("wxa2", "refresh1")
+	defer RemoveAuthorizer("wxa1")
+	defer RemoveAuthorizer("wxa2")
+
+	// wxa1 expires soon and wxa2 is fresh
+	cache.SaveCacheItem(authorizerCacheKey("wxa1"), "old", 60)
+	cache.SaveCacheItem(authorizerCacheKey("wxa2"), "fresh", 7200)
+
+	if appids := ListAuthorizers(); len(appids) != 2 {
+		t.Errorf("ListAuthorizers returned %v, expected 2 authorizers", appids)
+	}
+
+	// nothing is refreshed while paused
+	PauseRefresh()
+	if !RefreshPaused() {
+		t.Errorf("Expect the refresh to be paused")
+	}
+	RefreshAuthorizers(10 * time.Minute)
+	if result := cache.GetCacheItem(authorizerCacheKey("wxa1")); result != "old" {
+		t.Errorf("Expect wxa1 kept as old while paused, got %s", result)
+	}
+	ResumeRefresh()
+
+	RefreshAuthorizers(10 * time.Minute)
+
+	if result := cache.GetCacheItem(authorizerCacheKey("wxa1")); result != "atoken2" {
+		t.Errorf("Expect wxa1 refreshed to atoken2, got %s", result)
+	}
+	if result := cache.GetCacheItem(authorizerCacheKey("wxa2")); result != "fresh" {
+		t.Errorf("Expect wxa2 kept as fresh, got %s", result)
+	}
+}
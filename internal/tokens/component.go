@@ -0,0 +1,162 @@
+package tokens
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+
+	"github.com/waynecraig/wechat-token-hub/internal/store"
+	"github.com/waynecraig/wechat-token-hub/internal/wxcrypt"
+)
+
+// the store key of the component_verify_ticket pushed by wechat every 10 minutes
+const componentVerifyTicketKey = "component_verify_ticket"
+
+// GetComponentAccessToken returns the component_access_token of the open platform
+func GetComponentAccessToken(rotateToken string) (string, error) {
+	return Get(ComponentAccessTokenProvider(), rotateToken)
+}
+
+// GetPreAuthCode requests a new pre_auth_code, it's not cached since every
+// authorization link should use a fresh one
+func GetPreAuthCode() (string, error) {
+	return Refresh(preAuthCodeProvider{})
+}
+
+// ComponentAccessTokenProvider returns the provider of the component_access_token
+func ComponentAccessTokenProvider() Provider {
+	return componentAccessTokenProvider{}
+}
+
+// HandleComponentNotification verifies and decrypts a message pushed to the
+// authorization event url, and saves the component_verify_ticket or the
+// authorizer refresh token it carries
+func HandleComponentNotification(msgSignature, timestamp, nonce string, body []byte) error {
+	// parse the encrypted envelope
+	var envelope struct {
+		AppId   string `xml:"AppId"`
+		Encrypt string `xml:"Encrypt"`
+	}
+	if err := xml.Unmarshal(body, &envelope); err != nil {
+		return err
+	}
+
+	// check the message is sent by wechat
+	if !wxcrypt.VerifySignature(os.Getenv("COMPONENT_TOKEN"), timestamp, nonce, envelope.Encrypt, msgSignature) {
+		return fmt.Errorf("invalid message signature")
+	}
+
+	// decrypt the message
+	plaintext, err := wxcrypt.Decrypt(os.Getenv("COMPONENT_ENCODING_AES_KEY"), os.Getenv("COMPONENT_APPID"), envelope.Encrypt)
+	if err != nil {
+		return err
+	}
+	var msg struct {
+		InfoType              string `xml:"InfoType"`
+		ComponentVerifyTicket string `xml:"ComponentVerifyTicket"`
+		AuthorizerAppid       string `xml:"AuthorizerAppid"`
+		AuthorizationCode     string `xml:"AuthorizationCode"`
+	}
+	if err := xml.Unmarshal(plaintext, &msg); err != nil {
+		return err
+	}
+
+	switch msg.InfoType {
+	case "component_verify_ticket":
+		if msg.ComponentVerifyTicket == "" {
+			return fmt.Errorf("empty component verify ticket")
+		}
+		return store.Save(componentVerifyTicketKey, msg.ComponentVerifyTicket)
+	case "authorized", "updateauthorized":
+		return queryAuth(msg.AuthorizationCode)
+	case "unauthorized":
+		return RemoveAuthorizer(msg.AuthorizerAppid)
+	}
+
+	// other events are acknowledged but ignored
+	return nil
+}
+
+type componentAccessTokenProvider struct{}
+
+func (p componentAccessTokenProvider) Key() string {
+	return "component_access_token"
+}
+
+func (p componentAccessTokenProvider) Dependency() Provider {
+	return nil
+}
+
+// request the wechat API to get a new component access token
+func (p componentAccessTokenProvider) Fetch(string) (*Credential, error) {
+	verifyTicket := store.Get(componentVerifyTicketKey)
+	if verifyTicket == "" {
+		return nil, fmt.Errorf("component verify ticket not received yet")
+	}
+
+	url := fmt.Sprintf("%s/cgi-bin/component/api_component_token", os.Getenv("WECHAT_API_ROOT"))
+	body := map[string]string{
+		"component_appid":         os.Getenv("COMPONENT_APPID"),
+		"component_appsecret":     os.Getenv("COMPONENT_APPSECRET"),
+		"component_verify_ticket": verifyTicket,
+	}
+	var result struct {
+		apiResult
+		ComponentAccessToken string `json:"component_access_token"`
+		ExpiresIn            int    `json:"expires_in"`
+	}
+	if err := postJSON(url, body, &result); err != nil {
+		return nil, err
+	}
+
+	if result.ComponentAccessToken == "" {
+		return nil, &APIError{Name: "component access token", ErrCode: result.ErrCode, ErrMsg: result.ErrMsg}
+	}
+
+	return &Credential{Value: result.ComponentAccessToken, ExpiresIn: result.ExpiresIn}, nil
+}
+
+func (p componentAccessTokenProvider) Classify(err error) ErrorClass {
+	return ErrorFatal
+}
+
+type preAuthCodeProvider struct{}
+
+// the pre auth code is not cached
+// the key only names the pre auth codes in the locks, the metrics and the
+// quota, they are never cached
+func (p preAuthCodeProvider) Key() string {
+	return "pre_auth_code"
+}
+
+func (p preAuthCodeProvider) uncached() {}
+
+func (p preAuthCodeProvider) Dependency() Provider {
+	return componentAccessTokenProvider{}
+}
+
+// request the wechat API to get a new pre auth code
+func (p preAuthCodeProvider) Fetch(componentAccessToken string) (*Credential, error) {
+	url := fmt.Sprintf("%s/cgi-bin/component/api_create_preauthcode?component_access_token=%s", os.Getenv("WECHAT_API_ROOT"), componentAccessToken)
+	body := map[string]string{
+		"component_appid": os.Getenv("COMPONENT_APPID"),
+	}
+	var result struct {
+		apiResult
+		PreAuthCode string `json:"pre_auth_code"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := postJSON(url, body, &result); err != nil {
+		return nil, err
+	}
+
+	if result.PreAuthCode == "" {
+		return nil, &APIError{Name: "pre auth code", ErrCode: result.ErrCode, ErrMsg: result.ErrMsg}
+	}
+
+	return &Credential{Value: result.PreAuthCode, ExpiresIn: result.ExpiresIn}, nil
+}
+
+func (p preAuthCodeProvider) Classify(err error) ErrorClass {
+	return classifyInvalidToken(err)
+}
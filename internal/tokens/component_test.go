@@ -0,0 +1,195 @@
+package tokens
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/waynecraig/wechat-token-hub/internal/cache"
+	"github.com/waynecraig/wechat-token-hub/internal/quota"
+	"github.com/waynecraig/wechat-token-hub/internal/store"
+	"github.com/waynecraig/wechat-token-hub/internal/wxcrypt"
+)
+
+const testEncodingAESKey = "abcdefghijklmnopqrstuvwxyz0123456789ABCDEFG"
+
+func mockComponentServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+
+		switch r.URL.Path {
+		case "/cgi-bin/component/api_component_token":
+			// check the verify ticket and secret
+			if body["component_verify_ticket"] == "verify1" && body["component_appsecret"] == "secret1" {
+				w.Write([]byte(`{"component_access_token":"ctoken1","expires_in":7200}`))
+			} else {
+				w.Write([]byte(`{"errcode":61006,"errmsg":"component ticket is invalid"}`))
+			}
+		case "/cgi-bin/component/api_create_preauthcode":
+			// check the component access token
+			if r.URL.Query().Get("component_access_token") == "ctoken1" {
+				w.Write([]byte(`{"pre_auth_code":"code1","expires_in":600}`))
+			} else {
+				w.Write([]byte(`{"errcode":40001,"errmsg":"invalid credential"}`))
+			}
+		case "/cgi-bin/component/api_query_auth":
+			// check the authorization code
+			if r.URL.Query().Get("component_access_token") == "ctoken1" && body["authorization_code"] == "authcode1" {
+				w.Write([]byte(`{"authorization_info":{"authorizer_appid":"wxa1","authorizer_access_token":"atoken1","expires_in":7200,"authorizer_refresh_token":"refresh1"}}`))
+			} else {
+				w.Write([]byte(`{"errcode":61010,"errmsg":"code is expired"}`))
+			}
+		case "/cgi-bin/component/api_authorizer_token":
+			// check the refresh token, refresh1 is replaced by refresh2
+			if r.URL.Query().Get("component_access_token") != "ctoken1" {
+				w.Write([]byte(`{"errcode":40001,"errmsg":"invalid credential"}`))
+			} else if body["authorizer_refresh_token"] == "refresh1" || body["authorizer_refresh_token"] == "refresh2" {
+				w.Write([]byte(`{"authorizer_access_token":"atoken2","expires_in":7200,"authorizer_refresh_token":"refresh2"}`))
+			} else {
+				w.Write([]byte(`{"errcode":61023,"errmsg":"refresh_token is invalid"}`))
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("404 not found"))
+		}
+	}))
+	t.Cleanup(func() {
+		server.Close()
+	})
+
+	return server
+}
+
+// build the body and query of a message pushed by wechat
+func pushComponentMessage(t *testing.T, msg string) (string, string, string, []byte) {
+	encrypted, err := wxcrypt.Encrypt(testEncodingAESKey, "component1", []byte(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	timestamp, nonce := "1409659813", "1372623149"
+	signature := wxcrypt.Signature("token1", timestamp, nonce, encrypted)
+	body := fmt.Sprintf("<xml><AppId><![CDATA[component1]]></AppId><Encrypt><![CDATA[%s]]></Encrypt></xml>", encrypted)
+	return signature, timestamp, nonce, []byte(body)
+}
+
+func setComponentEnv(t *testing.T, apiRoot string) {
+	envVars := map[string]string{
+		"WECHAT_API_ROOT":            apiRoot,
+		"COMPONENT_APPID":            "component1",
+		"COMPONENT_APPSECRET":        "secret1",
+		"COMPONENT_TOKEN":            "token1",
+		"COMPONENT_ENCODING_AES_KEY": testEncodingAESKey,
+	}
+	for k, v := range envVars {
+		os.Setenv(k, v)
+	}
+	t.Cleanup(func() {
+		for k := range envVars {
+			os.Unsetenv(k)
+		}
+	})
+}
+
+func TestHandleComponentNotification(t *testing.T) {
+	setComponentEnv(t, "")
+
+	// test a valid verify ticket message
+	signature, timestamp, nonce, body := pushComponentMessage(t,
+		"<xml><AppId>component1</AppId><InfoType>component_verify_ticket</InfoType><ComponentVerifyTicket>verify1</ComponentVerifyTicket></xml>")
+	if err := HandleComponentNotification(signature, timestamp, nonce, body); err != nil {
+		t.Errorf("HandleComponentNotification() error = %v", err)
+	}
+	if result := store.Get(componentVerifyTicketKey); result != "verify1" {
+		t.Errorf("Expect verify ticket = verify1, got %s", result)
+	}
+
+	// test a message with an invalid signature
+	if err := HandleComponentNotification("invalid", timestamp, nonce, body); err == nil {
+		t.Errorf("HandleComponentNotification() accepted an invalid signature")
+	}
+
+	// test a message with an empty verify ticket
+	signature, timestamp, nonce, body = pushComponentMessage(t,
+		"<xml><InfoType>component_verify_ticket</InfoType></xml>")
+	if err := HandleComponentNotification(signature, timestamp, nonce, body); err == nil {
+		t.Errorf("HandleComponentNotification() accepted an empty verify ticket")
+	}
+
+	// test an ignored event
+	signature, timestamp, nonce, body = pushComponentMessage(t,
+		"<xml><InfoType>notify_third_fasteregister</InfoType></xml>")
+	if err := HandleComponentNotification(signature, timestamp, nonce, body); err != nil {
+		t.Errorf("HandleComponentNotification() error = %v", err)
+	}
+}
+
+func TestGetComponentAccessToken(t *testing.T) {
+	server := mockComponentServer(t)
+	setComponentEnv(t, server.URL)
+
+	// test without a verify ticket
+	cache.DeleteCacheItem("component_access_token")
+	store.Delete(componentVerifyTicketKey)
+	if _, err := GetComponentAccessToken(""); err == nil {
+		t.Errorf("GetComponentAccessToken() should fail without verify ticket")
+	}
+
+	// test with an invalid verify ticket
+	store.Save(componentVerifyTicketKey, "verify2")
+	if _, err := GetComponentAccessToken(""); err == nil {
+		t.Errorf("GetComponentAccessToken() should fail with invalid verify ticket")
+	}
+
+	store.Save(componentVerifyTicketKey, "verify1")
+	tests := []struct {
+		name        string
+		rotateToken string
+		token       string
+	}{
+		{name: "normal", token: "ctoken1"},
+		{name: "from cache", token: "ctoken1"},
+		{name: "rotate token", rotateToken: "ctoken1", token: "ctoken1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := GetComponentAccessToken(tt.rotateToken)
+			if err != nil {
+				t.Errorf("GetComponentAccessToken() error = %v", err)
+			}
+			if token != tt.token {
+				t.Errorf("Expect component access token = %s, got %s", tt.token, token)
+			}
+		})
+	}
+}
+
+func TestGetPreAuthCode(t *testing.T) {
+	server := mockComponentServer(t)
+	setComponentEnv(t, server.URL)
+	store.Save(componentVerifyTicketKey, "verify1")
+
+	code, err := GetPreAuthCode()
+	if err != nil {
+		t.Errorf("GetPreAuthCode() error = %v", err)
+	}
+	if code != "code1" {
+		t.Errorf("Expect pre auth code = code1, got %s", code)
+	}
+
+	// the pre auth code is counted in the quota, but never cached
+	key := quotaKey(preAuthCodeProvider{})
+	defer quota.Reset(key)
+	if used := quota.Used(key); used != 1 {
+		t.Errorf("Expect 1 pre auth code call in the quota, got %d", used)
+	}
+	if value := cache.GetCacheItem("pre_auth_code"); value != "" {
+		t.Errorf("Expect the pre auth code not to be cached, got %s", value)
+	}
+	if s, ok := findStatus("pre_auth_code"); ok {
+		t.Errorf("Expect no status of the pre auth code, got %+v", s)
+	}
+}
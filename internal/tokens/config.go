@@ -0,0 +1,50 @@
+package tokens
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// CheckConfig returns an error describing the missing or invalid env vars of
+// the configured accounts
+func CheckConfig() error {
+	var errs []error
+	require := func(names ...string) {
+		for _, name := range names {
+			if os.Getenv(name) == "" {
+				errs = append(errs, fmt.Errorf("%s is not set", name))
+			}
+		}
+	}
+
+	// the official accounts and mini programs, and the third-party platform, call wechat
+	wechat := os.Getenv("APPID") != "" || os.Getenv("COMPONENT_APPID") != ""
+	for _, env := range os.Environ() {
+		if strings.HasPrefix(env, "APPSECRET_") {
+			wechat = true
+		}
+	}
+	wecom := os.Getenv("WECOM_CORPID") != ""
+	if !wechat && !wecom {
+		return fmt.Errorf("no account is configured, set APPID, APPSECRET_{appid}, COMPONENT_APPID or WECOM_CORPID")
+	}
+
+	if wechat {
+		require("WECHAT_API_ROOT")
+	}
+	if os.Getenv("APPID") != "" {
+		require("APPSECRET")
+	}
+	if os.Getenv("COMPONENT_APPID") != "" {
+		require("COMPONENT_APPSECRET", "COMPONENT_TOKEN", "COMPONENT_ENCODING_AES_KEY")
+		if key := os.Getenv("COMPONENT_ENCODING_AES_KEY"); key != "" && len(key) != 43 {
+			errs = append(errs, fmt.Errorf("COMPONENT_ENCODING_AES_KEY must be 43 characters"))
+		}
+	}
+	if wecom {
+		require("WECOM_API_ROOT")
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,67 @@
+package tokens
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCheckConfig(t *testing.T) {
+	testCases := []struct {
+		name          string
+		envVars       map[string]string
+		expectedError string
+	}{
+		{
+			name:          "No account",
+			envVars:       map[string]string{},
+			expectedError: "no account is configured",
+		},
+		{
+			name:    "Official account",
+			envVars: map[string]string{"APPID": "wx1", "APPSECRET": "secret1", "WECHAT_API_ROOT": "http://localhost"},
+		},
+		{
+			name:          "Missing secret",
+			envVars:       map[string]string{"APPID": "wx1", "WECHAT_API_ROOT": "http://localhost"},
+			expectedError: "APPSECRET is not set",
+		},
+		{
+			name:          "Other account without root",
+			envVars:       map[string]string{"APPSECRET_wx2": "secret2"},
+			expectedError: "WECHAT_API_ROOT is not set",
+		},
+		{
+			name: "Component with a short key",
+			envVars: map[string]string{"COMPONENT_APPID": "wxc", "COMPONENT_APPSECRET": "secret", "COMPONENT_TOKEN": "token",
+				"COMPONENT_ENCODING_AES_KEY": "short", "WECHAT_API_ROOT": "http://localhost"},
+			expectedError: "must be 43 characters",
+		},
+		{
+			name:          "Wecom without root",
+			envVars:       map[string]string{"WECOM_CORPID": "corp1"},
+			expectedError: "WECOM_API_ROOT is not set",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.envVars {
+				os.Setenv(k, v)
+			}
+			defer func() {
+				for k := range tc.envVars {
+					os.Unsetenv(k)
+				}
+			}()
+
+			err := CheckConfig()
+			if tc.expectedError == "" && err != nil {
+				t.Errorf("CheckConfig() error = %v", err)
+			}
+			if tc.expectedError != "" && (err == nil || !strings.Contains(err.Error(), tc.expectedError)) {
+				t.Errorf("CheckConfig() error = %v, want %q", err, tc.expectedError)
+			}
+		})
+	}
+}
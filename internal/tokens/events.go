@@ -0,0 +1,55 @@
+package tokens
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/auth"
+	"github.com/waynecraig/wechat-token-hub/internal/events"
+	"github.com/waynecraig/wechat-token-hub/internal/fingerprint"
+)
+
+// tell the subscribers the credential was replaced, so that they can drop
+// the old one they cached
+func publishRotated(ctx context.Context, p Provider, credential *Credential) {
+	e := events.Event{
+		Type:        events.TypeCredentialRotated,
+		Key:         p.Key(),
+		Source:      sourceOf(p),
+		Fingerprint: fingerprint.Of(credential.Value),
+		ExpiresAt:   time.Now().Add(time.Duration(credential.ExpiresIn) * time.Second),
+	}
+	e.AppID, e.Agent, e.CredentialType = describe(p)
+	if principal := auth.FromContext(ctx); principal != nil {
+		e.Principal = principal.Subject
+	}
+	events.Publish(e)
+}
+
+// the account and the type of the credential of the provider
+func describe(p Provider) (appid string, agent string, credentialType string) {
+	switch p := p.(type) {
+	case accessTokenProvider:
+		return appidOr(p.appid), "", "access_token"
+	case ticketProvider:
+		return appidOr(p.appid), "", p.ticketType + "_ticket"
+	case componentAccessTokenProvider:
+		return os.Getenv("COMPONENT_APPID"), "", "component_access_token"
+	case authorizerAccessTokenProvider:
+		return p.appid, "", "authorizer_access_token"
+	case wecomAccessTokenProvider:
+		return os.Getenv("WECOM_CORPID"), p.agent, "wecom_access_token"
+	case wecomTicketProvider:
+		return os.Getenv("WECOM_CORPID"), p.agent, "wecom_" + p.ticketType + "_ticket"
+	}
+	return "", "", p.Key()
+}
+
+// the appid of the account, the default one if empty
+func appidOr(appid string) string {
+	if appid == "" {
+		return os.Getenv("APPID")
+	}
+	return appid
+}
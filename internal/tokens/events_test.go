@@ -0,0 +1,74 @@
+package tokens
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/auth"
+	"github.com/waynecraig/wechat-token-hub/internal/cache"
+	"github.com/waynecraig/wechat-token-hub/internal/events"
+	"github.com/waynecraig/wechat-token-hub/internal/fingerprint"
+)
+
+func TestPublishRotated(t *testing.T) {
+	t.Setenv("ROTATE_MIN_INTERVAL", "0s")
+	subscription, unsubscribe := events.Subscribe("")
+	defer unsubscribe()
+
+	p := &fakeProvider{key: "fake_events"}
+	first, _ := Get(p, "")
+	ctx := auth.NewContext(context.Background(), &auth.Principal{Subject: "backend"})
+	second, err := GetContext(ctx, p, first)
+	if err != nil || second == first {
+		t.Fatalf("GetContext() = %s, %v, want a rotated credential", second, err)
+	}
+	defer cache.DeleteCacheItem("fake_events")
+
+	var got []events.Event
+	timeout := time.After(time.Second)
+	for len(got) < 2 {
+		select {
+		case e := <-subscription:
+			if e.Key == "fake_events" {
+				got = append(got, e)
+			}
+		case <-timeout:
+			t.Fatalf("Expected an event for each fetch, got %+v", got)
+		}
+	}
+	e := got[1]
+	if e.Type != events.TypeCredentialRotated || e.Fingerprint != fingerprint.Of(second) || e.Principal != "backend" || e.CredentialType != "fake_events" {
+		t.Errorf("Unexpected event: %+v", e)
+	}
+	if d := time.Until(e.ExpiresAt); d < 7100*time.Second || d > 7200*time.Second {
+		t.Errorf("Unexpected expiry: %v", e.ExpiresAt)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	t.Setenv("APPID", "wx_default")
+	t.Setenv("COMPONENT_APPID", "wx_component")
+	t.Setenv("WECOM_CORPID", "ww_corp")
+
+	tests := []struct {
+		p              Provider
+		appid, agent   string
+		credentialType string
+	}{
+		{accessTokenProvider{}, "wx_default", "", "access_token"},
+		{accessTokenProvider{appid: "wx1"}, "wx1", "", "access_token"},
+		{ticketProvider{appid: "wx1", ticketType: "jsapi"}, "wx1", "", "jsapi_ticket"},
+		{ticketProvider{ticketType: "wx_card"}, "wx_default", "", "wx_card_ticket"},
+		{componentAccessTokenProvider{}, "wx_component", "", "component_access_token"},
+		{authorizerAccessTokenProvider{appid: "wx2"}, "wx2", "", "authorizer_access_token"},
+		{wecomAccessTokenProvider{agent: "1000002"}, "ww_corp", "1000002", "wecom_access_token"},
+		{wecomTicketProvider{agent: "1000002", ticketType: "agent_config"}, "ww_corp", "1000002", "wecom_agent_config_ticket"},
+	}
+	for _, tt := range tests {
+		appid, agent, credentialType := describe(tt.p)
+		if appid != tt.appid || agent != tt.agent || credentialType != tt.credentialType {
+			t.Errorf("describe(%s) = %s, %s, %s, want %s, %s, %s", tt.p.Key(), appid, agent, credentialType, tt.appid, tt.agent, tt.credentialType)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package tokens
+
+import (
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/cache"
+	"github.com/waynecraig/wechat-token-hub/internal/metrics"
+)
+
+// the credential label is the cache key, which is only set for the credentials
+// of the configured accounts, the others are refused before they are counted,
+// so that the clients can't add series with made up appids, agents or types
+var (
+	cacheHits = metrics.NewCounter("wechat_token_hub_cache_hits_total",
+		"The number of credentials served from the cache.", "credential")
+	cacheMisses = metrics.NewCounter("wechat_token_hub_cache_misses_total",
+		"The number of credentials not found in the cache or rotated.", "credential")
+	rotations = metrics.NewCounter("wechat_token_hub_rotations_total",
+		"The number of rotate requests which matched the cached credential.", "credential")
+	upstreamRequests = metrics.NewCounter("wechat_token_hub_upstream_requests_total",
+		"The number of requests to the upstream API, errcode is \"error\" if the request failed.", "endpoint", "errcode")
+	upstreamDuration = metrics.NewHistogram("wechat_token_hub_upstream_request_duration_seconds",
+		"The duration of the requests to the upstream API.", metrics.DefaultBuckets, "endpoint")
+	refreshDuration = metrics.NewHistogram("wechat_token_hub_refresh_duration_seconds",
+		"The duration of fetching a new credential, including its dependency.", metrics.DefaultBuckets, "credential")
+	refreshFailures = metrics.NewCounter("wechat_token_hub_refresh_failures_total",
+		"The number of failed attempts to fetch a new credential.", "credential")
+)
+
+func init() {
+	metrics.NewGaugeFunc("wechat_token_hub_credential_expiry_seconds",
+		"The seconds until the cached credential expires.", "credential", func() map[string]float64 {
+			values := make(map[string]float64)
+			for key, expiration := range cache.Expirations() {
+				values[key] = time.Until(expiration).Seconds()
+			}
+			return values
+		})
+}
@@ -0,0 +1,28 @@
+package tokens
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/waynecraig/wechat-token-hub/internal/metrics"
+)
+
+func TestMetricsNotConfigured(t *testing.T) {
+	t.Setenv("ROTATE_MIN_INTERVAL", "0s")
+	providers := []Provider{
+		AccessTokenProvider("wx_metrics_unknown"),
+		TicketProvider("", "metrics_unknown"),
+		WecomTicketProvider("metrics_unknown", "jsapi"),
+	}
+	for _, p := range providers {
+		Get(p, "")
+		Get(p, "rotate")
+	}
+
+	var buf bytes.Buffer
+	metrics.WriteTo(&buf)
+	if strings.Contains(buf.String(), "metrics_unknown") {
+		t.Errorf("Expected no series for the credentials which are not configured:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,126 @@
+package tokens
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/vault"
+	"github.com/waynecraig/wechat-token-hub/internal/wxcrypt"
+)
+
+// wechat doesn't tell how long a session key is valid, it changes when the
+// user logs in again. The vault forgets it after SESSION_KEY_TTL.
+const defaultSessionKeyTTL = 72 * time.Hour
+
+// Session is the result of the login of a mini program user
+type Session struct {
+	OpenID     string `json:"openid"`
+	UnionID    string `json:"unionid,omitempty"`
+	SessionKey string `json:"session_key,omitempty"`
+}
+
+// ErrNoSessionKey is returned when the session key of the user is not in
+// the vault, the user should log in again
+var ErrNoSessionKey = errors.New("session key not found, the user should log in again")
+
+// ErrInvalidUserData is returned when the user data can't be decrypted with
+// the session key of the user, or was sent to another mini program
+var ErrInvalidUserData = errors.New("invalid user data")
+
+// Code2Session exchanges the code of wx.login for the openid, unionid and
+// session key of the user of a mini program
+func Code2Session(appid string, code string) (*Session, error) {
+	appid, secret, err := AccessTokenProvider(appid).(accessTokenProvider).secret()
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{
+		"appid":      {appid},
+		"secret":     {secret},
+		"js_code":    {code},
+		"grant_type": {"authorization_code"},
+	}
+	var result struct {
+		apiResult
+		Session
+	}
+	if err := getJSON(os.Getenv("WECHAT_API_ROOT")+"/sns/jscode2session?"+query.Encode(), &result); err != nil {
+		return nil, err
+	}
+	if result.OpenID == "" {
+		return nil, &APIError{Name: "code2session", ErrCode: result.ErrCode, ErrMsg: result.ErrMsg}
+	}
+
+	// the session keys are not registered for redaction, there's one per user
+	// and the session_key fields are redacted by name
+	return &result.Session, nil
+}
+
+// SaveSessionKey keeps the session key of the user in the vault
+func SaveSessionKey(appid string, openid string, sessionKey string) error {
+	return vault.Put(sessionKeyName(appid, openid), sessionKey, sessionKeyTTL())
+}
+
+// DecryptUserData decrypts the user data of a mini program, such as the
+// phone number, with the session key of the user kept in the vault, and
+// checks that the data was sent to the mini program
+func DecryptUserData(appid string, openid string, encryptedData string, iv string) ([]byte, error) {
+	sessionKey, err := sessionKey(appid, openid)
+	if err != nil {
+		return nil, err
+	}
+	data, err := wxcrypt.DecryptUserData(sessionKey, encryptedData, iv)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidUserData, err)
+	}
+
+	var result struct {
+		Watermark struct {
+			AppID string `json:"appid"`
+		} `json:"watermark"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidUserData, err)
+	}
+	if result.Watermark.AppID != appid {
+		return nil, fmt.Errorf("%w: sent to another appid %s", ErrInvalidUserData, result.Watermark.AppID)
+	}
+	return data, nil
+}
+
+// CheckUserSignature reports whether the raw user data was signed with the
+// session key of the user kept in the vault
+func CheckUserSignature(appid string, openid string, rawData string, signature string) (bool, error) {
+	sessionKey, err := sessionKey(appid, openid)
+	if err != nil {
+		return false, err
+	}
+	expected := wxcrypt.UserDataSignature(rawData, sessionKey)
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) == 1, nil
+}
+
+// read the session key of the user from the vault
+func sessionKey(appid string, openid string) (string, error) {
+	sessionKey, err := vault.Get(sessionKeyName(appid, openid))
+	if errors.Is(err, vault.ErrNotFound) {
+		return "", ErrNoSessionKey
+	}
+	return sessionKey, err
+}
+
+func sessionKeyName(appid string, openid string) string {
+	return "session_key/" + appid + "/" + openid
+}
+
+func sessionKeyTTL() time.Duration {
+	if ttl := envDuration("SESSION_KEY_TTL", defaultSessionKeyTTL); ttl > 0 {
+		return ttl
+	}
+	return defaultSessionKeyTTL
+}
@@ -0,0 +1,76 @@
+package tokens
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/waynecraig/wechat-token-hub/internal/redact"
+	"github.com/waynecraig/wechat-token-hub/internal/wxcrypt"
+	"github.com/waynecraig/wechat-token-hub/pkg/wechatmock"
+)
+
+func TestMiniProgramSession(t *testing.T) {
+	mock := wechatmock.New()
+	mock.AddAccount("wxmini", "mini_app_secret")
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	os.Setenv("WECHAT_API_ROOT", server.URL)
+	os.Setenv("APPSECRET_wxmini", "mini_app_secret")
+	t.Setenv("MASTER_KEY", "v1=MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	defer os.Unsetenv("WECHAT_API_ROOT")
+	defer os.Unsetenv("APPSECRET_wxmini")
+
+	session, err := Code2Session("wxmini", "code1")
+	if err != nil {
+		t.Fatalf("Code2Session() error = %v", err)
+	}
+	if session.OpenID != wechatmock.OpenID("wxmini", "code1") || session.SessionKey != mock.SessionKey("wxmini", session.OpenID) {
+		t.Fatalf("Code2Session() = %+v", session)
+	}
+	if redacted := redact.String(`{"session_key":"` + session.SessionKey + `"}`); strings.Contains(redacted, session.SessionKey) {
+		t.Errorf("Expected the session key to be redacted, got %s", redacted)
+	}
+
+	// the code can be used only once
+	var apiErr *APIError
+	if _, err := Code2Session("wxmini", "code1"); !errors.As(err, &apiErr) || apiErr.ErrCode != 40163 {
+		t.Errorf("Code2Session() error = %v, want 40163", err)
+	}
+	if _, err := Code2Session("wxother", "code2"); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Code2Session() error = %v, want ErrNotConfigured without APPSECRET_wxother", err)
+	}
+
+	// the session key is needed to decrypt and check the user data
+	if _, err := DecryptUserData("wxmini", session.OpenID, "", ""); !errors.Is(err, ErrNoSessionKey) {
+		t.Errorf("DecryptUserData() error = %v, want ErrNoSessionKey", err)
+	}
+	if err := SaveSessionKey("wxmini", session.OpenID, session.SessionKey); err != nil {
+		t.Fatalf("SaveSessionKey() error = %v", err)
+	}
+
+	iv := "r7BXXKkLb8qrSNn05n0qiA=="
+	data := `{"phoneNumber":"13800138000","watermark":{"appid":"wxmini","timestamp":1477314187}}`
+	encrypted, _ := wxcrypt.EncryptUserData(session.SessionKey, iv, []byte(data))
+	if got, err := DecryptUserData("wxmini", session.OpenID, encrypted, iv); err != nil || string(got) != data {
+		t.Errorf("DecryptUserData() = %s, %v", got, err)
+	}
+
+	// the data of another mini program is refused
+	other, _ := wxcrypt.EncryptUserData(session.SessionKey, iv, []byte(`{"watermark":{"appid":"wxother"}}`))
+	if _, err := DecryptUserData("wxmini", session.OpenID, other, iv); !errors.Is(err, ErrInvalidUserData) {
+		t.Errorf("DecryptUserData() accepted the data of another appid")
+	}
+
+	rawData := `{"nickName":"Band"}`
+	signature := wxcrypt.UserDataSignature(rawData, session.SessionKey)
+	if valid, err := CheckUserSignature("wxmini", session.OpenID, rawData, signature); err != nil || !valid {
+		t.Errorf("CheckUserSignature() = %v, %v, want valid", valid, err)
+	}
+	if valid, err := CheckUserSignature("wxmini", session.OpenID, `{"nickName":"Other"}`, signature); err != nil || valid {
+		t.Errorf("CheckUserSignature() = %v, %v, want invalid", valid, err)
+	}
+}
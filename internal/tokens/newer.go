@@ -0,0 +1,70 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/cache"
+	"github.com/waynecraig/wechat-token-hub/internal/events"
+	"github.com/waynecraig/wechat-token-hub/internal/fingerprint"
+)
+
+// ErrNotChanged is returned when the credential is still the one the client
+// holds at the end of the wait
+var ErrNotChanged = errors.New("the credential has not changed")
+
+// the interval the cache is checked at while waiting, in case the event of the
+// new credential was dropped
+var newerCheckInterval = time.Second
+
+// GetNewer returns the credential of the provider once it differs from the
+// one with the fingerprint the client holds. If the cached credential is that
+// one, it's rotated like with GetContext, and when the rotation is refused by
+// the rate limits or the quota, it waits up to wait for another request or the
+// hub to replace it, so that the clients racing to rotate it converge on the
+// same new credential.
+func GetNewer(ctx context.Context, p Provider, newerThan string, wait time.Duration) (string, error) {
+	// subscribe first, so that a rotation while checking is not missed
+	subscription, unsubscribe := events.Subscribe("")
+	defer unsubscribe()
+
+	value, err := GetContext(ctx, p, "")
+	if err != nil || fingerprint.Of(value) != newerThan {
+		return value, err
+	}
+
+	value, err = GetContext(ctx, p, value)
+	var rateLimitErr *RateLimitError
+	var quotaErr *QuotaError
+	if !errors.As(err, &rateLimitErr) && !errors.As(err, &quotaErr) {
+		return value, err
+	}
+
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+	check := time.NewTicker(newerCheckInterval)
+	defer check.Stop()
+	for {
+		select {
+		case e := <-subscription:
+			if e.Key != p.Key() || e.Fingerprint == newerThan {
+				continue
+			}
+		case <-check.C:
+		case <-timeout.C:
+			return "", ErrNotChanged
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+
+		// the expired credential is fetched again
+		value := cache.GetCacheItem(p.Key())
+		if value == "" {
+			return GetContext(ctx, p, "")
+		}
+		if fingerprint.Of(value) != newerThan {
+			return value, nil
+		}
+	}
+}
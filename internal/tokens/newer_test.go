@@ -0,0 +1,59 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/auth"
+	"github.com/waynecraig/wechat-token-hub/internal/cache"
+	"github.com/waynecraig/wechat-token-hub/internal/fingerprint"
+)
+
+func TestGetNewer(t *testing.T) {
+	t.Setenv("ROTATE_MIN_INTERVAL", "1h")
+	ctx := auth.NewContext(context.Background(), &auth.Principal{Subject: "backend"})
+	p := &fakeProvider{key: "fake_newer"}
+	defer cache.DeleteCacheItem("fake_newer")
+
+	// a client holding an old credential gets the cached one at once
+	current, _ := Get(p, "")
+	value, err := GetNewer(ctx, p, fingerprint.Of("old"), time.Second)
+	if err != nil || value != current {
+		t.Fatalf("GetNewer() = %s, %v, want %s", value, err, current)
+	}
+
+	// a client holding the cached credential waits while its rotation is
+	// refused, and gets the new one fetched by the hub
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		value, err := GetNewer(ctx, p, fingerprint.Of(current), 5*time.Second)
+		if err != nil || value == current || value != cache.GetCacheItem("fake_newer") {
+			t.Errorf("GetNewer() = %s, %v, want the new credential", value, err)
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if _, err := Refresh(p); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected GetNewer to return after the refresh")
+	}
+
+	// and gives up at the end of the wait
+	current = cache.GetCacheItem("fake_newer")
+	if _, err := GetNewer(ctx, p, fingerprint.Of(current), 10*time.Millisecond); !errors.Is(err, ErrNotChanged) {
+		t.Errorf("GetNewer() error = %v, want ErrNotChanged", err)
+	}
+
+	// the cached credential is rotated when the rate limits allow it
+	t.Setenv("ROTATE_MIN_INTERVAL", "0s")
+	value, err = GetNewer(ctx, p, fingerprint.Of(current), time.Second)
+	if err != nil || value == current {
+		t.Errorf("GetNewer() = %s, %v, want a rotated credential", value, err)
+	}
+}
@@ -0,0 +1,225 @@
+package tokens
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/envelope"
+	"github.com/waynecraig/wechat-token-hub/internal/store"
+	"github.com/waynecraig/wechat-token-hub/internal/vault"
+)
+
+// the refresh token of the web authorization is valid for 30 days
+const oauthRefreshTokenTTL = 30 * 24 * time.Hour
+
+// the refresh tokens of the users are kept in the store under this prefix,
+// and the expired ones are removed at most once per interval when a new one
+// is saved, so that the store only grows with the active users
+const (
+	oauthRefreshTokenPrefix = "oauth_refresh_token/"
+	oauthPruneInterval      = time.Hour
+)
+
+var (
+	oauthPruneMu sync.Mutex
+	oauthPruned  time.Time
+)
+
+// OAuthToken is the access token of a user granted by the web authorization
+// of an official account. The refresh token is kept in the store of the hub.
+type OAuthToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	OpenID      string `json:"openid"`
+	Scope       string `json:"scope"`
+	UnionID     string `json:"unionid,omitempty"`
+}
+
+// ErrNoRefreshToken is returned when the refresh token of the user is not
+// in the store or has expired, the user should be authorized again
+var ErrNoRefreshToken = errors.New("refresh token not found, the user should be authorized again")
+
+// ExchangeOAuthCode exchanges the code of the web authorization for the
+// access token of the user, and keeps the refresh token in the store
+func ExchangeOAuthCode(appid string, code string) (*OAuthToken, error) {
+	appid, secret, err := AccessTokenProvider(appid).(accessTokenProvider).secret()
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{
+		"appid":      {appid},
+		"secret":     {secret},
+		"code":       {code},
+		"grant_type": {"authorization_code"},
+	}
+	return oauthToken(appid, "oauth access token", "/sns/oauth2/access_token?"+query.Encode(), "")
+}
+
+// RefreshOAuthToken refreshes the access token of the user with the refresh
+// token kept in the store
+func RefreshOAuthToken(appid string, openid string) (*OAuthToken, error) {
+	if appid == "" {
+		appid = os.Getenv("APPID")
+	}
+	refreshToken := oauthRefreshToken(appid, openid)
+	if refreshToken == "" {
+		return nil, ErrNoRefreshToken
+	}
+
+	query := url.Values{
+		"appid":         {appid},
+		"refresh_token": {refreshToken},
+		"grant_type":    {"refresh_token"},
+	}
+	return oauthToken(appid, "oauth refresh token", "/sns/oauth2/refresh_token?"+query.Encode(), refreshToken)
+}
+
+// OAuthUserInfo returns the profile of the user authorized with the
+// snsapi_userinfo scope, as returned by wechat. The access token of the user
+// is refreshed if it has expired or is rejected.
+func OAuthUserInfo(appid string, openid string, lang string) (json.RawMessage, error) {
+	if appid == "" {
+		appid = os.Getenv("APPID")
+	}
+	call := func(accessToken string) (json.RawMessage, *apiResult, error) {
+		query := url.Values{"access_token": {accessToken}, "openid": {openid}, "lang": {lang}}
+		var data json.RawMessage
+		if err := getJSON(os.Getenv("WECHAT_API_ROOT")+"/sns/userinfo?"+query.Encode(), &data); err != nil {
+			return nil, nil, err
+		}
+		var result apiResult
+		json.Unmarshal(data, &result)
+		return data, &result, nil
+	}
+
+	accessToken, err := vault.Get(oauthName("access_token", appid, openid))
+	if err != nil {
+		token, err := RefreshOAuthToken(appid, openid)
+		if err != nil {
+			return nil, err
+		}
+		accessToken = token.AccessToken
+	}
+	data, result, err := call(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// if the access token is invalid or expired, refresh it.
+	if InvalidTokenCode(result.ErrCode) {
+		token, err := RefreshOAuthToken(appid, openid)
+		if err != nil {
+			return nil, err
+		}
+		if data, result, err = call(token.AccessToken); err != nil {
+			return nil, err
+		}
+	}
+
+	if result.ErrCode != 0 {
+		return nil, &APIError{Name: "oauth user info", ErrCode: result.ErrCode, ErrMsg: result.ErrMsg}
+	}
+	return data, nil
+}
+
+// request the access token of the user, and keep it in the vault and the
+// refresh token in the store, unless it's the current refresh token whose
+// lifetime is not extended by wechat
+func oauthToken(appid string, name string, path string, currentRefreshToken string) (*OAuthToken, error) {
+	var result struct {
+		apiResult
+		OAuthToken
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := getJSON(os.Getenv("WECHAT_API_ROOT")+path, &result); err != nil {
+		return nil, err
+	}
+	if result.AccessToken == "" {
+		return nil, &APIError{Name: name, ErrCode: result.ErrCode, ErrMsg: result.ErrMsg}
+	}
+
+	// the user tokens are not registered for redaction, there's one per user
+	// and the access_token and refresh_token fields are redacted by name
+	// without a master key the access token is not kept, the userinfo calls
+	// get a new one with the refresh token
+	expiresIn := time.Duration(result.ExpiresIn) * time.Second
+	if err := vault.Put(oauthName("access_token", appid, result.OpenID), result.AccessToken, expiresIn); err != nil && !errors.Is(err, envelope.ErrNoKey) {
+		return nil, err
+	}
+	if result.RefreshToken != "" && result.RefreshToken != currentRefreshToken {
+		if err := saveOAuthRefreshToken(appid, result.OpenID, result.RefreshToken); err != nil {
+			return nil, err
+		}
+	}
+	return &result.OAuthToken, nil
+}
+
+// the refresh token of a user in the store, with the time it expires
+type oauthRefresh struct {
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// keep the refresh token in the store, so that the users don't need to be
+// authorized again after a restart
+func saveOAuthRefreshToken(appid string, openid string, refreshToken string) error {
+	data, err := json.Marshal(oauthRefresh{RefreshToken: refreshToken, ExpiresAt: time.Now().Add(oauthRefreshTokenTTL)})
+	if err != nil {
+		return err
+	}
+	pruneOAuthRefreshTokens()
+	return store.Save(oauthName("refresh_token", appid, openid), string(data))
+}
+
+// read the refresh token of the user from the store, the expired ones are
+// removed. Returns an empty string if there's none.
+func oauthRefreshToken(appid string, openid string) string {
+	key := oauthName("refresh_token", appid, openid)
+	refreshToken, ok := readOAuthRefreshToken(key)
+	if !ok {
+		store.Delete(key)
+	}
+	return refreshToken
+}
+
+// read the refresh token stored under key, ok is false if it's missing,
+// invalid or expired
+func readOAuthRefreshToken(key string) (string, bool) {
+	var refresh oauthRefresh
+	if err := json.Unmarshal([]byte(store.Get(key)), &refresh); err != nil || !refresh.ExpiresAt.After(time.Now()) {
+		return "", false
+	}
+	return refresh.RefreshToken, true
+}
+
+// remove the expired refresh tokens of all the users from the store, unless
+// it was done within the interval
+func pruneOAuthRefreshTokens() {
+	oauthPruneMu.Lock()
+	if time.Since(oauthPruned) < oauthPruneInterval {
+		oauthPruneMu.Unlock()
+		return
+	}
+	oauthPruned = time.Now()
+	oauthPruneMu.Unlock()
+
+	var expired []string
+	for _, key := range store.Keys(oauthRefreshTokenPrefix) {
+		if _, ok := readOAuthRefreshToken(key); !ok {
+			expired = append(expired, key)
+		}
+	}
+	if err := store.Delete(expired...); err != nil {
+		slog.Error("prune oauth refresh tokens fail", "error", err)
+	}
+}
+
+func oauthName(kind string, appid string, openid string) string {
+	return "oauth_" + kind + "/" + appid + "/" + openid
+}
@@ -0,0 +1,98 @@
+package tokens
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/store"
+	"github.com/waynecraig/wechat-token-hub/internal/vault"
+	"github.com/waynecraig/wechat-token-hub/pkg/wechatmock"
+)
+
+func TestOAuth(t *testing.T) {
+	mock := wechatmock.New()
+	mock.AddAccount("wxoauth", "oauth_app_secret")
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	os.Setenv("WECHAT_API_ROOT", server.URL)
+	os.Setenv("APPSECRET_wxoauth", "oauth_app_secret")
+	t.Setenv("STORE_FILE", filepath.Join(t.TempDir(), "store.json"))
+	t.Setenv("MASTER_KEY", "v1=MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	defer os.Unsetenv("WECHAT_API_ROOT")
+	defer os.Unsetenv("APPSECRET_wxoauth")
+
+	token, err := ExchangeOAuthCode("wxoauth", "code1")
+	if err != nil {
+		t.Fatalf("ExchangeOAuthCode() error = %v", err)
+	}
+	if token.OpenID != wechatmock.OpenID("wxoauth", "code1") || token.AccessToken == "" {
+		t.Fatalf("ExchangeOAuthCode() = %+v", token)
+	}
+	var apiErr *APIError
+	if _, err := ExchangeOAuthCode("wxoauth", "code1"); !errors.As(err, &apiErr) || apiErr.ErrCode != 40163 {
+		t.Errorf("ExchangeOAuthCode() error = %v, want 40163", err)
+	}
+	if _, err := ExchangeOAuthCode("wxother", "code2"); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("ExchangeOAuthCode() error = %v, want ErrNotConfigured without APPSECRET_wxother", err)
+	}
+
+	info, err := OAuthUserInfo("wxoauth", token.OpenID, "zh_CN")
+	if err != nil || !strings.Contains(string(info), token.OpenID) {
+		t.Errorf("OAuthUserInfo() = %s, %v", info, err)
+	}
+
+	// the refresh token is kept in the store, not the vault
+	if _, err := vault.Get(oauthName("refresh_token", "wxoauth", token.OpenID)); !errors.Is(err, vault.ErrNotFound) {
+		t.Errorf("Expected the refresh token not to be in the vault")
+	}
+	if oauthRefreshToken("wxoauth", token.OpenID) == "" {
+		t.Errorf("Expected the refresh token in the store")
+	}
+
+	// a rejected access token is refreshed with the refresh token in the store
+	vault.Put(oauthName("access_token", "wxoauth", token.OpenID), "stale", time.Hour)
+	if info, err := OAuthUserInfo("wxoauth", token.OpenID, "zh_CN"); err != nil || !strings.Contains(string(info), token.OpenID) {
+		t.Errorf("OAuthUserInfo() = %s, %v after refreshing", info, err)
+	}
+
+	refreshed, err := RefreshOAuthToken("wxoauth", token.OpenID)
+	if err != nil || refreshed.AccessToken == token.AccessToken {
+		t.Errorf("RefreshOAuthToken() = %+v, %v", refreshed, err)
+	}
+
+	// the users never authorized have no refresh token
+	if _, err := RefreshOAuthToken("wxoauth", "unknown"); !errors.Is(err, ErrNoRefreshToken) {
+		t.Errorf("RefreshOAuthToken() error = %v, want ErrNoRefreshToken", err)
+	}
+	if _, err := OAuthUserInfo("wxoauth", "unknown", "zh_CN"); !errors.Is(err, ErrNoRefreshToken) {
+		t.Errorf("OAuthUserInfo() error = %v, want ErrNoRefreshToken", err)
+	}
+
+	// the expired refresh tokens of the other users are removed when a new
+	// one is saved
+	other := oauthName("refresh_token", "wxoauth", "other")
+	store.Save(other, `{"refresh_token":"other_refresh_token","expires_at":"2020-01-01T00:00:00Z"}`)
+	oauthPruned = time.Time{}
+	if _, err := ExchangeOAuthCode("wxoauth", "code3"); err != nil {
+		t.Fatalf("ExchangeOAuthCode() error = %v", err)
+	}
+	if store.Get(other) != "" {
+		t.Errorf("Expected the expired refresh token of the other user to be removed")
+	}
+
+	// and the expired refresh tokens read are removed
+	key := oauthName("refresh_token", "wxoauth", "expired")
+	store.Save(key, `{"refresh_token":"expired_refresh_token","expires_at":"2020-01-01T00:00:00Z"}`)
+	if _, err := RefreshOAuthToken("wxoauth", "expired"); !errors.Is(err, ErrNoRefreshToken) {
+		t.Errorf("RefreshOAuthToken() error = %v, want ErrNoRefreshToken for an expired token", err)
+	}
+	if store.Get(key) != "" {
+		t.Errorf("Expected the expired refresh token to be removed")
+	}
+}
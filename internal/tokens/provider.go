@@ -0,0 +1,368 @@
+package tokens
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/audit"
+	"github.com/waynecraig/wechat-token-hub/internal/cache"
+	"github.com/waynecraig/wechat-token-hub/internal/fingerprint"
+	"github.com/waynecraig/wechat-token-hub/internal/logging"
+	"github.com/waynecraig/wechat-token-hub/internal/quota"
+	"github.com/waynecraig/wechat-token-hub/internal/redact"
+)
+
+// Credential is a token or ticket issued by an upstream API
+type Credential struct {
+	Value string
+	// seconds until the credential expires, parsed from the upstream response
+	ExpiresIn int
+}
+
+// ErrorClass tells the engine how to react to an error returned by a provider
+type ErrorClass int
+
+const (
+	// the error can not be fixed by retrying
+	ErrorFatal ErrorClass = iota
+	// the dependency credential was rejected, rotate it and retry once
+	ErrorInvalidDependency
+)
+
+// Provider fetches one kind of credential from an upstream API, the engine
+// takes care of caching, rotating and refreshing its dependency
+type Provider interface {
+	// Key returns the cache key of the credential, an empty key means the
+	// credential is not cached
+	Key() string
+	// Dependency returns the provider of the credential needed to fetch this
+	// one, or nil if it has no dependency
+	Dependency() Provider
+	// Fetch requests a new credential from upstream, dep is the current value
+	// of the dependency credential
+	Fetch(dep string) (*Credential, error)
+	// Classify tells how an error returned by Fetch should be handled
+	Classify(err error) ErrorClass
+}
+
+// APIError is an error response of the upstream API
+type APIError struct {
+	// the name of the credential being fetched
+	Name    string
+	ErrCode int
+	ErrMsg  string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("fetch %s fail, code: %d, message: %s", e.Name, e.ErrCode, e.ErrMsg)
+}
+
+// QuotaError is returned when a rotation is refused because the daily budget
+// of upstream calls is almost used up
+type QuotaError struct {
+	Key string
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("rotate %s refused, the daily quota is almost used up", e.Key)
+}
+
+// uncached is implemented by the providers of the credentials which are used
+// once, such as the pre auth codes, they are fetched for each request and
+// never cached
+type uncached interface {
+	uncached()
+}
+
+// whether the credential of the provider is saved to the cache
+func cacheable(p Provider) bool {
+	_, ok := p.(uncached)
+	return p.Key() != "" && !ok
+}
+
+// ErrNotConfigured is returned before any upstream call for a credential of
+// an account or a type which is not configured
+var ErrNotConfigured = errors.New("credential not configured")
+
+// checker is implemented by the providers which check the account and the
+// type of their credential, before the engine takes a lock, counts the
+// request or calls upstream for it
+type checker interface {
+	check() error
+}
+
+// the fields shared by all wechat API responses
+type apiResult struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+// one lock for each cache key, so that concurrent requests don't fetch the
+// same credential twice and invalidate each other. The lock of a key is
+// removed once no request holds or waits for it.
+var (
+	locksMu sync.Mutex
+	locks   = make(map[string]*keyLock)
+)
+
+type keyLock struct {
+	sync.Mutex
+	// the requests holding or waiting for the lock
+	users int
+}
+
+// Get returns the credential of the provider from the cache, or fetches a new
+// one if it's not cached or the caller asks to rotate the cached one
+func Get(p Provider, rotate string) (string, error) {
+	return GetContext(context.Background(), p, rotate)
+}
+
+// GetContext is like Get, the rotations requested by the principal in ctx
+// are subject to the rate limits
+func GetContext(ctx context.Context, p Provider, rotate string) (string, error) {
+	key := p.Key()
+
+	fields := logging.FromContext(ctx)
+
+	// check if the credential is in the cache and not the one to rotate
+	if value, ok := cached(key, rotate); ok {
+		cacheHits.Inc(key)
+		fields.CacheHit(key)
+		return value, nil
+	}
+
+	// the credentials which are not configured are never cached, refuse them
+	// before they get a lock and metrics of their own
+	if c, ok := p.(checker); ok {
+		if err := c.check(); err != nil {
+			return "", err
+		}
+	}
+
+	unlock := lock(key)
+	defer unlock()
+
+	// another request may have refreshed the credential while waiting for the lock
+	if value, ok := cached(key, rotate); ok {
+		cacheHits.Inc(key)
+		fields.CacheHit(key)
+		return value, nil
+	}
+
+	cacheMisses.Inc(key)
+	fields.CacheMiss(key)
+	rotating := rotate != "" && rotate == cache.GetCacheItem(key)
+	if rotating {
+		if err := allowRotate(ctx, key, quotaKey(p)); err != nil {
+			auditRotate(ctx, audit.EventRotateRejected, key, rotate, "", err)
+			return "", err
+		}
+		rotations.Inc(key)
+	}
+
+	start := time.Now()
+	defer func() {
+		fields.AddUpstream(time.Since(start))
+	}()
+	value, err := refresh(ctx, p)
+	if rotating {
+		auditRotate(ctx, audit.EventRotate, key, rotate, value, err)
+	}
+	return value, err
+}
+
+// GetByFingerprint is like GetContext, with the credential to rotate given by
+// its fingerprint, so that the clients don't need to send the credential
+// itself. It's only rotated if the cached credential has that fingerprint.
+func GetByFingerprint(ctx context.Context, p Provider, rotateFingerprint string) (string, error) {
+	rotate := ""
+	if value := cache.GetCacheItem(p.Key()); value != "" && fingerprint.Of(value) == rotateFingerprint {
+		rotate = value
+	}
+	return GetContext(ctx, p, rotate)
+}
+
+// Refresh fetches a new credential of the provider and caches it, whether the
+// cached one is expired or not
+func Refresh(p Provider) (string, error) {
+	unlock := lock(p.Key())
+	defer unlock()
+
+	return refresh(context.Background(), p)
+}
+
+// fetch and cache the credential, the caller must hold the lock of the key
+func refresh(ctx context.Context, p Provider) (string, error) {
+	start := time.Now()
+	credential, err := fetch(p)
+	refreshDuration.Observe(time.Since(start).Seconds(), p.Key())
+	auditFetch(ctx, p.Key(), credential, err)
+	recordStatus(p, err)
+	if err != nil {
+		refreshFailures.Inc(p.Key())
+		return "", err
+	}
+
+	// the credential must never show up in the logs and error responses,
+	// remember it a bit longer than it's valid
+	redact.Register(time.Duration(credential.ExpiresIn)*time.Second+time.Hour, credential.Value)
+
+	// save the credential to the cache
+	if cacheable(p) {
+		cache.SaveCacheItem(p.Key(), credential.Value, credential.ExpiresIn)
+		publishRotated(ctx, p, credential)
+	}
+
+	return credential.Value, nil
+}
+
+// fetch a new credential, rotating the dependency once if it's rejected
+func fetch(p Provider) (*Credential, error) {
+	dependency := p.Dependency()
+	if dependency == nil {
+		return fetchCounted(p, "")
+	}
+
+	dep, err := Get(dependency, "")
+	if err != nil {
+		return nil, err
+	}
+	credential, err := fetchCounted(p, dep)
+
+	// if the dependency is invalid or expired, rotate it.
+	if err != nil && p.Classify(err) == ErrorInvalidDependency {
+		dep, err = Get(dependency, dep)
+		if err != nil {
+			return nil, err
+		}
+		credential, err = fetchCounted(p, dep)
+	}
+
+	return credential, err
+}
+
+// call the provider and count the call in the daily quota
+func fetchCounted(p Provider, dep string) (*Credential, error) {
+	quota.Record(quotaKey(p))
+	return p.Fetch(dep)
+}
+
+// return the cached credential of key unless it's the one to rotate
+func cached(key string, rotate string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	value := cache.GetCacheItem(key)
+	if value == "" || (rotate != "" && rotate == value) {
+		return "", false
+	}
+	return value, true
+}
+
+func lock(key string) func() {
+	locksMu.Lock()
+	l, ok := locks[key]
+	if !ok {
+		l = &keyLock{}
+		locks[key] = l
+	}
+	l.users++
+	locksMu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+
+		locksMu.Lock()
+		defer locksMu.Unlock()
+		l.users--
+		if l.users == 0 {
+			delete(locks, key)
+		}
+	}
+}
+
+// InvalidTokenCode reports whether the error code returned by wechat or wecom
+// means the access token is invalid or expired
+func InvalidTokenCode(errcode int) bool {
+	switch errcode {
+	case 40001, 40014, 42001:
+		return true
+	}
+	return false
+}
+
+// classify the error codes returned by wechat and wecom for an invalid or
+// expired access token
+func classifyInvalidToken(err error) ErrorClass {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && InvalidTokenCode(apiErr.ErrCode) {
+		return ErrorInvalidDependency
+	}
+	return ErrorFatal
+}
+
+// request the upstream API and decode the json response into result
+func getJSON(url string, result interface{}) error {
+	start := time.Now()
+	resp, err := UpstreamClient.Get(url)
+	return decodeResponse(url, start, resp, err, result)
+}
+
+// post a json body to the upstream API and decode the json response into result
+func postJSON(url string, body interface{}, result interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	resp, err := UpstreamClient.Post(url, "application/json", bytes.NewReader(data))
+	return decodeResponse(url, start, resp, err, result)
+}
+
+// decode the json response into result, and record the upstream metrics
+func decodeResponse(rawURL string, start time.Time, resp *http.Response, err error, result interface{}) error {
+	// the endpoint is the path of the url, without the root and the query
+	endpoint := rawURL
+	if u, parseErr := url.Parse(rawURL); parseErr == nil {
+		endpoint = u.Path
+	}
+	defer func() {
+		upstreamDuration.Observe(time.Since(start).Seconds(), endpoint)
+	}()
+
+	if err != nil {
+		upstreamRequests.Inc(endpoint, "error")
+		recordUpstreamError(UpstreamError{Endpoint: endpoint, Error: err.Error()})
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err == nil {
+		err = json.Unmarshal(data, result)
+	}
+	if err != nil {
+		upstreamRequests.Inc(endpoint, "error")
+		recordUpstreamError(UpstreamError{Endpoint: endpoint, Error: err.Error()})
+		return err
+	}
+
+	var errResult apiResult
+	json.Unmarshal(data, &errResult)
+	upstreamRequests.Inc(endpoint, strconv.Itoa(errResult.ErrCode))
+	if errResult.ErrCode != 0 {
+		recordUpstreamError(UpstreamError{Endpoint: endpoint, ErrCode: errResult.ErrCode, ErrMsg: errResult.ErrMsg})
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/waynecraig/wechat-token-hub/internal/cache"
+	"github.com/waynecraig/wechat-token-hub/internal/fingerprint"
+)
+
+// a provider counting its fetches, the dependency value must be "dep1"
+// after being rotated once
+type fakeProvider struct {
+	key        string
+	dependency Provider
+	fetches    int32
+}
+
+func (p *fakeProvider) Key() string {
+	return p.key
+}
+
+func (p *fakeProvider) Dependency() Provider {
+	return p.dependency
+}
+
+func (p *fakeProvider) Fetch(dep string) (*Credential, error) {
+	n := atomic.AddInt32(&p.fetches, 1)
+	if p.dependency != nil && dep != "dep2" {
+		return nil, &APIError{Name: p.key, ErrCode: 40001, ErrMsg: "invalid credential"}
+	}
+	return &Credential{Value: fmt.Sprintf("%s%d", p.key, n), ExpiresIn: 7200}, nil
+}
+
+func (p *fakeProvider) Classify(err error) ErrorClass {
+	return classifyInvalidToken(err)
+}
+
+func TestGetConcurrent(t *testing.T) {
+	p := &fakeProvider{key: "fake_concurrent"}
+
+	// concurrent requests should share one fetch
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if value, err := Get(p, ""); err != nil || value != "fake_concurrent1" {
+				t.Errorf("Get() = %s, %v, want fake_concurrent1", value, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if p.fetches != 1 {
+		t.Errorf("Expect 1 fetch, got %d", p.fetches)
+	}
+
+	// rotating an outdated value should return the cached one
+	if value, _ := Get(p, "outdated"); value != "fake_concurrent1" {
+		t.Errorf("Get() = %s, want fake_concurrent1", value)
+	}
+
+	// rotating the cached value should fetch a new one
+	if value, _ := Get(p, "fake_concurrent1"); value != "fake_concurrent2" {
+		t.Errorf("Get() = %s, want fake_concurrent2", value)
+	}
+
+	// refresh should always fetch a new one
+	if value, _ := Refresh(p); value != "fake_concurrent3" {
+		t.Errorf("Refresh() = %s, want fake_concurrent3", value)
+	}
+}
+
+func TestGetDependency(t *testing.T) {
+	// the cached dependency is rejected, it should be rotated to dep2
+	cache.SaveCacheItem("dep", "dep1", 3600)
+	dep := &fakeProvider{key: "dep", fetches: 1}
+	p := &fakeProvider{key: "fake_dependent", dependency: dep}
+
+	value, err := Get(p, "")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if value != "fake_dependent2" {
+		t.Errorf("Get() = %s, want fake_dependent2", value)
+	}
+	if dep.fetches != 2 {
+		t.Errorf("Expect dependency fetched once, got %d", dep.fetches-1)
+	}
+
+	// a provider without key is never cached
+	p = &fakeProvider{key: "", dependency: dep}
+	for i := 0; i < 2; i++ {
+		if _, err := Get(p, ""); err != nil {
+			t.Errorf("Get() error = %v", err)
+		}
+	}
+	if p.fetches != 2 {
+		t.Errorf("Expect 2 fetches without cache, got %d", p.fetches)
+	}
+}
+
+func TestGetNotConfigured(t *testing.T) {
+	tests := []Provider{
+		AccessTokenProvider("wx_not_configured"),
+		TicketProvider("", "unknown"),
+		WecomAccessTokenProvider("not_configured"),
+		WecomTicketProvider("not_configured", "jsapi"),
+		AuthorizerAccessTokenProvider("wx_not_authorized"),
+	}
+	for _, p := range tests {
+		if _, err := Get(p, ""); !errors.Is(err, ErrNotConfigured) {
+			t.Errorf("Get(%s) error = %v, want ErrNotConfigured", p.Key(), err)
+		}
+	}
+
+	// the locks of the keys are removed once released
+	locksMu.Lock()
+	defer locksMu.Unlock()
+	if len(locks) != 0 {
+		t.Errorf("Expected no lock left, got %d", len(locks))
+	}
+}
+
+func TestGetByFingerprint(t *testing.T) {
+	cache.SaveCacheItem("fake_fingerprint", "fake_fingerprint0", 3600)
+	defer cache.DeleteCacheItem("fake_fingerprint")
+	p := &fakeProvider{key: "fake_fingerprint"}
+
+	// an outdated fingerprint returns the cached credential
+	value, err := GetByFingerprint(context.Background(), p, fingerprint.Of("fake_fingerprint_old"))
+	if err != nil || value != "fake_fingerprint0" || p.fetches != 0 {
+		t.Fatalf("GetByFingerprint() = %s, %v after %d fetches, want the cached credential", value, err, p.fetches)
+	}
+
+	// the fingerprint of the cached credential rotates it
+	value, err = GetByFingerprint(context.Background(), p, fingerprint.Of("fake_fingerprint0"))
+	if err != nil || value != "fake_fingerprint1" {
+		t.Errorf("GetByFingerprint() = %s, %v, want fake_fingerprint1", value, err)
+	}
+}
+
+func TestClassifyInvalidToken(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorClass
+	}{
+		{&APIError{ErrCode: 40001}, ErrorInvalidDependency},
+		{&APIError{ErrCode: 40014}, ErrorInvalidDependency},
+		{&APIError{ErrCode: 42001}, ErrorInvalidDependency},
+		{&APIError{ErrCode: 45009}, ErrorFatal},
+		{fmt.Errorf("code: 40001"), ErrorFatal},
+	}
+	for _, tt := range tests {
+		if result := classifyInvalidToken(tt.err); result != tt.want {
+			t.Errorf("classifyInvalidToken(%v) = %v, want %v", tt.err, result, tt.want)
+		}
+	}
+}
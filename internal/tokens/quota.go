@@ -0,0 +1,127 @@
+package tokens
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/waynecraig/wechat-token-hub/internal/quota"
+)
+
+// APIQuota is the quota of an API reported by wechat
+type APIQuota struct {
+	DailyLimit int `json:"daily_limit"`
+	Used       int `json:"used"`
+	Remain     int `json:"remain"`
+}
+
+// GetAPIQuota asks wechat for the quota of an API of an official account,
+// such as /cgi-bin/token
+func GetAPIQuota(appid string, cgiPath string) (*APIQuota, error) {
+	var result struct {
+		apiResult
+		Quota APIQuota `json:"quota"`
+	}
+	err := callWithAccessToken(appid, "api quota", func(accessToken string) error {
+		url := fmt.Sprintf("%s/cgi-bin/openapi/quota/get?access_token=%s", os.Getenv("WECHAT_API_ROOT"), accessToken)
+		body := map[string]string{
+			"cgi_path": cgiPath,
+		}
+		return postJSON(url, body, &result)
+	}, &result.apiResult)
+	if err != nil {
+		return nil, err
+	}
+	return &result.Quota, nil
+}
+
+// ClearQuota asks wechat to reset the daily quota of all the APIs of an
+// official account, which can be done only a few times a month
+func ClearQuota(appid string) error {
+	if appid == "" {
+		appid = os.Getenv("APPID")
+	}
+	var result apiResult
+	err := callWithAccessToken(appid, "clear quota", func(accessToken string) error {
+		url := fmt.Sprintf("%s/cgi-bin/clear_quota?access_token=%s", os.Getenv("WECHAT_API_ROOT"), accessToken)
+		body := map[string]string{
+			"appid": appid,
+		}
+		return postJSON(url, body, &result)
+	}, &result)
+	if err != nil {
+		return err
+	}
+
+	// the local counters of the account are cleared as well
+	quota.Reset(
+		quotaKey(AccessTokenProvider(appid)),
+		quotaKey(TicketProvider(appid, "jsapi")),
+	)
+	return nil
+}
+
+// the key of the upstream calls of the provider in the daily quota. WeChat
+// counts the calls of each account to each API, so the jsapi and wx_card
+// tickets share the quota of getticket.
+func quotaKey(p Provider) string {
+	switch p := p.(type) {
+	case accessTokenProvider:
+		return quotaAccount(p.appid) + ":/cgi-bin/token"
+	case ticketProvider:
+		return quotaAccount(p.appid) + ":/cgi-bin/ticket/getticket"
+	case componentAccessTokenProvider:
+		return os.Getenv("COMPONENT_APPID") + ":/cgi-bin/component/api_component_token"
+	case preAuthCodeProvider:
+		return os.Getenv("COMPONENT_APPID") + ":/cgi-bin/component/api_create_preauthcode"
+	case authorizerAccessTokenProvider:
+		// the authorizer tokens are counted in the quota of the platform
+		return os.Getenv("COMPONENT_APPID") + ":/cgi-bin/component/api_authorizer_token"
+	case wecomAccessTokenProvider:
+		return "wecom_" + p.agent + ":/cgi-bin/gettoken"
+	case wecomTicketProvider:
+		if p.ticketType == "agent_config" {
+			return "wecom_" + p.agent + ":/cgi-bin/ticket/get"
+		}
+		return "wecom_" + p.agent + ":/cgi-bin/get_jsapi_ticket"
+	}
+	return p.Key()
+}
+
+// the appid of the account in the quota keys, "default" for the APPID if it's
+// not set
+func quotaAccount(appid string) string {
+	if appid = appidOr(appid); appid == "" {
+		return "default"
+	}
+	return appid
+}
+
+// call an API with the access token of the account, and rotate the token
+// once if wechat rejects it
+func callWithAccessToken(appid string, name string, call func(accessToken string) error, result *apiResult) error {
+	p := AccessTokenProvider(appid)
+	accessToken, err := Get(p, "")
+	if err != nil {
+		return err
+	}
+	if err := call(accessToken); err != nil {
+		return err
+	}
+
+	// if the access token is invalid or expired, rotate it.
+	if classifyInvalidToken(&APIError{ErrCode: result.ErrCode}) == ErrorInvalidDependency {
+		accessToken, err = Get(p, accessToken)
+		if err != nil {
+			return err
+		}
+		*result = apiResult{}
+		if err := call(accessToken); err != nil {
+			return err
+		}
+	}
+
+	if result.ErrCode != 0 {
+		return &APIError{Name: name, ErrCode: result.ErrCode, ErrMsg: result.ErrMsg}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package tokens
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/waynecraig/wechat-token-hub/internal/cache"
+	"github.com/waynecraig/wechat-token-hub/internal/quota"
+)
+
+func TestRotateQuota(t *testing.T) {
+	server := mockWechatServer(t)
+	os.Setenv("WECHAT_API_ROOT", server.URL)
+	os.Setenv("APPSECRET", "secret1")
+	os.Setenv("QUOTA_DAILY_LIMIT", "2")
+	defer os.Unsetenv("WECHAT_API_ROOT")
+	defer os.Unsetenv("APPSECRET")
+	defer os.Unsetenv("QUOTA_DAILY_LIMIT")
+	quota.Reset(quotaKey(AccessTokenProvider("")))
+	cache.DeleteCacheItem("access_token")
+	defer cache.DeleteCacheItem("access_token")
+
+	// the first fetch and rotation are within the budget
+	if _, err := GetAccessToken(""); err != nil {
+		t.Fatalf("GetAccessToken() error = %v", err)
+	}
+	if _, err := GetAccessToken("token1"); err != nil {
+		t.Fatalf("GetAccessToken() error = %v", err)
+	}
+
+	// the next rotation is refused
+	_, err := GetAccessToken("token1")
+	var quotaErr *QuotaError
+	if !errors.As(err, &quotaErr) {
+		t.Errorf("GetAccessToken() error = %v, want QuotaError", err)
+	}
+
+	// but the cached token is still served
+	if token, err := GetAccessToken(""); err != nil || token != "token1" {
+		t.Errorf("GetAccessToken() = %s, %v, want token1", token, err)
+	}
+
+	// clearing the quota resets the counters
+	if err := ClearQuota(""); err != nil {
+		t.Fatalf("ClearQuota() error = %v", err)
+	}
+	if n := quota.Used(quotaKey(AccessTokenProvider(""))); n != 0 {
+		t.Errorf("Expect quota reset, got %d used", n)
+	}
+}
+
+func TestGetAPIQuota(t *testing.T) {
+	server := mockWechatServer(t)
+	os.Setenv("WECHAT_API_ROOT", server.URL)
+	os.Setenv("APPSECRET", "secret1")
+	defer os.Unsetenv("WECHAT_API_ROOT")
+	defer os.Unsetenv("APPSECRET")
+
+	// a stale token is rotated
+	cache.SaveCacheItem("access_token", "stale", 3600)
+	defer cache.DeleteCacheItem("access_token")
+
+	result, err := GetAPIQuota("", "/cgi-bin/token")
+	if err != nil {
+		t.Fatalf("GetAPIQuota() error = %v", err)
+	}
+	if result.DailyLimit != 2000 || result.Used != 5 || result.Remain != 1995 {
+		t.Errorf("GetAPIQuota() = %+v, want 2000 limit and 5 used", result)
+	}
+}
+
+func TestQuotaKey(t *testing.T) {
+	t.Setenv("APPID", "wx_default")
+	t.Setenv("COMPONENT_APPID", "wx_component")
+
+	tests := []struct {
+		p    Provider
+		want string
+	}{
+		{AccessTokenProvider(""), "wx_default:/cgi-bin/token"},
+		{AccessTokenProvider("wx_default"), "wx_default:/cgi-bin/token"},
+		{AccessTokenProvider("wx1"), "wx1:/cgi-bin/token"},
+		// the tickets of an account share the quota of getticket
+		{TicketProvider("wx1", "jsapi"), "wx1:/cgi-bin/ticket/getticket"},
+		{TicketProvider("wx1", "wx_card"), "wx1:/cgi-bin/ticket/getticket"},
+		{ComponentAccessTokenProvider(), "wx_component:/cgi-bin/component/api_component_token"},
+		{AuthorizerAccessTokenProvider("wx2"), "wx_component:/cgi-bin/component/api_authorizer_token"},
+		{WecomAccessTokenProvider("1000001"), "wecom_1000001:/cgi-bin/gettoken"},
+		{WecomTicketProvider("1000001", "jsapi"), "wecom_1000001:/cgi-bin/get_jsapi_ticket"},
+		{WecomTicketProvider("1000001", "agent_config"), "wecom_1000001:/cgi-bin/ticket/get"},
+	}
+	for _, tt := range tests {
+		if got := quotaKey(tt.p); got != tt.want {
+			t.Errorf("quotaKey(%s) = %s, want %s", tt.p.Key(), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package tokens
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/auth"
+	"github.com/waynecraig/wechat-token-hub/internal/cache"
+	"github.com/waynecraig/wechat-token-hub/internal/quota"
+	"github.com/waynecraig/wechat-token-hub/internal/ratelimit"
+)
+
+// the default limits of the rotations requested by clients
+const (
+	defaultRotateMinInterval     = 10 * time.Second
+	defaultRotateClientPerMinute = 2
+	defaultRotateClientBurst     = 2
+	defaultRotateGlobalPerMinute = 5
+	defaultRotateGlobalBurst     = 5
+)
+
+// RateLimitError is returned when a rotation is refused by the rate limits
+type RateLimitError struct {
+	Key        string
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rotate %s refused, %s", e.Key, e.Reason)
+}
+
+// check if a rotation of the cached credential may be honored. The quota is
+// checked for every rotation, while the rate limits only apply to the
+// rotations requested by clients, the hub rotates a dependency only when
+// wechat rejects it.
+func allowRotate(ctx context.Context, key string, quotaKey string) error {
+	// keep the remaining budget for the refreshes of expired credentials
+	if quota.Exceeded(quotaKey) {
+		return &QuotaError{Key: key}
+	}
+
+	principal := auth.FromContext(ctx)
+	if principal == nil {
+		return nil
+	}
+
+	// the credential was just refreshed, the client probably holds an old one
+	minInterval := envDuration("ROTATE_MIN_INTERVAL", defaultRotateMinInterval)
+	if age := time.Since(cache.GetCacheItemCreation(key)); age < minInterval {
+		return &RateLimitError{Key: key, Reason: "the credential was refreshed too recently", RetryAfter: minInterval - age}
+	}
+
+	// check the client first, so that a client in a retry loop doesn't use up
+	// the global budget. The client is the key id of its JWT, since it may
+	// put any subject in the tokens it signs.
+	client := ratelimit.Shared("rotate_client", envFloat("ROTATE_CLIENT_PER_MINUTE", defaultRotateClientPerMinute), envInt("ROTATE_CLIENT_BURST", defaultRotateClientBurst))
+	if result := client.Allow(principal.KeyID + "\n" + key); !result.Allowed {
+		return &RateLimitError{Key: key, Reason: "too many rotations from " + principal.KeyID, RetryAfter: result.RetryAfter}
+	}
+
+	global := ratelimit.Shared("rotate_global", envFloat("ROTATE_GLOBAL_PER_MINUTE", defaultRotateGlobalPerMinute), envInt("ROTATE_GLOBAL_BURST", defaultRotateGlobalBurst))
+	if result := global.Allow(key); !result.Allowed {
+		return &RateLimitError{Key: key, Reason: "too many rotations", RetryAfter: result.RetryAfter}
+	}
+	return nil
+}
+
+func envDuration(name string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return d
+}
+
+func envFloat(name string, def float64) float64 {
+	f, err := strconv.ParseFloat(os.Getenv(name), 64)
+	if err != nil || f <= 0 {
+		return def
+	}
+	return f
+}
+
+func envInt(name string, def int) int {
+	i, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || i <= 0 {
+		return def
+	}
+	return i
+}
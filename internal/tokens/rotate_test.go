@@ -0,0 +1,78 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/waynecraig/wechat-token-hub/internal/auth"
+	"github.com/waynecraig/wechat-token-hub/internal/cache"
+	"github.com/waynecraig/wechat-token-hub/internal/quota"
+)
+
+func TestRotateRateLimit(t *testing.T) {
+	server := mockWechatServer(t)
+	envVars := map[string]string{
+		"WECHAT_API_ROOT":          server.URL,
+		"APPSECRET":                "secret1",
+		"ROTATE_CLIENT_PER_MINUTE": "1",
+		"ROTATE_CLIENT_BURST":      "1",
+		"ROTATE_GLOBAL_PER_MINUTE": "1",
+		"ROTATE_GLOBAL_BURST":      "2",
+	}
+	for k, v := range envVars {
+		os.Setenv(k, v)
+	}
+	defer func() {
+		for k := range envVars {
+			os.Unsetenv(k)
+		}
+	}()
+	quota.Reset(quotaKey(AccessTokenProvider("")))
+	cache.DeleteCacheItem("access_token")
+	defer cache.DeleteCacheItem("access_token")
+
+	clientA := auth.NewContext(context.Background(), &auth.Principal{Subject: "service-a", KeyID: "key-a"})
+	clientB := auth.NewContext(context.Background(), &auth.Principal{Subject: "service-b", KeyID: "key-b"})
+	p := AccessTokenProvider("")
+
+	if _, err := GetContext(clientA, p, ""); err != nil {
+		t.Fatalf("GetContext() error = %v", err)
+	}
+
+	// the token was just fetched, the rotation is refused
+	_, err := GetContext(clientA, p, "token1")
+	var rateLimitErr *RateLimitError
+	if !errors.As(err, &rateLimitErr) || rateLimitErr.RetryAfter <= 0 {
+		t.Fatalf("GetContext() error = %v, want RateLimitError with retry after", err)
+	}
+
+	// without the minimum interval, one rotation per client is allowed
+	os.Setenv("ROTATE_MIN_INTERVAL", "0s")
+	defer os.Unsetenv("ROTATE_MIN_INTERVAL")
+	if _, err := GetContext(clientA, p, "token1"); err != nil {
+		t.Errorf("GetContext() error = %v", err)
+	}
+	if _, err := GetContext(clientA, p, "token1"); !errors.As(err, &rateLimitErr) {
+		t.Errorf("GetContext() error = %v, want RateLimitError of the client", err)
+	}
+	// another subject signed with the same key is the same client
+	renamed := auth.NewContext(context.Background(), &auth.Principal{Subject: "service-a-2", KeyID: "key-a"})
+	if _, err := GetContext(renamed, p, "token1"); !errors.As(err, &rateLimitErr) {
+		t.Errorf("GetContext() error = %v, want RateLimitError of the key", err)
+	}
+
+	// another client has its own limit, until the global limit is reached
+	if _, err := GetContext(clientB, p, "token1"); err != nil {
+		t.Errorf("GetContext() error = %v", err)
+	}
+	if _, err := GetContext(clientB, p, "token1"); !errors.As(err, &rateLimitErr) {
+		t.Errorf("GetContext() error = %v, want RateLimitError", err)
+	}
+
+	// the hub itself is not limited
+	if _, err := Get(p, "token1"); err != nil {
+		t.Errorf("Get() error = %v", err)
+	}
+}
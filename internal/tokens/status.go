@@ -0,0 +1,164 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/audit"
+	"github.com/waynecraig/wechat-token-hub/internal/cache"
+	"github.com/waynecraig/wechat-token-hub/internal/fingerprint"
+	"github.com/waynecraig/wechat-token-hub/internal/redact"
+)
+
+// ErrUnknownCredential is returned when the hub has never fetched the credential
+var ErrUnknownCredential = errors.New("unknown credential")
+
+// Status is the state of a credential fetched by the hub
+type Status struct {
+	Key string `json:"key"`
+	// the upstream which issued the credential: wechat, component, authorizer or wecom
+	Source string `json:"source"`
+	// the fingerprint of the cached credential, empty if it's not cached or expired
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// the time the cached credential was fetched and the time it expires,
+	// zero if it's not cached or expired
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// the time of the last successful refresh
+	LastRefresh time.Time `json:"last_refresh"`
+	// the time and the error of the last failed refresh, if it failed after
+	// the last successful one
+	LastFailure time.Time `json:"last_failure"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// Healthy reports whether the credential can be served. A credential is
+// unhealthy if its last refresh failed and there's no valid cached one, such
+// as an account with a wrong secret. The unknown accounts asked by the
+// clients are refused before any fetch, so they have no status.
+func (s Status) Healthy() bool {
+	return s.LastError == "" || !s.ExpiresAt.IsZero()
+}
+
+type status struct {
+	Status
+	provider Provider
+}
+
+var (
+	statusMu sync.Mutex
+	statuses = make(map[string]*status)
+)
+
+// Statuses returns the state of every credential fetched since the start,
+// sorted by key. The credentials of the accounts removed from the config are
+// left out, so that they don't keep the hub unready.
+func Statuses() []Status {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	expirations := cache.Expirations()
+	result := make([]Status, 0, len(statuses))
+	for key, s := range statuses {
+		if c, ok := s.provider.(checker); ok && c.check() != nil {
+			continue
+		}
+		st := s.Status
+		if expiration, ok := expirations[key]; ok {
+			st.Fingerprint = fingerprint.Of(cache.GetCacheItem(key))
+			st.CreatedAt = cache.GetCacheItemCreation(key)
+			st.ExpiresAt = expiration
+		}
+		result = append(result, st)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+// RefreshCredential fetches a new credential for the cache key, whether the
+// cached one is expired or not
+func RefreshCredential(ctx context.Context, key string) error {
+	p := providerOf(key)
+	if p == nil {
+		return ErrUnknownCredential
+	}
+
+	unlock := lock(key)
+	defer unlock()
+
+	_, err := refresh(ctx, p)
+	return err
+}
+
+// EvictCredential removes the credential from the cache, it's fetched again
+// on the next request
+func EvictCredential(ctx context.Context, key string) error {
+	if providerOf(key) == nil {
+		return ErrUnknownCredential
+	}
+
+	unlock := lock(key)
+	defer unlock()
+
+	old := cache.GetCacheItem(key)
+	cache.DeleteCacheItem(key)
+	auditRotate(ctx, audit.EventEvict, key, old, "", nil)
+	return nil
+}
+
+// return the provider of the credential key, or nil if it was never fetched
+func providerOf(key string) Provider {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	if s, ok := statuses[key]; ok {
+		return s.provider
+	}
+	return nil
+}
+
+// record the outcome of a refresh of the credential of the provider
+func recordStatus(p Provider, err error) {
+	// the credentials which are not cached have no status to serve
+	if !cacheable(p) {
+		return
+	}
+	key := p.Key()
+
+	statusMu.Lock()
+	defer statusMu.Unlock()
+
+	s, ok := statuses[key]
+	if !ok {
+		s = &status{Status: Status{Key: key, Source: sourceOf(p)}, provider: p}
+		statuses[key] = s
+	}
+	if err != nil {
+		s.LastFailure = time.Now()
+		s.LastError = redact.String(err.Error())
+	} else {
+		s.LastRefresh = time.Now()
+		s.LastFailure = time.Time{}
+		s.LastError = ""
+	}
+}
+
+// the upstream which issues the credentials of the provider
+func sourceOf(p Provider) string {
+	switch p.(type) {
+	case accessTokenProvider, ticketProvider:
+		return "wechat"
+	case componentAccessTokenProvider:
+		return "component"
+	case authorizerAccessTokenProvider:
+		return "authorizer"
+	case wecomAccessTokenProvider, wecomTicketProvider:
+		return "wecom"
+	}
+	return "other"
+}
@@ -0,0 +1,127 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/waynecraig/wechat-token-hub/internal/audit"
+	"github.com/waynecraig/wechat-token-hub/internal/cache"
+	"github.com/waynecraig/wechat-token-hub/internal/fingerprint"
+	"github.com/waynecraig/wechat-token-hub/internal/quota"
+)
+
+// find the status of key
+func findStatus(key string) (Status, bool) {
+	for _, s := range Statuses() {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return Status{}, false
+}
+
+func TestStatuses(t *testing.T) {
+	p := &fakeProvider{key: "fake_status"}
+	if _, err := Refresh(p); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	s, ok := findStatus("fake_status")
+	if !ok || s.LastRefresh.IsZero() || s.ExpiresAt.IsZero() || s.LastError != "" || !s.Healthy() {
+		t.Fatalf("Unexpected status after a refresh: %+v", s)
+	}
+
+	// a failed refresh is healthy while the cached credential is valid
+	recordStatus(p, &APIError{Name: "fake", ErrCode: -1, ErrMsg: "system error"})
+	s, _ = findStatus("fake_status")
+	if s.LastError == "" || s.LastFailure.IsZero() || !s.Healthy() {
+		t.Errorf("Unexpected status after a failure: %+v", s)
+	}
+
+	// and unhealthy once it has expired
+	cache.DeleteCacheItem("fake_status")
+	s, _ = findStatus("fake_status")
+	if s.Healthy() {
+		t.Errorf("Expected the expired credential to be unhealthy: %+v", s)
+	}
+
+	// a successful refresh clears the error
+	Refresh(p)
+	s, _ = findStatus("fake_status")
+	if s.LastError != "" || !s.LastFailure.IsZero() || !s.Healthy() {
+		t.Errorf("Unexpected status after a new refresh: %+v", s)
+	}
+
+	// the credentials which never worked are unhealthy
+	recordStatus(&fakeProvider{key: "fake_status_never"}, &APIError{Name: "fake", ErrCode: 40125, ErrMsg: "invalid appsecret"})
+	if s, _ := findStatus("fake_status_never"); s.Healthy() {
+		t.Errorf("Expected the credential which never worked to be unhealthy: %+v", s)
+	}
+
+	// the accounts removed from the config are left out
+	t.Setenv("APPSECRET_wxremoved", "removed_app_secret")
+	recordStatus(AccessTokenProvider("wxremoved"), &APIError{Name: "fake", ErrCode: 40125, ErrMsg: "invalid appsecret"})
+	if _, ok := findStatus("access_token_wxremoved"); !ok {
+		t.Errorf("Expected the status of the configured account")
+	}
+	os.Unsetenv("APPSECRET_wxremoved")
+	if s, ok := findStatus("access_token_wxremoved"); ok {
+		t.Errorf("Expected no status of the removed account: %+v", s)
+	}
+}
+
+func TestRefreshAndEvictCredential(t *testing.T) {
+	ctx := context.Background()
+	if err := RefreshCredential(ctx, "fake_never_fetched"); !errors.Is(err, ErrUnknownCredential) {
+		t.Errorf("RefreshCredential() error = %v, want ErrUnknownCredential", err)
+	}
+	if err := EvictCredential(ctx, "fake_never_fetched"); !errors.Is(err, ErrUnknownCredential) {
+		t.Errorf("EvictCredential() error = %v, want ErrUnknownCredential", err)
+	}
+
+	p := &fakeProvider{key: "fake_admin"}
+	Get(p, "")
+	defer quota.Reset("fake_admin")
+
+	// the credential is refreshed with its provider
+	if err := RefreshCredential(ctx, "fake_admin"); err != nil {
+		t.Fatalf("RefreshCredential() error = %v", err)
+	}
+	s, _ := findStatus("fake_admin")
+	if s.Source != "other" || s.Fingerprint != fingerprint.Of("fake_admin2") || s.CreatedAt.IsZero() {
+		t.Errorf("Unexpected status after a refresh: %+v", s)
+	}
+
+	// the evicted credential is fetched on the next request
+	if err := EvictCredential(ctx, "fake_admin"); err != nil {
+		t.Fatalf("EvictCredential() error = %v", err)
+	}
+	if s, _ := findStatus("fake_admin"); s.Fingerprint != "" || !s.ExpiresAt.IsZero() {
+		t.Errorf("Unexpected status after an eviction: %+v", s)
+	}
+	if events := audit.Recent(audit.Filter{Key: "fake_admin", Type: audit.EventEvict}); len(events) != 1 || events[0].OldFingerprint != fingerprint.Of("fake_admin2") {
+		t.Errorf("Unexpected evict events: %+v", events)
+	}
+	if value, _ := Get(p, ""); value != "fake_admin3" {
+		t.Errorf("Get() = %s, want fake_admin3", value)
+	}
+}
+
+func TestSourceOf(t *testing.T) {
+	testCases := []struct {
+		provider Provider
+		expected string
+	}{
+		{AccessTokenProvider("wx1"), "wechat"},
+		{TicketProvider("", "jsapi"), "wechat"},
+		{ComponentAccessTokenProvider(), "component"},
+		{AuthorizerAccessTokenProvider("wx1"), "authorizer"},
+		{WecomTicketProvider("1000001", "jsapi"), "wecom"},
+	}
+	for _, tc := range testCases {
+		if source := sourceOf(tc.provider); source != tc.expected {
+			t.Errorf("sourceOf(%s) = %s, want %s", tc.provider.Key(), source, tc.expected)
+		}
+	}
+}
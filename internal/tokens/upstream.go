@@ -0,0 +1,59 @@
+package tokens
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/redact"
+)
+
+// UpstreamClient calls the WeChat and WeCom APIs, with a timeout so that a
+// hung connection doesn't hold the requests waiting for it
+var UpstreamClient = &http.Client{Timeout: 10 * time.Second}
+
+// the number of upstream errors kept in memory
+const upstreamErrorsSize = 100
+
+// UpstreamError is a failed request to the upstream API
+type UpstreamError struct {
+	Time time.Time `json:"time"`
+	// the path of the API, without the root and the query
+	Endpoint string `json:"endpoint"`
+	// the errcode and errmsg returned by the API, or the error of the request
+	ErrCode int    `json:"errcode,omitempty"`
+	ErrMsg  string `json:"errmsg,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+var (
+	upstreamErrorsMu sync.Mutex
+	upstreamErrors   []UpstreamError
+)
+
+// UpstreamErrors returns the recent failed requests to the upstream API, the newest first
+func UpstreamErrors() []UpstreamError {
+	upstreamErrorsMu.Lock()
+	defer upstreamErrorsMu.Unlock()
+
+	result := make([]UpstreamError, 0, len(upstreamErrors))
+	for i := len(upstreamErrors) - 1; i >= 0; i-- {
+		result = append(result, upstreamErrors[i])
+	}
+	return result
+}
+
+// keep the failed request, the oldest one is dropped when there are too many
+func recordUpstreamError(e UpstreamError) {
+	e.Time = time.Now()
+	e.ErrMsg = redact.String(e.ErrMsg)
+	e.Error = redact.String(e.Error)
+
+	upstreamErrorsMu.Lock()
+	defer upstreamErrorsMu.Unlock()
+
+	if len(upstreamErrors) >= upstreamErrorsSize {
+		upstreamErrors = upstreamErrors[1:]
+	}
+	upstreamErrors = append(upstreamErrors, e)
+}
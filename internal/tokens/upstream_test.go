@@ -0,0 +1,39 @@
+package tokens
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestUpstreamErrors(t *testing.T) {
+	server := mockWechatServer(t)
+	os.Setenv("WECHAT_API_ROOT", server.URL)
+	defer os.Unsetenv("WECHAT_API_ROOT")
+
+	// wechat rejects the wrong secret
+	os.Setenv("APPSECRET_wxupstream", "wrong_app_secret")
+	defer os.Unsetenv("APPSECRET_wxupstream")
+	Get(AccessTokenProvider("wxupstream"), "")
+
+	errs := UpstreamErrors()
+	if len(errs) == 0 || errs[0].Endpoint != "/cgi-bin/token" || errs[0].ErrCode == 0 || errs[0].Time.IsZero() {
+		t.Fatalf("Unexpected upstream errors: %+v", errs)
+	}
+
+	// the failed requests keep no secret
+	os.Setenv("WECHAT_API_ROOT", "http://127.0.0.1:1")
+	Get(AccessTokenProvider("wxupstream"), "")
+	errs = UpstreamErrors()
+	if errs[0].Error == "" || strings.Contains(errs[0].Error, "wrong_app_secret") {
+		t.Errorf("Unexpected upstream error: %+v", errs[0])
+	}
+
+	// the history is bounded
+	for i := 0; i < upstreamErrorsSize; i++ {
+		recordUpstreamError(UpstreamError{Endpoint: "/cgi-bin/token", ErrCode: -1})
+	}
+	if n := len(UpstreamErrors()); n != upstreamErrorsSize {
+		t.Errorf("Expected %d upstream errors, got %d", upstreamErrorsSize, n)
+	}
+}
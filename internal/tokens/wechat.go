@@ -1,131 +1,146 @@
 package tokens
 
 import (
-	"encoding/json"
 	"fmt"
-	"net/http"
 	"os"
-	"strings"
-
-	"github.com/waynecraig/wechat-token-hub/internal/cache"
 )
 
+// GetAccessToken returns the access token of the default account set in APPID
 func GetAccessToken(rotateToken string) (string, error) {
-	// check if the access token is in the cache
-	accessToken := cache.GetCacheItem("access_token")
-	if accessToken != "" {
-		// check if the rotate token is the same as the cached access token
-		if rotateToken != "" && rotateToken == accessToken {
-			// if the rotate token is the same as the cached access token, request a new one
-			accessToken = ""
-		} else {
-			// if the access token is in the cache and not expired, return it
-			return accessToken, nil
-		}
-	}
-
-	// if the access token is not in the cache or needs to be refreshed, make a request to get it
-	accessToken, err := retrieveAccessToken()
-	if err != nil {
-		return "", err
-	}
-	return accessToken, nil
+	return Get(AccessTokenProvider(""), rotateToken)
 }
 
+// GetTicket returns the ticket of the default account set in APPID
 func GetTicket(ticketType string, rotateTicket string) (string, error) {
-	// check if the ticket is in the cache
-	ticket := cache.GetCacheItem("ticket_" + ticketType)
-	if ticket != "" {
-		// check if the rotate ticket is the same as the cached ticket
-		if rotateTicket != "" && rotateTicket == ticket {
-			// if the rotate ticket is the same as the cached ticket, request a new one
-			ticket = ""
-		} else {
-			// if the ticket is in the cache and not expired, return it
-			return ticket, nil
-		}
-	}
+	return Get(TicketProvider("", ticketType), rotateTicket)
+}
 
-	// if the ticket is not in the cache or needs to be refreshed, make a request to get it
-	accessToken, err := GetAccessToken("")
-	if err != nil {
-		return "", err
+// AccessTokenProvider returns the provider of the access token of an official
+// account or mini-program. An empty appid means the default account set in
+// APPID, whose secret is APPSECRET, others use the APPSECRET_{appid} env.
+func AccessTokenProvider(appid string) Provider {
+	if appid == os.Getenv("APPID") {
+		appid = ""
 	}
-	ticket, err = retrieveTicket(accessToken, ticketType)
-
-	// if get the 40001 error code, means the access token is expired, rotate it.
-	if err != nil && strings.Contains(err.Error(), "40001") {
-		accessToken, err = GetAccessToken(accessToken)
-		if err != nil {
-			return "", err
-		}
-		ticket, err = retrieveTicket(accessToken, ticketType)
+	return accessTokenProvider{appid: appid}
+}
+
+// TicketProvider returns the provider of the jsapi or wx_card ticket of an
+// official account
+func TicketProvider(appid string, ticketType string) Provider {
+	if appid == os.Getenv("APPID") {
+		appid = ""
 	}
+	return ticketProvider{appid: appid, ticketType: ticketType}
+}
 
-	if err != nil {
-		return "", err
+type accessTokenProvider struct {
+	appid string
+}
+
+func (p accessTokenProvider) Key() string {
+	if p.appid == "" {
+		return "access_token"
 	}
-	return ticket, nil
+	return "access_token_" + p.appid
+}
+
+func (p accessTokenProvider) Dependency() Provider {
+	return nil
 }
 
 // request the wechat API to get a new access token
-func retrieveAccessToken() (string, error) {
-	url := fmt.Sprintf("%s/cgi-bin/token?grant_type=client_credential&appid=%s&secret=%s", os.Getenv("WECHAT_API_ROOT"), os.Getenv("APPID"), os.Getenv("APPSECRET"))
-	resp, err := http.Get(url)
+func (p accessTokenProvider) Fetch(string) (*Credential, error) {
+	appid, secret, err := p.secret()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	// decode the response body
+	url := fmt.Sprintf("%s/cgi-bin/token?grant_type=client_credential&appid=%s&secret=%s", os.Getenv("WECHAT_API_ROOT"), appid, secret)
 	var result struct {
+		apiResult
 		AccessToken string `json:"access_token"`
 		ExpiresIn   int    `json:"expires_in"`
-		ErrCode     int    `json:"errcode"`
-		ErrMsg      string `json:"errmsg"`
 	}
-	err = json.NewDecoder(resp.Body).Decode(&result)
-	if err != nil {
-		return "", err
+	if err := getJSON(url, &result); err != nil {
+		return nil, err
 	}
 
 	if result.AccessToken == "" {
-		return "", fmt.Errorf("fetch access token fail, code: %d, message: %s", result.ErrCode, result.ErrMsg)
+		return nil, &APIError{Name: "access token", ErrCode: result.ErrCode, ErrMsg: result.ErrMsg}
 	}
 
-	// save the access token to the cache
-	cache.SaveCacheItem("access_token", result.AccessToken, result.ExpiresIn)
+	return &Credential{Value: result.AccessToken, ExpiresIn: result.ExpiresIn}, nil
+}
 
-	return result.AccessToken, nil
+func (p accessTokenProvider) Classify(err error) ErrorClass {
+	return ErrorFatal
 }
 
-// request the wechat API to get a new ticket
-func retrieveTicket(accessToken string, ticketType string) (string, error) {
-	url := fmt.Sprintf("%s/cgi-bin/ticket/getticket?access_token=%s&type=%s", os.Getenv("WECHAT_API_ROOT"), accessToken, ticketType)
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", err
+// the other accounts than APPID must have their secret set
+func (p accessTokenProvider) check() error {
+	if p.appid != "" && os.Getenv("APPSECRET_"+p.appid) == "" {
+		return fmt.Errorf("%w: APPSECRET_%s environment variable not set", ErrNotConfigured, p.appid)
+	}
+	return nil
+}
+
+// the appid and secret of the account, the error wraps ErrNotConfigured if
+// the account is unknown
+func (p accessTokenProvider) secret() (string, string, error) {
+	if p.appid == "" {
+		return os.Getenv("APPID"), os.Getenv("APPSECRET"), nil
+	}
+	if err := p.check(); err != nil {
+		return "", "", err
 	}
-	defer resp.Body.Close()
+	return p.appid, os.Getenv("APPSECRET_" + p.appid), nil
+}
+
+type ticketProvider struct {
+	appid      string
+	ticketType string
+}
 
-	// decode the response body
+func (p ticketProvider) Key() string {
+	if p.appid == "" {
+		return "ticket_" + p.ticketType
+	}
+	return "ticket_" + p.appid + "_" + p.ticketType
+}
+
+func (p ticketProvider) Dependency() Provider {
+	return accessTokenProvider{appid: p.appid}
+}
+
+// only the jsapi and wx_card tickets of a configured account are supported
+func (p ticketProvider) check() error {
+	if p.ticketType != "jsapi" && p.ticketType != "wx_card" {
+		return fmt.Errorf("%w: unsupported ticket type %s", ErrNotConfigured, p.ticketType)
+	}
+	return accessTokenProvider{appid: p.appid}.check()
+}
+
+// request the wechat API to get a new ticket
+func (p ticketProvider) Fetch(accessToken string) (*Credential, error) {
+	url := fmt.Sprintf("%s/cgi-bin/ticket/getticket?access_token=%s&type=%s", os.Getenv("WECHAT_API_ROOT"), accessToken, p.ticketType)
 	var result struct {
+		apiResult
 		Ticket    string `json:"ticket"`
 		ExpiresIn int    `json:"expires_in"`
-		ErrCode   int    `json:"errcode"`
-		ErrMsg    string `json:"errmsg"`
 	}
-	err = json.NewDecoder(resp.Body).Decode(&result)
-	if err != nil {
-		return "", err
+	if err := getJSON(url, &result); err != nil {
+		return nil, err
 	}
 
 	if result.Ticket == "" {
-		return "", fmt.Errorf("fetch ticket fail, code: %d, message: %s", result.ErrCode, result.ErrMsg)
+		return nil, &APIError{Name: "ticket", ErrCode: result.ErrCode, ErrMsg: result.ErrMsg}
 	}
 
-	// save the ticket to the cache
-	cache.SaveCacheItem("ticket_"+ticketType, result.Ticket, result.ExpiresIn)
+	return &Credential{Value: result.Ticket, ExpiresIn: result.ExpiresIn}, nil
+}
 
-	return result.Ticket, nil
+// if get the 40001 error code, means the access token is expired, rotate it.
+func (p ticketProvider) Classify(err error) ErrorClass {
+	return classifyInvalidToken(err)
 }
@@ -38,6 +38,15 @@ func mockWechatServer(t *testing.T) *httptest.Server {
 					w.Write([]byte(`{"errcode":40001,"errmsg":"invalid access token"}`))
 				}
 			}
+			// check if the request path is one of the quota APIs
+		} else if r.URL.Path == "/cgi-bin/openapi/quota/get" || r.URL.Path == "/cgi-bin/clear_quota" {
+			if r.URL.Query().Get("access_token") != "token1" {
+				w.Write([]byte(`{"errcode":40001,"errmsg":"invalid access token"}`))
+			} else if r.URL.Path == "/cgi-bin/clear_quota" {
+				w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+			} else {
+				w.Write([]byte(`{"errcode":0,"errmsg":"ok","quota":{"daily_limit":2000,"used":5,"remain":1995}}`))
+			}
 		} else {
 			// if the request path is not "/cgi-bin/access-token" or "/cgi-bin/ticket", return 404
 			w.WriteHeader(http.StatusNotFound)
@@ -220,3 +229,38 @@ func TestGetTicket(t *testing.T) {
 
 	os.Unsetenv("WECHAT_API_ROOT")
 }
+
+func TestAccessTokenProvider(t *testing.T) {
+	server := mockWechatServer(t)
+	os.Setenv("WECHAT_API_ROOT", server.URL)
+	os.Setenv("APPID", "app1")
+	os.Setenv("APPSECRET_wxmini", "secret1")
+	defer os.Unsetenv("WECHAT_API_ROOT")
+	defer os.Unsetenv("APPID")
+	defer os.Unsetenv("APPSECRET_wxmini")
+
+	// the default account shares the cache key with GetAccessToken
+	if key := AccessTokenProvider("app1").Key(); key != "access_token" {
+		t.Errorf("Expect key = access_token, got %s", key)
+	}
+	if key := TicketProvider("", "jsapi").Key(); key != "ticket_jsapi" {
+		t.Errorf("Expect key = ticket_jsapi, got %s", key)
+	}
+
+	// other accounts use their own secret and cache key
+	token, err := Get(AccessTokenProvider("wxmini"), "")
+	if err != nil {
+		t.Errorf("Get() error = %v", err)
+	}
+	if token != "token1" {
+		t.Errorf("Expect accessToken = token1, got %s", token)
+	}
+	if key := AccessTokenProvider("wxmini").Key(); key != "access_token_wxmini" {
+		t.Errorf("Expect key = access_token_wxmini, got %s", key)
+	}
+
+	// accounts without secret are rejected
+	if _, err := Get(AccessTokenProvider("wxother"), ""); err == nil {
+		t.Errorf("Get() should fail without APPSECRET_wxother")
+	}
+}
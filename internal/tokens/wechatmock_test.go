@@ -0,0 +1,44 @@
+package tokens
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/waynecraig/wechat-token-hub/internal/cache"
+	"github.com/waynecraig/wechat-token-hub/internal/quota"
+	"github.com/waynecraig/wechat-token-hub/pkg/wechatmock"
+)
+
+func TestWithWechatMock(t *testing.T) {
+	mock := wechatmock.New()
+	mock.AddAccount("wxmock", "mock_app_secret")
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	os.Setenv("WECHAT_API_ROOT", server.URL)
+	os.Setenv("APPSECRET_wxmock", "mock_app_secret")
+	defer os.Unsetenv("WECHAT_API_ROOT")
+	defer os.Unsetenv("APPSECRET_wxmock")
+	defer cache.DeleteCacheItem("access_token_wxmock")
+	defer cache.DeleteCacheItem("ticket_wxmock_jsapi")
+	defer quota.Reset("wxmock:/cgi-bin/token", "wxmock:/cgi-bin/ticket/getticket")
+
+	accessToken, err := Get(AccessTokenProvider("wxmock"), "")
+	if err != nil || !mock.Valid(accessToken) {
+		t.Fatalf("Get() = %s, %v, want a valid token", accessToken, err)
+	}
+
+	// another client fetched a token behind the hub, invalidating the cached one
+	cache.SaveCacheItem("access_token_wxmock", "stale", 7200)
+	ticket, err := Get(TicketProvider("wxmock", "jsapi"), "")
+	if err != nil || ticket == "" {
+		t.Fatalf("Get() = %s, %v, want a ticket after rotating the token", ticket, err)
+	}
+	if current := cache.GetCacheItem("access_token_wxmock"); current == "stale" || !mock.Valid(current) {
+		t.Errorf("Expected the stale token to be rotated, got %s", current)
+	}
+	if n := mock.Calls("/cgi-bin/token"); n != 2 {
+		t.Errorf("Expected 2 calls to cgi-bin/token, got %d", n)
+	}
+}
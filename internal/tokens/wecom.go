@@ -0,0 +1,125 @@
+package tokens
+
+import (
+	"fmt"
+	"os"
+)
+
+// GetWecomAccessToken returns the access token of a WeCom agent, each agent
+// has its own secret set in the WECOM_SECRET_{agent} env
+func GetWecomAccessToken(agent string, rotateToken string) (string, error) {
+	return Get(WecomAccessTokenProvider(agent), rotateToken)
+}
+
+// GetWecomTicket returns the jsapi ticket of a WeCom agent, ticketType is
+// "jsapi" for the enterprise ticket or "agent_config" for the agent ticket
+func GetWecomTicket(agent string, ticketType string, rotateTicket string) (string, error) {
+	return Get(WecomTicketProvider(agent, ticketType), rotateTicket)
+}
+
+// WecomAccessTokenProvider returns the provider of the access token of a WeCom agent
+func WecomAccessTokenProvider(agent string) Provider {
+	return wecomAccessTokenProvider{agent: agent}
+}
+
+// WecomTicketProvider returns the provider of the jsapi ticket of a WeCom agent
+func WecomTicketProvider(agent string, ticketType string) Provider {
+	return wecomTicketProvider{agent: agent, ticketType: ticketType}
+}
+
+type wecomAccessTokenProvider struct {
+	agent string
+}
+
+func (p wecomAccessTokenProvider) Key() string {
+	return "wecom_access_token_" + p.agent
+}
+
+func (p wecomAccessTokenProvider) Dependency() Provider {
+	return nil
+}
+
+// the agent must have its secret set
+func (p wecomAccessTokenProvider) check() error {
+	if p.agent == "" || os.Getenv("WECOM_SECRET_"+p.agent) == "" {
+		return fmt.Errorf("%w: WECOM_SECRET_%s environment variable not set", ErrNotConfigured, p.agent)
+	}
+	return nil
+}
+
+// request the wecom API to get a new access token of the agent
+func (p wecomAccessTokenProvider) Fetch(string) (*Credential, error) {
+	secret := os.Getenv("WECOM_SECRET_" + p.agent)
+	if p.agent == "" || secret == "" {
+		return nil, fmt.Errorf("WECOM_SECRET_%s environment variable not set", p.agent)
+	}
+
+	url := fmt.Sprintf("%s/cgi-bin/gettoken?corpid=%s&corpsecret=%s", os.Getenv("WECOM_API_ROOT"), os.Getenv("WECOM_CORPID"), secret)
+	var result struct {
+		apiResult
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := getJSON(url, &result); err != nil {
+		return nil, err
+	}
+
+	if result.AccessToken == "" {
+		return nil, &APIError{Name: "wecom access token", ErrCode: result.ErrCode, ErrMsg: result.ErrMsg}
+	}
+
+	return &Credential{Value: result.AccessToken, ExpiresIn: result.ExpiresIn}, nil
+}
+
+func (p wecomAccessTokenProvider) Classify(err error) ErrorClass {
+	return ErrorFatal
+}
+
+type wecomTicketProvider struct {
+	agent      string
+	ticketType string
+}
+
+func (p wecomTicketProvider) Key() string {
+	return "wecom_ticket_" + p.agent + "_" + p.ticketType
+}
+
+func (p wecomTicketProvider) Dependency() Provider {
+	return wecomAccessTokenProvider{agent: p.agent}
+}
+
+// only the enterprise ticket and the agent ticket of a configured agent are supported
+func (p wecomTicketProvider) check() error {
+	if p.ticketType != "jsapi" && p.ticketType != "agent_config" {
+		return fmt.Errorf("%w: unsupported wecom ticket type %s", ErrNotConfigured, p.ticketType)
+	}
+	return wecomAccessTokenProvider{agent: p.agent}.check()
+}
+
+// request the wecom API to get a new ticket of the agent
+func (p wecomTicketProvider) Fetch(accessToken string) (*Credential, error) {
+	// the enterprise ticket and the agent ticket have different paths
+	url := fmt.Sprintf("%s/cgi-bin/get_jsapi_ticket?access_token=%s", os.Getenv("WECOM_API_ROOT"), accessToken)
+	if p.ticketType == "agent_config" {
+		url = fmt.Sprintf("%s/cgi-bin/ticket/get?access_token=%s&type=agent_config", os.Getenv("WECOM_API_ROOT"), accessToken)
+	}
+	var result struct {
+		apiResult
+		Ticket    string `json:"ticket"`
+		ExpiresIn int    `json:"expires_in"`
+	}
+	if err := getJSON(url, &result); err != nil {
+		return nil, err
+	}
+
+	if result.Ticket == "" {
+		return nil, &APIError{Name: "wecom ticket", ErrCode: result.ErrCode, ErrMsg: result.ErrMsg}
+	}
+
+	return &Credential{Value: result.Ticket, ExpiresIn: result.ExpiresIn}, nil
+}
+
+// wecom returns 40014 or 42001 for an invalid or expired access token
+func (p wecomTicketProvider) Classify(err error) ErrorClass {
+	return classifyInvalidToken(err)
+}
@@ -0,0 +1,122 @@
+package tokens
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func mockWecomServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch r.URL.Path {
+		case "/cgi-bin/gettoken":
+			// each agent secret gets its own token
+			if query.Get("corpid") == "corp1" && query.Get("corpsecret") == "agentsecret1" {
+				w.Write([]byte(`{"errcode":0,"errmsg":"ok","access_token":"wtoken1","expires_in":7200}`))
+			} else {
+				w.Write([]byte(`{"errcode":40001,"errmsg":"invalid secret"}`))
+			}
+		case "/cgi-bin/get_jsapi_ticket":
+			if query.Get("access_token") == "wtoken1" {
+				w.Write([]byte(`{"errcode":0,"errmsg":"ok","ticket":"corpticket1","expires_in":7200}`))
+			} else {
+				w.Write([]byte(`{"errcode":40014,"errmsg":"invalid access_token"}`))
+			}
+		case "/cgi-bin/ticket/get":
+			if query.Get("access_token") == "wtoken1" && query.Get("type") == "agent_config" {
+				w.Write([]byte(`{"errcode":0,"errmsg":"ok","ticket":"agentticket1","expires_in":7200}`))
+			} else {
+				w.Write([]byte(`{"errcode":40014,"errmsg":"invalid access_token"}`))
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("404 not found"))
+		}
+	}))
+	t.Cleanup(func() {
+		server.Close()
+	})
+
+	return server
+}
+
+func TestGetWecomAccessToken(t *testing.T) {
+	server := mockWecomServer(t)
+	os.Setenv("WECOM_API_ROOT", server.URL)
+	os.Setenv("WECOM_CORPID", "corp1")
+	os.Setenv("WECOM_SECRET_1000001", "agentsecret1")
+	os.Setenv("WECOM_SECRET_1000002", "agentsecret2")
+	defer os.Unsetenv("WECOM_API_ROOT")
+	defer os.Unsetenv("WECOM_CORPID")
+	defer os.Unsetenv("WECOM_SECRET_1000001")
+	defer os.Unsetenv("WECOM_SECRET_1000002")
+
+	tests := []struct {
+		name        string
+		agent       string
+		rotateToken string
+		accessToken string
+		wantErr     bool
+	}{
+		{name: "agent not configured", agent: "1000003", wantErr: true},
+		{name: "secret error", agent: "1000002", wantErr: true},
+		{name: "normal", agent: "1000001", accessToken: "wtoken1"},
+		{name: "from cache", agent: "1000001", accessToken: "wtoken1"},
+		{name: "rotate token", agent: "1000001", rotateToken: "wtoken1", accessToken: "wtoken1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := GetWecomAccessToken(tt.agent, tt.rotateToken)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetWecomAccessToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if token != tt.accessToken {
+				t.Errorf("Expect accessToken = %s, got %s", tt.accessToken, token)
+			}
+		})
+	}
+}
+
+func TestGetWecomTicket(t *testing.T) {
+	server := mockWecomServer(t)
+	os.Setenv("WECOM_API_ROOT", server.URL)
+	os.Setenv("WECOM_CORPID", "corp1")
+	os.Setenv("WECOM_SECRET_1000001", "agentsecret1")
+	defer os.Unsetenv("WECOM_API_ROOT")
+	defer os.Unsetenv("WECOM_CORPID")
+	defer os.Unsetenv("WECOM_SECRET_1000001")
+
+	tests := []struct {
+		name         string
+		ticketType   string
+		rotateTicket string
+		ticket       string
+		wantErr      bool
+	}{
+		{name: "type error", ticketType: "wx_card", wantErr: true},
+		{name: "enterprise ticket", ticketType: "jsapi", ticket: "corpticket1"},
+		{name: "agent ticket", ticketType: "agent_config", ticket: "agentticket1"},
+		{name: "from cache", ticketType: "agent_config", ticket: "agentticket1"},
+		{name: "rotate ticket", ticketType: "agent_config", rotateTicket: "agentticket1", ticket: "agentticket1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ticket, err := GetWecomTicket("1000001", tt.ticketType, tt.rotateTicket)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetWecomTicket() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			// the type is refused before the access token is fetched
+			if tt.wantErr && !errors.Is(err, ErrNotConfigured) {
+				t.Errorf("GetWecomTicket() error = %v, want ErrNotConfigured", err)
+			}
+			if ticket != tt.ticket {
+				t.Errorf("Expect ticket = %s, got %s", tt.ticket, ticket)
+			}
+		})
+	}
+}
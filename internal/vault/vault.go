@@ -0,0 +1,84 @@
+package vault
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/envelope"
+)
+
+// secrets which must stay inside the hub, such as the session keys of the
+// mini program users. They are kept in memory encrypted with the master key
+// of the envelope encryption, like the values of the store, so that they
+// don't show up in a memory dump in clear. Without a master key the vault
+// refuses them.
+var (
+	mu      sync.Mutex
+	entries = make(map[string]*entry)
+)
+
+type entry struct {
+	value      string
+	expiration time.Time
+}
+
+// ErrNotFound is returned when the secret is not in the vault or has expired
+var ErrNotFound = errors.New("secret not found")
+
+// Check returns envelope.ErrNoKey if there's no master key to encrypt the
+// values, or an error if the master keys can't be loaded
+func Check() error {
+	enabled, err := envelope.Enabled()
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return envelope.ErrNoKey
+	}
+	return nil
+}
+
+// Put encrypts the value and keeps it under name until ttl has passed
+func Put(name string, value string, ttl time.Duration) error {
+	if err := Check(); err != nil {
+		return err
+	}
+	// the name is authenticated, so that a value can't be moved to another name
+	encrypted, err := envelope.Encrypt(name, value)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now()
+	for n, e := range entries {
+		if e.expiration.Before(now) {
+			delete(entries, n)
+		}
+	}
+	entries[name] = &entry{value: encrypted, expiration: now.Add(ttl)}
+	return nil
+}
+
+// Get decrypts the value kept under name
+func Get(name string) (string, error) {
+	mu.Lock()
+	e, ok := entries[name]
+	mu.Unlock()
+
+	if !ok || !e.expiration.After(time.Now()) {
+		return "", ErrNotFound
+	}
+	return envelope.Decrypt(name, e.value)
+}
+
+// Delete removes the value kept under name
+func Delete(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	delete(entries, name)
+}
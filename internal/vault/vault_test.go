@@ -0,0 +1,82 @@
+package vault
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waynecraig/wechat-token-hub/internal/envelope"
+)
+
+func TestPutGet(t *testing.T) {
+	os.Setenv("MASTER_KEY", "v1=MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	defer os.Unsetenv("MASTER_KEY")
+
+	if err := Put("session_key/wx1/openid1", "secret value", time.Minute); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	defer Delete("session_key/wx1/openid1")
+
+	value, err := Get("session_key/wx1/openid1")
+	if err != nil || value != "secret value" {
+		t.Errorf("Get() = %s, %v, want the value", value, err)
+	}
+
+	// the value is not kept in clear
+	mu.Lock()
+	encrypted := entries["session_key/wx1/openid1"].value
+	mu.Unlock()
+	if strings.Contains(encrypted, "secret value") {
+		t.Errorf("Expected the value to be encrypted")
+	}
+
+	// a value moved to another name can't be decrypted
+	mu.Lock()
+	entries["session_key/wx1/openid2"] = &entry{value: encrypted, expiration: time.Now().Add(time.Minute)}
+	mu.Unlock()
+	defer Delete("session_key/wx1/openid2")
+	if _, err := Get("session_key/wx1/openid2"); err == nil {
+		t.Errorf("Get() accepted a value moved to another name")
+	}
+
+	// the values can't be read with another master key
+	os.Setenv("MASTER_KEY", "v1=ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA=")
+	if _, err := Get("session_key/wx1/openid1"); err == nil {
+		t.Errorf("Get() decrypted the value with another key")
+	}
+
+	// unknown, expired and deleted values are not found
+	if _, err := Get("session_key/wx1/unknown"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v, want ErrNotFound", err)
+	}
+	Put("session_key/wx1/expired", "value", -time.Second)
+	if _, err := Get("session_key/wx1/expired"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v, want ErrNotFound for an expired value", err)
+	}
+	Delete("session_key/wx1/openid1")
+	if _, err := Get("session_key/wx1/openid1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v, want ErrNotFound for a deleted value", err)
+	}
+}
+
+func TestWithoutMasterKey(t *testing.T) {
+	// the values are never kept in clear
+	if err := Check(); !errors.Is(err, envelope.ErrNoKey) {
+		t.Errorf("Check() error = %v, want ErrNoKey", err)
+	}
+	if err := Put("key_test", "value", time.Minute); !errors.Is(err, envelope.ErrNoKey) {
+		t.Errorf("Put() error = %v, want ErrNoKey", err)
+	}
+	if _, err := Get("key_test"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v, want ErrNotFound", err)
+	}
+
+	// an invalid master key is refused
+	os.Setenv("MASTER_KEY", "v1=c2hvcnQ=")
+	defer os.Unsetenv("MASTER_KEY")
+	if err := Put("key_test", "value", time.Minute); err == nil {
+		t.Errorf("Put() accepted a short key")
+	}
+}
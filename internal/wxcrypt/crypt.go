@@ -0,0 +1,122 @@
+package wxcrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// the block size used by wechat for pkcs7 padding
+const blockSize = 32
+
+// Signature computes the msg_signature of a pushed message
+func Signature(token, timestamp, nonce, encrypted string) string {
+	parts := []string{token, timestamp, nonce, encrypted}
+	sort.Strings(parts)
+	sum := sha1.Sum([]byte(strings.Join(parts, "")))
+	return fmt.Sprintf("%x", sum)
+}
+
+// VerifySignature checks the msg_signature of a pushed message
+func VerifySignature(token, timestamp, nonce, encrypted, signature string) bool {
+	expected := Signature(token, timestamp, nonce, encrypted)
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) == 1
+}
+
+// Decrypt decrypts a message encrypted with the EncodingAESKey, and checks
+// that it was sent to the given appid
+func Decrypt(encodingAESKey, appid, encrypted string) ([]byte, error) {
+	key, err := decodeKey(encodingAESKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("invalid ciphertext length %d", len(ciphertext))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, key[:aes.BlockSize]).CryptBlocks(plaintext, ciphertext)
+
+	// remove the pkcs7 padding
+	pad := int(plaintext[len(plaintext)-1])
+	if pad < 1 || pad > blockSize || pad > len(plaintext) {
+		return nil, fmt.Errorf("invalid padding")
+	}
+	plaintext = plaintext[:len(plaintext)-pad]
+
+	// the plaintext is random(16) + msg_len(4) + msg + appid
+	if len(plaintext) < 20 {
+		return nil, fmt.Errorf("invalid plaintext length %d", len(plaintext))
+	}
+	msgLen := int(binary.BigEndian.Uint32(plaintext[16:20]))
+	if msgLen > len(plaintext)-20 {
+		return nil, fmt.Errorf("invalid message length %d", msgLen)
+	}
+	msg := plaintext[20 : 20+msgLen]
+	if string(plaintext[20+msgLen:]) != appid {
+		return nil, fmt.Errorf("appid mismatch")
+	}
+
+	return msg, nil
+}
+
+// Encrypt encrypts a message the same way wechat does, it's the reverse of Decrypt
+func Encrypt(encodingAESKey, appid string, msg []byte) (string, error) {
+	key, err := decodeKey(encodingAESKey)
+	if err != nil {
+		return "", err
+	}
+
+	// build random(16) + msg_len(4) + msg + appid
+	var buf bytes.Buffer
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	buf.Write(random)
+	binary.Write(&buf, binary.BigEndian, uint32(len(msg)))
+	buf.Write(msg)
+	buf.WriteString(appid)
+
+	// add the pkcs7 padding
+	pad := blockSize - buf.Len()%blockSize
+	buf.Write(bytes.Repeat([]byte{byte(pad)}, pad))
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	ciphertext := make([]byte, buf.Len())
+	cipher.NewCBCEncrypter(block, key[:aes.BlockSize]).CryptBlocks(ciphertext, buf.Bytes())
+
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// the EncodingAESKey is the base64 of the aes key without the trailing "="
+func decodeKey(encodingAESKey string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encodingAESKey + "=")
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid EncodingAESKey length")
+	}
+	return key, nil
+}
@@ -0,0 +1,88 @@
+package wxcrypt
+
+import (
+	"testing"
+)
+
+const testKey = "abcdefghijklmnopqrstuvwxyz0123456789ABCDEFG"
+
+func TestSignature(t *testing.T) {
+	// the signature should not depend on the order of the parts
+	s1 := Signature("token", "1409659813", "1372623149", "msg")
+	s2 := Signature("msg", "1372623149", "1409659813", "token")
+	if s1 != s2 {
+		t.Errorf("Signature depends on order: %s != %s", s1, s2)
+	}
+
+	if !VerifySignature("token", "1409659813", "1372623149", "msg", s1) {
+		t.Errorf("VerifySignature rejected a valid signature")
+	}
+	if VerifySignature("token", "1409659813", "1372623149", "other", s1) {
+		t.Errorf("VerifySignature accepted an invalid signature")
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	msg := []byte("<xml><InfoType>component_verify_ticket</InfoType></xml>")
+
+	encrypted, err := Encrypt(testKey, "wx123", msg)
+	if err != nil {
+		t.Fatalf("Encrypt error: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		key       string
+		appid     string
+		encrypted string
+		wantErr   bool
+	}{
+		{
+			name:      "valid message",
+			key:       testKey,
+			appid:     "wx123",
+			encrypted: encrypted,
+			wantErr:   false,
+		},
+		{
+			name:      "appid mismatch",
+			key:       testKey,
+			appid:     "wx456",
+			encrypted: encrypted,
+			wantErr:   true,
+		},
+		{
+			name:      "invalid key",
+			key:       "short",
+			appid:     "wx123",
+			encrypted: encrypted,
+			wantErr:   true,
+		},
+		{
+			name:      "invalid base64",
+			key:       testKey,
+			appid:     "wx123",
+			encrypted: "!!!",
+			wantErr:   true,
+		},
+		{
+			name:      "invalid length",
+			key:       testKey,
+			appid:     "wx123",
+			encrypted: "YWJj",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Decrypt(tt.key, tt.appid, tt.encrypted)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Decrypt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(result) != string(msg) {
+				t.Errorf("Decrypt() = %s, want %s", result, msg)
+			}
+		})
+	}
+}
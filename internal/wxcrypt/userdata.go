@@ -0,0 +1,78 @@
+package wxcrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+)
+
+// DecryptUserData decrypts the user data of a mini program, such as the
+// phone number or the profile, with the session key of the user. Unlike the
+// pushed messages, it's AES-128-CBC with the iv given by the mini program.
+func DecryptUserData(sessionKey, encryptedData, iv string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(sessionKey)
+	if err != nil || len(key) != 16 {
+		return nil, fmt.Errorf("invalid session key")
+	}
+	ivBytes, err := base64.StdEncoding.DecodeString(iv)
+	if err != nil || len(ivBytes) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid iv")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(encryptedData)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("invalid ciphertext length %d", len(ciphertext))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, ivBytes).CryptBlocks(plaintext, ciphertext)
+
+	// remove the pkcs7 padding
+	pad := int(plaintext[len(plaintext)-1])
+	if pad < 1 || pad > aes.BlockSize || pad > len(plaintext) {
+		return nil, fmt.Errorf("invalid padding")
+	}
+	return plaintext[:len(plaintext)-pad], nil
+}
+
+// EncryptUserData encrypts the user data the same way wechat does, it's the
+// reverse of DecryptUserData
+func EncryptUserData(sessionKey, iv string, data []byte) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(sessionKey)
+	if err != nil || len(key) != 16 {
+		return "", fmt.Errorf("invalid session key")
+	}
+	ivBytes, err := base64.StdEncoding.DecodeString(iv)
+	if err != nil || len(ivBytes) != aes.BlockSize {
+		return "", fmt.Errorf("invalid iv")
+	}
+
+	// add the pkcs7 padding
+	pad := aes.BlockSize - len(data)%aes.BlockSize
+	plaintext := append(append([]byte{}, data...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, ivBytes).CryptBlocks(ciphertext, plaintext)
+
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// UserDataSignature computes the signature of the raw user data returned by
+// wx.getUserInfo, which is sha1(rawData + session_key)
+func UserDataSignature(rawData, sessionKey string) string {
+	sum := sha1.Sum([]byte(rawData + sessionKey))
+	return fmt.Sprintf("%x", sum)
+}
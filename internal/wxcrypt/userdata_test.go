@@ -0,0 +1,84 @@
+package wxcrypt
+
+import (
+	"testing"
+)
+
+const (
+	testSessionKey = "tiihtNczf5v6AKRyjwEUhQ=="
+	testIV         = "r7BXXKkLb8qrSNn05n0qiA=="
+)
+
+func TestEncryptDecryptUserData(t *testing.T) {
+	data := []byte(`{"phoneNumber":"13800138000","watermark":{"appid":"wx123","timestamp":1477314187}}`)
+
+	encrypted, err := EncryptUserData(testSessionKey, testIV, data)
+	if err != nil {
+		t.Fatalf("EncryptUserData error: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		sessionKey string
+		iv         string
+		encrypted  string
+		wantErr    bool
+	}{
+		{
+			name:       "valid data",
+			sessionKey: testSessionKey,
+			iv:         testIV,
+			encrypted:  encrypted,
+			wantErr:    false,
+		},
+		{
+			name:       "invalid session key",
+			sessionKey: "short",
+			iv:         testIV,
+			encrypted:  encrypted,
+			wantErr:    true,
+		},
+		{
+			name:       "invalid iv",
+			sessionKey: testSessionKey,
+			iv:         "short",
+			encrypted:  encrypted,
+			wantErr:    true,
+		},
+		{
+			name:       "invalid base64",
+			sessionKey: testSessionKey,
+			iv:         testIV,
+			encrypted:  "not base64!",
+			wantErr:    true,
+		},
+		{
+			name:       "invalid length",
+			sessionKey: testSessionKey,
+			iv:         testIV,
+			encrypted:  "YWJj",
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecryptUserData(tt.sessionKey, tt.encrypted, tt.iv)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecryptUserData() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != string(data) {
+				t.Errorf("DecryptUserData() = %s, want %s", got, data)
+			}
+		})
+	}
+}
+
+func TestUserDataSignature(t *testing.T) {
+	// the example of the wechat documentation
+	rawData := `{"nickName":"Band","gender":1,"language":"zh_CN","city":"Guangzhou","province":"Guangdong","country":"CN","avatarUrl":"http://wx.qlogo.cn/mmopen/vi_32/1vZvI39NWFQ9XM4LtQpFrQJ1xlgZxx3w7bQxKARol6503Iuswjjn6nIGBiaycAjAtpujxyzYsrztuuICqIM5ibXQ/0"}`
+	sessionKey := "HyVFkGl5F5OQWJZZaNzBBg=="
+	if got := UserDataSignature(rawData, sessionKey); got != "75e81ceda165f4ffa64f4068af58c64b8f54b88c" {
+		t.Errorf("UserDataSignature() = %s", got)
+	}
+}
@@ -0,0 +1,172 @@
+// Package client is the Go client of wechat-token-hub. It caches the
+// credentials until the hub says they expire, and rotates them when WeChat
+// rejects them.
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the credentials are refreshed this long before the hub says they expire by default
+const defaultExpiryMargin = time.Minute
+
+// Error is an error response of the hub
+type Error struct {
+	StatusCode int
+	Message    string
+	// how long to wait before retrying, set when the request was rate limited
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("wechat-token-hub: %d %s", e.StatusCode, e.Message)
+}
+
+// Client gets the credentials from the hub and caches them
+type Client struct {
+	// the url of the hub, such as http://localhost:8567
+	BaseURL string
+	// the client used to call the hub, its transport must authenticate the
+	// requests, such as a JWTTransport
+	HTTPClient *http.Client
+	// how long before the expiry a credential is fetched again, one minute if not set
+	ExpiryMargin time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	value   string
+	expires time.Time
+	// the fingerprint of the value sent by the hub, to rotate it without
+	// sending the value again
+	fingerprint string
+}
+
+// New returns a client of the hub at baseURL, authenticating the requests
+// with a JWT minted from the key
+func New(baseURL string, kid string, secret []byte, subject string) *Client {
+	return &Client{
+		BaseURL: baseURL,
+		HTTPClient: &http.Client{
+			Transport: &JWTTransport{KeyID: kid, Secret: secret, Subject: subject},
+		},
+	}
+}
+
+// AccessToken returns the access token of the account, an empty appid means
+// the default account of the hub
+func (c *Client) AccessToken(ctx context.Context, appid string) (string, error) {
+	return c.get(ctx, "/access_token", url.Values{"appid": {appid}}, "", "")
+}
+
+// RotateAccessToken asks the hub for a new access token of the account, if
+// old is still the current one. Call it when WeChat rejects old.
+func (c *Client) RotateAccessToken(ctx context.Context, appid string, old string) (string, error) {
+	return c.get(ctx, "/access_token", url.Values{"appid": {appid}}, "rotate_token", old)
+}
+
+// Ticket returns the ticket of the account, such as the jsapi ticket
+func (c *Client) Ticket(ctx context.Context, appid string, ticketType string) (string, error) {
+	return c.get(ctx, "/ticket", url.Values{"appid": {appid}, "type": {ticketType}}, "", "")
+}
+
+// RotateTicket asks the hub for a new ticket of the account, if old is still
+// the current one
+func (c *Client) RotateTicket(ctx context.Context, appid string, ticketType string, old string) (string, error) {
+	return c.get(ctx, "/ticket", url.Values{"appid": {appid}, "type": {ticketType}}, "rotate_ticket", old)
+}
+
+// return the cached credential of the path, or request it from the hub. If
+// rotate is set, the hub is asked to replace old, by its fingerprint if the
+// hub sent it, or with the rotate query.
+func (c *Client) get(ctx context.Context, path string, query url.Values, rotate string, old string) (string, error) {
+	for k, v := range query {
+		if len(v) == 0 || v[0] == "" {
+			delete(query, k)
+		}
+	}
+	key := path + "?" + query.Encode()
+
+	c.mu.Lock()
+	entry, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) && (rotate == "" || entry.value != old) {
+		return entry.value, nil
+	}
+
+	var rotateFingerprint string
+	if rotate != "" {
+		if ok && entry.value == old && entry.fingerprint != "" {
+			rotateFingerprint = entry.fingerprint
+		} else {
+			query.Set(rotate, old)
+		}
+	}
+	value, expiresIn, fingerprint, err := c.request(ctx, path+"?"+query.Encode(), rotateFingerprint)
+	if err != nil {
+		return "", err
+	}
+
+	margin := c.ExpiryMargin
+	if margin == 0 {
+		margin = defaultExpiryMargin
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cache == nil {
+		c.cache = make(map[string]cacheEntry)
+	}
+	if expiresIn > margin {
+		c.cache[key] = cacheEntry{value: value, expires: time.Now().Add(expiresIn - margin), fingerprint: fingerprint}
+	} else {
+		// keep the fingerprint to rotate the value, which is expired at once
+		c.cache[key] = cacheEntry{value: value, fingerprint: fingerprint}
+	}
+	return value, nil
+}
+
+// request the credential from the hub, rotating the one with the fingerprint
+// if set, with the time until it expires and its fingerprint
+func (c *Client) request(ctx context.Context, pathAndQuery string, rotateFingerprint string) (string, time.Duration, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(c.BaseURL, "/")+pathAndQuery, nil)
+	if err != nil {
+		return "", 0, "", err
+	}
+	if rotateFingerprint != "" {
+		req.Header.Set("X-Rotate-Fingerprint", rotateFingerprint)
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", 0, "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		e := &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			e.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return "", 0, "", e
+	}
+
+	seconds, _ := strconv.Atoi(resp.Header.Get("X-Expires-In"))
+	return string(body), time.Duration(seconds) * time.Second, resp.Header.Get("X-Credential-Fingerprint"), nil
+}
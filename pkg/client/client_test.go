@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// a hub issuing token1, token2... and counting the requests, the tokens are
+// rotated by the rotate_token query or by their fingerprint fp-token1...
+func mockHub(t *testing.T, expiresIn string) (*httptest.Server, *int32) {
+	var requests int32
+	current := "token1"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.Header.Get("Authorization") == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("appid") == "wxlimited" {
+			w.Header().Set("Retry-After", "3")
+			http.Error(w, "rotate refused", http.StatusTooManyRequests)
+			return
+		}
+		if rotate := r.URL.Query().Get("rotate_token"); rotate != "" && rotate == current {
+			current = fmt.Sprintf("token%d", atomic.LoadInt32(&requests))
+		}
+		if r.Header.Get("X-Rotate-Fingerprint") == "fp-"+current {
+			current = fmt.Sprintf("token%d", atomic.LoadInt32(&requests))
+		}
+		w.Header().Set("X-Credential-Fingerprint", "fp-"+current)
+		if expiresIn != "" {
+			w.Header().Set("X-Expires-In", expiresIn)
+		}
+		w.Write([]byte(current))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestAccessTokenCache(t *testing.T) {
+	hub, requests := mockHub(t, "7200")
+	c := New(hub.URL, "key1", []byte("secret1"), "service-a")
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if token, err := c.AccessToken(ctx, ""); err != nil || token != "token1" {
+			t.Fatalf("AccessToken() = %s, %v, want token1", token, err)
+		}
+	}
+	if *requests != 1 {
+		t.Errorf("Expected the token to be cached, got %d requests", *requests)
+	}
+
+	// rotating an outdated token returns the cached one
+	if token, _ := c.RotateAccessToken(ctx, "", "token0"); token != "token1" || *requests != 1 {
+		t.Errorf("RotateAccessToken() = %s after %d requests, want the cached token1", token, *requests)
+	}
+
+	// rotating the current token asks the hub, and caches the new one
+	token, err := c.RotateAccessToken(ctx, "", "token1")
+	if err != nil || token == "token1" {
+		t.Fatalf("RotateAccessToken() = %s, %v, want a new token", token, err)
+	}
+	if cached, _ := c.AccessToken(ctx, ""); cached != token || *requests != 2 {
+		t.Errorf("AccessToken() = %s after %d requests, want the cached %s", cached, *requests, token)
+	}
+}
+
+func TestRotateByFingerprint(t *testing.T) {
+	var rotateQueries int32
+	hub, _ := mockHub(t, "7200")
+	c := New(hub.URL, "key1", []byte("secret1"), "service-a")
+	c.HTTPClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Query().Get("rotate_token") != "" {
+			atomic.AddInt32(&rotateQueries, 1)
+		}
+		return (&JWTTransport{KeyID: "key1", Secret: []byte("secret1"), Subject: "service-a"}).RoundTrip(req)
+	})
+	ctx := context.Background()
+
+	// the cached token is rotated by its fingerprint, never sent to the hub
+	c.AccessToken(ctx, "")
+	token, err := c.RotateAccessToken(ctx, "", "token1")
+	if err != nil || token == "token1" {
+		t.Fatalf("RotateAccessToken() = %s, %v, want a new token", token, err)
+	}
+	if rotateQueries != 0 {
+		t.Errorf("Expected the token not to be sent in the query")
+	}
+
+	// a token the client doesn't know the fingerprint of is sent in the query
+	other := &Client{BaseURL: hub.URL, HTTPClient: c.HTTPClient}
+	other.RotateAccessToken(ctx, "", token)
+	if rotateQueries != 1 {
+		t.Errorf("Expected the unknown token to be sent in the query, got %d", rotateQueries)
+	}
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestAccessTokenWithoutExpiry(t *testing.T) {
+	hub, requests := mockHub(t, "")
+	c := New(hub.URL, "key1", []byte("secret1"), "service-a")
+
+	// the tokens without expiry are not cached
+	c.AccessToken(context.Background(), "")
+	c.AccessToken(context.Background(), "")
+	if *requests != 2 {
+		t.Errorf("Expected 2 requests, got %d", *requests)
+	}
+}
+
+func TestError(t *testing.T) {
+	hub, _ := mockHub(t, "7200")
+
+	// without a JWT
+	c := &Client{BaseURL: hub.URL}
+	_, err := c.Ticket(context.Background(), "", "jsapi")
+	var hubErr *Error
+	if !errors.As(err, &hubErr) || hubErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Ticket() error = %v, want 401", err)
+	}
+
+	// rate limited
+	c = New(hub.URL, "key1", []byte("secret1"), "service-a")
+	_, err = c.RotateAccessToken(context.Background(), "wxlimited", "token1")
+	if !errors.As(err, &hubErr) || hubErr.StatusCode != http.StatusTooManyRequests || hubErr.RetryAfter.Seconds() != 3 {
+		t.Errorf("RotateAccessToken() error = %v, want 429 with retry after", err)
+	}
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// the lifetime of the minted tokens by default
+const defaultJWTTTL = time.Hour
+
+// JWTTransport authenticates the requests to the hub with a JWT signed with
+// the secret of JWT_KEY_{kid}, minting a new one before it expires
+type JWTTransport struct {
+	KeyID   string
+	Secret  []byte
+	Subject string
+	// the scopes claimed, which the hub must grant to the key in JWT_SCOPES_{kid}
+	Scopes []string
+	// the lifetime of the minted tokens, one hour if not set
+	TTL time.Duration
+	// the transport making the requests, http.DefaultTransport if not set
+	Base http.RoundTripper
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// RoundTrip sets the Authorization header and makes the request
+func (t *JWTTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.jwt()
+	if err != nil {
+		return nil, err
+	}
+
+	// a RoundTripper must not modify the request
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return base(t.Base).RoundTrip(req)
+}
+
+// return the minted token, or mint a new one if it expires soon
+func (t *JWTTransport) jwt() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ttl := t.TTL
+	if ttl == 0 {
+		ttl = defaultJWTTTL
+	}
+	now := time.Now()
+	if t.token != "" && now.Add(ttl/10).Before(t.expires) {
+		return t.token, nil
+	}
+
+	claims := jwt.MapClaims{
+		"aud": "wechat-token-hub",
+		"iat": now.Unix(),
+		"exp": now.Add(ttl).Unix(),
+	}
+	if t.Subject != "" {
+		claims["sub"] = t.Subject
+	}
+	if len(t.Scopes) > 0 {
+		claims["scope"] = strings.Join(t.Scopes, " ")
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = t.KeyID
+	signed, err := token.SignedString(t.Secret)
+	if err != nil {
+		return "", err
+	}
+
+	t.token = signed
+	t.expires = now.Add(ttl)
+	return signed, nil
+}
+
+func base(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		return http.DefaultTransport
+	}
+	return rt
+}
@@ -0,0 +1,39 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestJWTTransport(t *testing.T) {
+	var tokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokens = append(tokens, strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	}))
+	defer server.Close()
+
+	transport := &JWTTransport{KeyID: "key1", Secret: []byte("secret1"), Subject: "service-a", Scopes: []string{"admin"}}
+	httpClient := &http.Client{Transport: transport}
+	httpClient.Get(server.URL)
+	httpClient.Get(server.URL)
+
+	// the token is minted once and reused
+	if len(tokens) != 2 || tokens[0] == "" || tokens[0] != tokens[1] {
+		t.Fatalf("Unexpected tokens: %v", tokens)
+	}
+
+	token, err := jwt.Parse(tokens[0], func(token *jwt.Token) (interface{}, error) {
+		return []byte("secret1"), nil
+	}, jwt.WithAudience("wechat-token-hub"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	if token.Header["kid"] != "key1" || claims["sub"] != "service-a" || claims["scope"] != "admin" || claims["exp"] == nil {
+		t.Errorf("Unexpected token: %v %v", token.Header, claims)
+	}
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Transport calls the WeChat API with the access token of an account from
+// the hub. The token is added as the access_token query, and when WeChat
+// says it's invalid or expired, the hub is asked to rotate it and the
+// request is sent again once.
+type Transport struct {
+	Client *Client
+	// the account whose access token is used, empty means the default account of the hub
+	AppID string
+	// the transport making the requests to WeChat, http.DefaultTransport if not set
+	Base http.RoundTripper
+}
+
+// RoundTrip makes the request with the access token, rotating it if needed
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// keep the body to send it again
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	token, err := t.Client.AccessToken(req.Context(), t.AppID)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.send(req, body, token)
+	if err != nil {
+		return nil, err
+	}
+	invalid, err := invalidToken(resp)
+	if err != nil || !invalid {
+		return resp, err
+	}
+
+	token, err = t.Client.RotateAccessToken(req.Context(), t.AppID, token)
+	if err != nil {
+		return nil, err
+	}
+	return t.send(req, body, token)
+}
+
+// send a copy of the request with the access token
+func (t *Transport) send(req *http.Request, body []byte, token string) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	query := r.URL.Query()
+	query.Set("access_token", token)
+	r.URL.RawQuery = query.Encode()
+	if body != nil {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		r.ContentLength = int64(len(body))
+	}
+	return base(t.Base).RoundTrip(r)
+}
+
+// report whether wechat rejected the access token as invalid or expired. The
+// json and text responses are read and replaced by a copy, the others such
+// as media downloads are left untouched.
+func invalidToken(resp *http.Response) (bool, error) {
+	contentType := resp.Header.Get("Content-Type")
+	if !strings.Contains(contentType, "json") && !strings.HasPrefix(contentType, "text/") {
+		return false, nil
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return false, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+
+	var result struct {
+		ErrCode int `json:"errcode"`
+	}
+	if json.Unmarshal(data, &result) != nil {
+		return false, nil
+	}
+	switch result.ErrCode {
+	case 40001, 40014, 42001:
+		return true, nil
+	}
+	return false, nil
+}
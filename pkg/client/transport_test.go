@@ -0,0 +1,68 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTransport(t *testing.T) {
+	hub, _ := mockHub(t, "7200")
+
+	// wechat accepts only the rotated token, and checks the body is sent again
+	var calls int
+	wechat := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		if string(body) != `{"touser":"openid1"}` {
+			w.Write([]byte(`{"errcode":44002,"errmsg":"empty post data"}`))
+			return
+		}
+		if r.URL.Query().Get("access_token") == "token1" {
+			w.Write([]byte(`{"errcode":40001,"errmsg":"invalid credential"}`))
+			return
+		}
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer wechat.Close()
+
+	httpClient := &http.Client{Transport: &Transport{Client: New(hub.URL, "key1", []byte("secret1"), "service-a")}}
+	resp, err := httpClient.Post(wechat.URL+"/cgi-bin/message/custom/send", "application/json", strings.NewReader(`{"touser":"openid1"}`))
+	if err != nil {
+		t.Fatalf("Post() error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != `{"errcode":0,"errmsg":"ok"}` || calls != 2 {
+		t.Errorf("Post() = %s after %d calls, want ok after 2 calls", body, calls)
+	}
+}
+
+func TestTransportOtherErrors(t *testing.T) {
+	hub, _ := mockHub(t, "7200")
+
+	// the other errors are returned as is without rotating
+	var calls int
+	wechat := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(`{"errcode":45009,"errmsg":"reach max api daily quota limit"}`))
+	}))
+	defer wechat.Close()
+
+	httpClient := &http.Client{Transport: &Transport{Client: New(hub.URL, "key1", []byte("secret1"), "service-a")}}
+	resp, err := httpClient.Get(wechat.URL + "/cgi-bin/user/info?openid=openid1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "45009") || calls != 1 {
+		t.Errorf("Get() = %s after %d calls, want the quota error after 1 call", body, calls)
+	}
+}
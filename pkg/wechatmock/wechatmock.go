@@ -0,0 +1,453 @@
+// Package wechatmock emulates the credential APIs of WeChat for local
+// development and tests, so that the hub can run without real accounts.
+//
+// Like WeChat, issuing a new access token invalidates the old one, the
+// calls with an invalid or expired token fail with 40001 or 42001, and the
+// calls over the daily quota fail with 45009. Failures and latency can be
+// scripted. The login codes of the mini programs and of the web authorization
+// are exchanged for an openid derived from the code, and can be used only once.
+package wechatmock
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the lifetime of the credentials issued by WeChat
+const defaultExpiresIn = 7200
+
+// wechat allows 2000 calls a day to cgi-bin/token by default
+const defaultDailyLimit = 2000
+
+// Failure is a scripted error response
+type Failure struct {
+	ErrCode int
+	ErrMsg  string
+	// the http status, 200 if not set, as WeChat returns most errors with 200
+	Status int
+}
+
+// Server is a mock of the WeChat API, use it as an http.Handler
+type Server struct {
+	// seconds until the issued credentials expire, 7200 if not set
+	ExpiresIn int
+	// the calls allowed a day for each API of each account, 2000 if not set
+	DailyLimit int
+	// the delay before each response
+	Latency time.Duration
+
+	mu        sync.Mutex
+	accounts  map[string]*account
+	tokens    map[string]*token
+	calls     map[string]int
+	day       time.Time
+	failures  map[string][]Failure
+	component *component
+	// the refresh tokens of the web authorization
+	refreshTokens map[string]*token
+	now           func() time.Time
+}
+
+type account struct {
+	secret string
+	// the current access tokens of cgi-bin/token and cgi-bin/stable_token
+	token       string
+	stableToken string
+	// the session keys of the users of a mini program, by openid
+	sessionKeys map[string]string
+	usedCodes   map[string]bool
+}
+
+type component struct {
+	appid        string
+	secret       string
+	verifyTicket string
+	token        string
+}
+
+// an issued credential, the access tokens of the web authorization are
+// issued to a user
+type token struct {
+	appid   string
+	openid  string
+	expires time.Time
+}
+
+// New returns a mock without accounts
+func New() *Server {
+	return &Server{
+		accounts: make(map[string]*account),
+		tokens:   make(map[string]*token),
+		calls:    make(map[string]int),
+		failures: make(map[string][]Failure),
+		now:      time.Now,
+
+		refreshTokens: make(map[string]*token),
+	}
+}
+
+// AddAccount adds an official account or mini program
+func (s *Server) AddAccount(appid string, secret string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.accounts[appid] = &account{secret: secret, sessionKeys: make(map[string]string), usedCodes: make(map[string]bool)}
+}
+
+// SessionKey returns the session key issued to the user of a mini program
+func (s *Server) SessionKey(appid string, openid string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a, ok := s.accounts[appid]; ok {
+		return a.sessionKeys[openid]
+	}
+	return ""
+}
+
+// OpenID returns the openid of the user logging in with the code
+func OpenID(appid string, code string) string {
+	sum := sha256.Sum256([]byte(appid + "\n" + code))
+	return "o" + hex.EncodeToString(sum[:])[:27]
+}
+
+// SetComponent sets the third-party platform of the open platform, an empty
+// verifyTicket accepts any verify ticket
+func (s *Server) SetComponent(appid string, secret string, verifyTicket string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.component = &component{appid: appid, secret: secret, verifyTicket: verifyTicket}
+}
+
+// Fail makes the next calls to the API at path fail, one call for each failure
+func (s *Server) Fail(path string, failures ...Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[path] = append(s.failures[path], failures...)
+}
+
+// Calls returns the number of calls to the API at path since the start of the day
+func (s *Server) Calls(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	total := 0
+	for key, n := range s.calls {
+		if strings.HasSuffix(key, " "+path) {
+			total += n
+		}
+	}
+	return total
+}
+
+// Valid reports whether the access token is valid
+func (s *Server) Valid(accessToken string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[accessToken]
+	return ok && s.now().Before(t.expires)
+}
+
+// ResetQuota resets the calls counted for the daily quota
+func (s *Server) ResetQuota() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = make(map[string]int)
+}
+
+// ServeHTTP handles a call to the WeChat API
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Latency > 0 {
+		select {
+		case <-time.After(s.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	var body map[string]interface{}
+	if r.Method == http.MethodPost {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+	param := func(name string) string {
+		if v, ok := body[name]; ok {
+			if str, ok := v.(string); ok {
+				return str
+			}
+		}
+		return r.URL.Query().Get(name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if failures := s.failures[r.URL.Path]; len(failures) > 0 {
+		s.failures[r.URL.Path] = failures[1:]
+		f := failures[0]
+		if f.Status != 0 {
+			w.WriteHeader(f.Status)
+		}
+		writeResult(w, f.ErrCode, f.ErrMsg, nil)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/cgi-bin/token":
+		s.issueToken(w, param("appid"), param("secret"), false, true)
+	case "/cgi-bin/stable_token":
+		s.issueToken(w, param("appid"), param("secret"), true, body["force_refresh"] == true)
+	case "/sns/jscode2session":
+		s.code2Session(w, param("appid"), param("secret"), param("js_code"))
+	case "/sns/oauth2/access_token":
+		s.oauthToken(w, param("appid"), param("secret"), param("code"))
+	case "/sns/oauth2/refresh_token":
+		rt, ok := s.refreshTokens[param("refresh_token")]
+		if !ok || rt.appid != param("appid") || !s.now().Before(rt.expires) {
+			writeResult(w, 40030, "invalid refresh_token", nil)
+			return
+		}
+		accessToken := s.newToken("oauth_access_token_", rt.appid)
+		s.tokens[accessToken].openid = rt.openid
+		writeResult(w, 0, "ok", map[string]interface{}{"access_token": accessToken, "expires_in": s.expiresIn(), "refresh_token": param("refresh_token"), "openid": rt.openid, "scope": "snsapi_userinfo"})
+	case "/sns/userinfo":
+		t, ok := s.tokens[r.URL.Query().Get("access_token")]
+		if !ok || t.openid == "" || t.openid != r.URL.Query().Get("openid") {
+			writeResult(w, 40001, "invalid credential, access_token is invalid or not latest", nil)
+			return
+		}
+		if !s.now().Before(t.expires) {
+			writeResult(w, 42001, "access_token expired", nil)
+			return
+		}
+		writeResult(w, 0, "ok", map[string]interface{}{"openid": t.openid, "nickname": "user " + t.openid})
+	case "/cgi-bin/ticket/getticket":
+		appid, ok := s.checkToken(w, r.URL.Query().Get("access_token"))
+		if !ok || !s.count(w, appid, r.URL.Path) {
+			return
+		}
+		ticketType := r.URL.Query().Get("type")
+		if ticketType != "jsapi" && ticketType != "wx_card" {
+			writeResult(w, 40097, "invalid args", nil)
+			return
+		}
+		writeResult(w, 0, "ok", map[string]interface{}{"ticket": randomValue(ticketType + "_ticket_"), "expires_in": s.expiresIn()})
+	case "/cgi-bin/component/api_component_token":
+		c := s.component
+		if c == nil || param("component_appid") != c.appid {
+			writeResult(w, 40013, "invalid appid", nil)
+			return
+		}
+		if param("component_appsecret") != c.secret {
+			writeResult(w, 40125, "invalid appsecret", nil)
+			return
+		}
+		if ticket := param("component_verify_ticket"); ticket == "" || (c.verifyTicket != "" && ticket != c.verifyTicket) {
+			writeResult(w, 61006, "component ticket is invalid", nil)
+			return
+		}
+		if !s.count(w, c.appid, r.URL.Path) {
+			return
+		}
+		delete(s.tokens, c.token)
+		c.token = s.newToken("component_access_token_", c.appid)
+		writeResult(w, 0, "ok", map[string]interface{}{"component_access_token": c.token, "expires_in": s.expiresIn()})
+	case "/cgi-bin/component/api_create_preauthcode":
+		appid, ok := s.checkToken(w, r.URL.Query().Get("component_access_token"))
+		if !ok || !s.count(w, appid, r.URL.Path) {
+			return
+		}
+		writeResult(w, 0, "ok", map[string]interface{}{"pre_auth_code": randomValue("pre_auth_code_"), "expires_in": 600})
+	case "/cgi-bin/clear_quota":
+		appid, ok := s.checkToken(w, r.URL.Query().Get("access_token"))
+		if !ok {
+			return
+		}
+		for key := range s.calls {
+			if strings.HasPrefix(key, appid+" ") {
+				delete(s.calls, key)
+			}
+		}
+		writeResult(w, 0, "ok", nil)
+	default:
+		// any other api only checks the access token
+		if !strings.HasPrefix(r.URL.Path, "/cgi-bin/") {
+			http.NotFound(w, r)
+			return
+		}
+		appid, ok := s.checkToken(w, r.URL.Query().Get("access_token"))
+		if !ok || !s.count(w, appid, r.URL.Path) {
+			return
+		}
+		writeResult(w, 0, "ok", nil)
+	}
+}
+
+// issue an access token, the new token of cgi-bin/token invalidates the old
+// one, while cgi-bin/stable_token returns the current one unless forced
+func (s *Server) issueToken(w http.ResponseWriter, appid string, secret string, stable bool, force bool) {
+	a, ok := s.accounts[appid]
+	if !ok {
+		writeResult(w, 40013, "invalid appid", nil)
+		return
+	}
+	if secret != a.secret {
+		writeResult(w, 40125, "invalid appsecret", nil)
+		return
+	}
+
+	current := &a.token
+	if stable {
+		current = &a.stableToken
+	}
+	if t, ok := s.tokens[*current]; ok && !force && s.now().Before(t.expires) {
+		writeResult(w, 0, "ok", map[string]interface{}{"access_token": *current, "expires_in": int(t.expires.Sub(s.now()).Seconds())})
+		return
+	}
+
+	path := "/cgi-bin/token"
+	if stable {
+		path = "/cgi-bin/stable_token"
+	}
+	if !s.count(w, appid, path) {
+		return
+	}
+	delete(s.tokens, *current)
+	*current = s.newToken("access_token_", appid)
+	writeResult(w, 0, "ok", map[string]interface{}{"access_token": *current, "expires_in": s.expiresIn()})
+}
+
+// exchange the login code of a mini program user for a new session key
+func (s *Server) code2Session(w http.ResponseWriter, appid string, secret string, code string) {
+	a, ok := s.accounts[appid]
+	if !ok {
+		writeResult(w, 40013, "invalid appid", nil)
+		return
+	}
+	if secret != a.secret {
+		writeResult(w, 40125, "invalid appsecret", nil)
+		return
+	}
+	if code == "" {
+		writeResult(w, 40029, "invalid code", nil)
+		return
+	}
+	if a.usedCodes[code] {
+		writeResult(w, 40163, "code been used", nil)
+		return
+	}
+	if !s.count(w, appid, "/sns/jscode2session") {
+		return
+	}
+	a.usedCodes[code] = true
+
+	key := make([]byte, 16)
+	rand.Read(key)
+	openid := OpenID(appid, code)
+	a.sessionKeys[openid] = base64.StdEncoding.EncodeToString(key)
+	writeResult(w, 0, "ok", map[string]interface{}{"openid": openid, "session_key": a.sessionKeys[openid]})
+}
+
+// exchange the code of the web authorization for the access token of the user
+func (s *Server) oauthToken(w http.ResponseWriter, appid string, secret string, code string) {
+	a, ok := s.accounts[appid]
+	if !ok {
+		writeResult(w, 40013, "invalid appid", nil)
+		return
+	}
+	if secret != a.secret {
+		writeResult(w, 40125, "invalid appsecret", nil)
+		return
+	}
+	if code == "" {
+		writeResult(w, 40029, "invalid code", nil)
+		return
+	}
+	if a.usedCodes[code] {
+		writeResult(w, 40163, "code been used", nil)
+		return
+	}
+	a.usedCodes[code] = true
+
+	openid := OpenID(appid, code)
+	accessToken := s.newToken("oauth_access_token_", appid)
+	s.tokens[accessToken].openid = openid
+	refreshToken := randomValue("refresh_token_")
+	s.refreshTokens[refreshToken] = &token{appid: appid, openid: openid, expires: s.now().Add(30 * 24 * time.Hour)}
+	writeResult(w, 0, "ok", map[string]interface{}{"access_token": accessToken, "expires_in": s.expiresIn(), "refresh_token": refreshToken, "openid": openid, "scope": "snsapi_userinfo"})
+}
+
+// check the access token, and return the account it was issued to
+func (s *Server) checkToken(w http.ResponseWriter, accessToken string) (string, bool) {
+	t, ok := s.tokens[accessToken]
+	if !ok || t.openid != "" {
+		writeResult(w, 40001, "invalid credential, access_token is invalid or not latest", nil)
+		return "", false
+	}
+	if !s.now().Before(t.expires) {
+		writeResult(w, 42001, "access_token expired", nil)
+		return "", false
+	}
+	return t.appid, true
+}
+
+// count the call in the daily quota of the api, and refuse it if it's used up
+func (s *Server) count(w http.ResponseWriter, appid string, path string) bool {
+	limit := s.DailyLimit
+	if limit == 0 {
+		limit = defaultDailyLimit
+	}
+	// the quota is reset every day
+	if day := s.now().Truncate(24 * time.Hour); !day.Equal(s.day) {
+		s.calls = make(map[string]int)
+		s.day = day
+	}
+
+	key := appid + " " + path
+	if s.calls[key] >= limit {
+		writeResult(w, 45009, "reach max api daily quota limit", nil)
+		return false
+	}
+	s.calls[key]++
+	return true
+}
+
+// issue an access token of the account
+func (s *Server) newToken(prefix string, appid string) string {
+	value := randomValue(prefix)
+	s.tokens[value] = &token{appid: appid, expires: s.now().Add(time.Duration(s.expiresIn()) * time.Second)}
+	return value
+}
+
+func randomValue(prefix string) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+func (s *Server) expiresIn() int {
+	if s.ExpiresIn > 0 {
+		return s.ExpiresIn
+	}
+	return defaultExpiresIn
+}
+
+// write the json response with the errcode and errmsg of wechat
+func writeResult(w http.ResponseWriter, errcode int, errmsg string, fields map[string]interface{}) {
+	result := map[string]interface{}{"errcode": errcode, "errmsg": errmsg}
+	for k, v := range fields {
+		result[k] = v
+	}
+	w.Header().Set("Content-Type", "application/json; encoding=utf-8")
+	json.NewEncoder(w).Encode(result)
+}
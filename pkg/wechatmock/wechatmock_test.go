@@ -0,0 +1,202 @@
+package wechatmock
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type result struct {
+	ErrCode              int    `json:"errcode"`
+	AccessToken          string `json:"access_token"`
+	Ticket               string `json:"ticket"`
+	ComponentAccessToken string `json:"component_access_token"`
+	PreAuthCode          string `json:"pre_auth_code"`
+	ExpiresIn            int    `json:"expires_in"`
+	OpenID               string `json:"openid"`
+	SessionKey           string `json:"session_key"`
+	RefreshToken         string `json:"refresh_token"`
+	Nickname             string `json:"nickname"`
+}
+
+// call the mock and decode the response
+func call(t *testing.T, s *Server, method string, url string, body interface{}) result {
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, url, bytes.NewReader(data))
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, req)
+
+	var r result
+	if err := json.Unmarshal(rr.Body.Bytes(), &r); err != nil {
+		t.Fatalf("Expected a json response, got %s", rr.Body.String())
+	}
+	return r
+}
+
+func TestToken(t *testing.T) {
+	s := New()
+	s.AddAccount("wx1", "secret1")
+
+	if r := call(t, s, "GET", "/cgi-bin/token?grant_type=client_credential&appid=wx2&secret=secret1", nil); r.ErrCode != 40013 {
+		t.Errorf("Expected 40013 for an unknown appid, got %+v", r)
+	}
+	if r := call(t, s, "GET", "/cgi-bin/token?grant_type=client_credential&appid=wx1&secret=wrong", nil); r.ErrCode != 40125 {
+		t.Errorf("Expected 40125 for a wrong secret, got %+v", r)
+	}
+
+	first := call(t, s, "GET", "/cgi-bin/token?grant_type=client_credential&appid=wx1&secret=secret1", nil)
+	if first.AccessToken == "" || first.ExpiresIn != 7200 || !s.Valid(first.AccessToken) {
+		t.Fatalf("Unexpected token: %+v", first)
+	}
+	if r := call(t, s, "GET", "/cgi-bin/ticket/getticket?type=jsapi&access_token="+first.AccessToken, nil); r.Ticket == "" {
+		t.Errorf("Expected a ticket, got %+v", r)
+	}
+
+	// a new token invalidates the old one
+	second := call(t, s, "GET", "/cgi-bin/token?grant_type=client_credential&appid=wx1&secret=secret1", nil)
+	if second.AccessToken == first.AccessToken || s.Valid(first.AccessToken) {
+		t.Errorf("Expected the old token to be invalidated")
+	}
+	if r := call(t, s, "GET", "/cgi-bin/ticket/getticket?type=jsapi&access_token="+first.AccessToken, nil); r.ErrCode != 40001 {
+		t.Errorf("Expected 40001 for the old token, got %+v", r)
+	}
+	if r := call(t, s, "POST", "/cgi-bin/message/custom/send?access_token="+second.AccessToken, map[string]string{}); r.ErrCode != 0 {
+		t.Errorf("Expected the other apis to accept the token, got %+v", r)
+	}
+	if n := s.Calls("/cgi-bin/token"); n != 2 {
+		t.Errorf("Calls() = %d, want 2", n)
+	}
+
+	// the token expires
+	s.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if r := call(t, s, "GET", "/cgi-bin/ticket/getticket?type=jsapi&access_token="+second.AccessToken, nil); r.ErrCode != 42001 {
+		t.Errorf("Expected 42001 for the expired token, got %+v", r)
+	}
+}
+
+func TestStableToken(t *testing.T) {
+	s := New()
+	s.AddAccount("wx1", "secret1")
+	body := map[string]interface{}{"grant_type": "client_credential", "appid": "wx1", "secret": "secret1"}
+
+	first := call(t, s, "POST", "/cgi-bin/stable_token", body)
+	if again := call(t, s, "POST", "/cgi-bin/stable_token", body); again.AccessToken != first.AccessToken {
+		t.Errorf("Expected the same stable token, got %s and %s", first.AccessToken, again.AccessToken)
+	}
+
+	body["force_refresh"] = true
+	if forced := call(t, s, "POST", "/cgi-bin/stable_token", body); forced.AccessToken == first.AccessToken || s.Valid(first.AccessToken) {
+		t.Errorf("Expected the forced refresh to issue a new token")
+	}
+}
+
+func TestComponentToken(t *testing.T) {
+	s := New()
+	s.SetComponent("wxc", "csecret", "verify1")
+	body := map[string]string{"component_appid": "wxc", "component_appsecret": "csecret", "component_verify_ticket": "verify0"}
+
+	if r := call(t, s, "POST", "/cgi-bin/component/api_component_token", body); r.ErrCode != 61006 {
+		t.Errorf("Expected 61006 for a wrong verify ticket, got %+v", r)
+	}
+	body["component_verify_ticket"] = "verify1"
+	r := call(t, s, "POST", "/cgi-bin/component/api_component_token", body)
+	if r.ComponentAccessToken == "" {
+		t.Fatalf("Expected a component access token, got %+v", r)
+	}
+	if code := call(t, s, "POST", "/cgi-bin/component/api_create_preauthcode?component_access_token="+r.ComponentAccessToken, map[string]string{"component_appid": "wxc"}); code.PreAuthCode == "" {
+		t.Errorf("Expected a pre auth code, got %+v", code)
+	}
+}
+
+func TestCode2Session(t *testing.T) {
+	s := New()
+	s.AddAccount("wxmini", "secret1")
+
+	if r := call(t, s, "GET", "/sns/jscode2session?appid=wxmini&secret=wrong&js_code=code1&grant_type=authorization_code", nil); r.ErrCode != 40125 {
+		t.Errorf("Expected 40125 for a wrong secret, got %+v", r)
+	}
+	if r := call(t, s, "GET", "/sns/jscode2session?appid=wxmini&secret=secret1&grant_type=authorization_code", nil); r.ErrCode != 40029 {
+		t.Errorf("Expected 40029 without code, got %+v", r)
+	}
+
+	r := call(t, s, "GET", "/sns/jscode2session?appid=wxmini&secret=secret1&js_code=code1&grant_type=authorization_code", nil)
+	if r.OpenID != OpenID("wxmini", "code1") || r.SessionKey == "" || s.SessionKey("wxmini", r.OpenID) != r.SessionKey {
+		t.Errorf("Unexpected session: %+v", r)
+	}
+
+	// the code can be used only once
+	if r := call(t, s, "GET", "/sns/jscode2session?appid=wxmini&secret=secret1&js_code=code1&grant_type=authorization_code", nil); r.ErrCode != 40163 {
+		t.Errorf("Expected 40163 for a used code, got %+v", r)
+	}
+}
+
+func TestOAuth(t *testing.T) {
+	s := New()
+	s.AddAccount("wx1", "secret1")
+
+	if r := call(t, s, "GET", "/sns/oauth2/access_token?appid=wx1&secret=wrong&code=code1&grant_type=authorization_code", nil); r.ErrCode != 40125 {
+		t.Errorf("Expected 40125 for a wrong secret, got %+v", r)
+	}
+	token := call(t, s, "GET", "/sns/oauth2/access_token?appid=wx1&secret=secret1&code=code1&grant_type=authorization_code", nil)
+	if token.AccessToken == "" || token.RefreshToken == "" || token.OpenID != OpenID("wx1", "code1") {
+		t.Fatalf("Unexpected token: %+v", token)
+	}
+	if r := call(t, s, "GET", "/sns/oauth2/access_token?appid=wx1&secret=secret1&code=code1&grant_type=authorization_code", nil); r.ErrCode != 40163 {
+		t.Errorf("Expected 40163 for a used code, got %+v", r)
+	}
+
+	// the token of the user is only valid for the user apis
+	if r := call(t, s, "GET", "/sns/userinfo?access_token="+token.AccessToken+"&openid="+token.OpenID, nil); r.Nickname == "" {
+		t.Errorf("Expected the user info, got %+v", r)
+	}
+	if r := call(t, s, "GET", "/cgi-bin/ticket/getticket?type=jsapi&access_token="+token.AccessToken, nil); r.ErrCode != 40001 {
+		t.Errorf("Expected 40001 for the token of a user, got %+v", r)
+	}
+
+	refreshed := call(t, s, "GET", "/sns/oauth2/refresh_token?appid=wx1&grant_type=refresh_token&refresh_token="+token.RefreshToken, nil)
+	if refreshed.AccessToken == "" || refreshed.AccessToken == token.AccessToken || refreshed.OpenID != token.OpenID {
+		t.Errorf("Unexpected refreshed token: %+v", refreshed)
+	}
+	if r := call(t, s, "GET", "/sns/oauth2/refresh_token?appid=wx1&grant_type=refresh_token&refresh_token=wrong", nil); r.ErrCode != 40030 {
+		t.Errorf("Expected 40030 for a wrong refresh token, got %+v", r)
+	}
+}
+
+func TestQuotaAndFailures(t *testing.T) {
+	s := New()
+	s.AddAccount("wx1", "secret1")
+	s.DailyLimit = 1
+	url := "/cgi-bin/token?grant_type=client_credential&appid=wx1&secret=secret1"
+
+	call(t, s, "GET", url, nil)
+	if r := call(t, s, "GET", url, nil); r.ErrCode != 45009 {
+		t.Errorf("Expected 45009 over the quota, got %+v", r)
+	}
+	s.ResetQuota()
+
+	// the scripted failures are returned once each
+	s.Fail("/cgi-bin/token", Failure{ErrCode: -1, ErrMsg: "system error"}, Failure{ErrCode: 40164, ErrMsg: "invalid ip", Status: http.StatusForbidden})
+	if r := call(t, s, "GET", url, nil); r.ErrCode != -1 {
+		t.Errorf("Expected the first failure, got %+v", r)
+	}
+	if r := call(t, s, "GET", url, nil); r.ErrCode != 40164 {
+		t.Errorf("Expected the second failure, got %+v", r)
+	}
+	if r := call(t, s, "GET", url, nil); r.AccessToken == "" {
+		t.Errorf("Expected a token after the failures, got %+v", r)
+	}
+
+	// the latency delays the response
+	s.Latency = 20 * time.Millisecond
+	start := time.Now()
+	call(t, s, "GET", url, nil)
+	if elapsed := time.Since(start); elapsed < s.Latency {
+		t.Errorf("Expected a delay of %v, got %v", s.Latency, elapsed)
+	}
+}